@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"os"
@@ -49,24 +50,79 @@ func main() {
 
 	projectService := service.NewProjectService(mongodb)
 	releaseService := service.NewReleaseService(mongodb)
+	lockService := service.NewLockService(mongodb, cfg.DeployConf.LockLeaseMinutes, cfg.DeployConf.LockMaxHours)
+	releaseService.SetLockService(lockService)
+	lockService.Start(context.Background(), releaseService)
+	eventBus := service.NewEventBus()
+	releaseService.SetEventBus(eventBus)
 	monitoringService := service.NewMonitoringService()
+	metricsService := service.NewMetricsService(mongodb)
 	binService := service.NewBinService()
 	configService := service.NewConfigService(mongodb)
 	grayReleaseService := service.NewGrayReleaseService(mongodb)
 	machineService := service.NewMachineService(mongodb)
+	jobService := service.NewJobService(mongodb)
+	buildProfileService := service.NewBuildProfileService(mongodb)
+	mgr.SetProjectService(projectService)
+	mgr.SetBuildProfileService(buildProfileService)
+	artifactStore := service.NewArtifactStore(mongodb, cfg.ArtifactConf)
+	if err := artifactStore.LoadSigningKeys(); err != nil {
+		log.Error().Err(err).Msg("加载产物签名密钥失败")
+		return
+	}
+	artifactStore.Start(context.Background())
+	mgr.SetArtifactStore(artifactStore)
+	mgr.SetBuildCache(service.NewBuildCacheService(mongodb))
+	releaseService.SetArtifactStore(artifactStore)
+	mgr.RegisterBuildJobs(jobService, releaseService)
+	jobService.Start(context.Background())
+	applicationService := service.NewApplicationService(mongodb)
+	deployService := service.NewDeployService(mongodb, releaseService, binService, cfg.DeployConf)
+	deployService.SetApplicationService(applicationService)
+	deployService.SetArtifactStore(artifactStore)
+	deployService.SetProjectService(projectService)
+	deployService.Start(context.Background())
+	scheduleService := service.NewScheduleService(mongodb, releaseService, deployService)
+	freezeService := service.NewFreezeService(mongodb)
+	scheduleService.SetFreezeService(freezeService)
+	scheduleService.Start(context.Background())
+	approvalService := service.NewApprovalService(mongodb, releaseService)
+	promotionService := service.NewPromotionService(mongodb, releaseService, projectService, jobService)
+	promotionService.SetArtifactStore(artifactStore)
 
 	projectHandler := handler.NewProjectHandler(projectService)
+	applicationHandler := handler.NewApplicationHandler(applicationService)
+	buildProfileHandler := handler.NewBuildProfileHandler(buildProfileService, projectService)
 	releaseHandler := handler.NewReleaseHandler(releaseService, mgr, projectService)
+	releaseHandler.SetJobService(jobService)
+	releaseHandler.SetDeployService(deployService)
+	releaseHandler.SetPromotionService(promotionService)
+	jobHandler := handler.NewJobHandler(jobService)
+	lockHandler := handler.NewLockHandler(lockService)
+	streamHandler := handler.NewStreamHandler(eventBus)
+	webhookHandler := handler.NewWebhookHandler(mgr, releaseService, cfg.JenkinsConf.WebhookToken)
+	scheduleHandler := handler.NewScheduleHandler(scheduleService)
+	approvalHandler := handler.NewApprovalHandler(approvalService)
 	monitoringHandler := handler.NewMonitoringHandler(monitoringService)
+	metricsHandler := handler.NewMetricsHandler(metricsService)
 	binHandler := handler.NewBinHandler(binService)
 	machineHandler := handler.NewMachineHandler(machineService)
 	gitlabMgr := service.NewGitLabMgr(cfg.GitlabConf)
+	releaseService.SetGitLabMgr(gitlabMgr)
 	binHandler.SetGitLabMgr(gitlabMgr)
 	binHandler.SetReleaseService(releaseService)
+	binHandler.SetDeployService(deployService)
+	binHandler.SetArtifactStore(artifactStore)
+	artifactHandler := handler.NewArtifactHandler(artifactStore)
 	configHandler := handler.NewConfigHandler(configService)
 	configHandler.SetGitLabMgr(gitlabMgr)
 	grayReleaseHandler := handler.NewGrayReleaseHandler(grayReleaseService)
+	freezeHandler := handler.NewFreezeHandler(freezeService, releaseService, configService)
+	freezeHandler.SetPromotionService(promotionService)
 	webHandler := handler.NewWebHandler()
+	authHandler := handler.NewAuthHandler(cfg.AuthConf)
+	requireApprover := authHandler.Require(handler.RoleApprover)
+	requireAdmin := authHandler.Require(handler.RoleAdmin)
 
 	r.GET("/", webHandler.Index)
 	r.GET("/projects", webHandler.Projects)
@@ -74,32 +130,79 @@ func main() {
 	r.GET("/monitoring", webHandler.Monitoring)
 	r.GET("/config", webHandler.Config)
 
-	api := r.Group("/api/v1")
+	api := r.Group("/api/v1", authHandler.Authenticate)
 	{
 		api.GET("/projects", projectHandler.List)
 		api.POST("/projects", projectHandler.Create)
 		api.PUT("/projects/:id", projectHandler.Update)
 		api.DELETE("/projects/:id", projectHandler.Delete)
+		api.GET("/projects/:id/build-profile", buildProfileHandler.Get)
+		api.PUT("/projects/:id/build-profile", requireAdmin, buildProfileHandler.Save)
+		api.DELETE("/projects/:id/build-profile", requireAdmin, buildProfileHandler.Delete)
+		api.GET("/build-profiles", buildProfileHandler.List)
+
+		api.GET("/applications", applicationHandler.List)
+		api.POST("/applications", applicationHandler.Create)
+		api.GET("/applications/:id", applicationHandler.Get)
+		api.PUT("/applications/:id", applicationHandler.Update)
+		api.DELETE("/applications/:id", applicationHandler.Delete)
 
 		api.GET("/releases", releaseHandler.List)
-		api.POST("/releases", releaseHandler.Create)
+		api.POST("/releases", freezeHandler.Guard(service.FreezeActionReleaseCreate, freezeHandler.BodyScope), releaseHandler.Create)
 		api.POST("/releases/batch-delete", releaseHandler.BatchDelete)
 		api.GET("/releases/:id", releaseHandler.Get)
 		api.POST("/releases/:id/rollback", releaseHandler.Rollback)
-		api.POST("/releases/:id/approve", releaseHandler.Approve)
-		api.POST("/releases/:id/deploy", releaseHandler.Deploy)
+		api.POST("/releases/:id/promote", freezeHandler.Guard(service.FreezeActionReleaseCreate, freezeHandler.PromoteScope), releaseHandler.Promote)
+		api.POST("/releases/:id/approve", requireApprover, approvalHandler.Approve)
+		api.POST("/releases/:id/reject", requireApprover, approvalHandler.Reject)
+		api.GET("/releases/:id/approvals", approvalHandler.List)
+		api.POST("/releases/:id/deploy", freezeHandler.Guard(service.FreezeActionReleaseDeploy, freezeHandler.ReleaseScope), releaseHandler.Deploy)
+		api.GET("/releases/:id/events", releaseHandler.Events)
+		api.GET("/releases/:id/jobs", jobHandler.ListByRelease)
+		api.GET("/releases/:id/nodes", releaseHandler.Nodes)
+		api.GET("/releases/:id/notes", releaseHandler.Notes)
+		api.GET("/releases/:id/build-log", releaseHandler.BuildLog)
+		api.POST("/releases/:id/build/cancel", releaseHandler.CancelBuild)
+		api.POST("/releases/:id/build/retry", releaseHandler.RetryBuild)
+		api.GET("/releases/:id/stream", streamHandler.Stream)
+		api.POST("/webhooks/jenkins", webhookHandler.Jenkins)
+		api.POST("/releases/:id/notes", releaseHandler.GenerateNotes)
+		api.GET("/jobs/:id", jobHandler.Get)
+		api.POST("/releases/:id/schedule", scheduleHandler.Create)
+		api.GET("/schedules", scheduleHandler.List)
+		api.GET("/promotion-overrides", releaseHandler.PromotionOverrides)
+		api.PUT("/schedules/:id", scheduleHandler.Reschedule)
+		api.POST("/schedules/:id/cancel", scheduleHandler.Cancel)
+
+		api.POST("/approvals/:releaseId", requireApprover, approvalHandler.Submit)
+		api.GET("/approval-policies", approvalHandler.ListPolicies)
+		api.PUT("/approval-policies", requireAdmin, approvalHandler.SavePolicy)
+		api.DELETE("/approval-policies/:id", requireAdmin, approvalHandler.DeletePolicy)
+
+		api.GET("/stream", streamHandler.Stream)
+
+		api.GET("/locks", lockHandler.List)
+		api.DELETE("/locks/:id", requireAdmin, lockHandler.Delete)
+
+		api.GET("/freezes", freezeHandler.List)
+		api.POST("/freezes", requireAdmin, freezeHandler.Create)
+		api.GET("/freezes/overrides", freezeHandler.ListOverrides)
+		api.GET("/freezes/:id", freezeHandler.Get)
+		api.PUT("/freezes/:id", requireAdmin, freezeHandler.Update)
+		api.DELETE("/freezes/:id", requireAdmin, freezeHandler.Delete)
 
 		api.GET("/monitoring/realtime", monitoringHandler.GetRealtime)
 		api.GET("/monitoring/timeseries", monitoringHandler.GetTimeSeries)
+		api.GET("/metrics/delivery", metricsHandler.Delivery)
 
 		api.GET("/machines", machineHandler.ListByProject)
 
 		api.GET("/configs", configHandler.List)
-		api.POST("/configs", configHandler.Create)
+		api.POST("/configs", freezeHandler.Guard(service.FreezeActionConfigChange, freezeHandler.BodyScope), configHandler.Create)
 		api.GET("/configs/:id", configHandler.Get)
-		api.PUT("/configs/:id", configHandler.Update)
-		api.DELETE("/configs/:id", configHandler.Delete)
-		api.POST("/configs/:id/rollback", configHandler.Rollback)
+		api.PUT("/configs/:id", freezeHandler.Guard(service.FreezeActionConfigChange, freezeHandler.ConfigScope), configHandler.Update)
+		api.DELETE("/configs/:id", freezeHandler.Guard(service.FreezeActionConfigChange, freezeHandler.ConfigScope), configHandler.Delete)
+		api.POST("/configs/:id/rollback", freezeHandler.Guard(service.FreezeActionConfigChange, freezeHandler.ConfigScope), configHandler.Rollback)
 		api.GET("/configs/:id/history", configHandler.GetHistory)
 		api.GET("/configs/history", configHandler.GetHistoryByProject)
 		api.GET("/configs/compare", configHandler.Compare)
@@ -111,7 +214,7 @@ func main() {
 		api.PUT("/gray-releases/:id", grayReleaseHandler.Update)
 		api.DELETE("/gray-releases/:id", grayReleaseHandler.Delete)
 		api.GET("/gray-releases/device-stats", grayReleaseHandler.GetDeviceStats)
-		api.POST("/gray-releases/full-release", grayReleaseHandler.FullRelease)
+		api.POST("/gray-releases/full-release", freezeHandler.Guard(service.FreezeActionFullRelease, freezeHandler.BodyScope), grayReleaseHandler.FullRelease)
 		api.POST("/gray-releases/device-status", grayReleaseHandler.UpdateDeviceStatus)
 		api.POST("/gray-releases/check-rule", grayReleaseHandler.CheckDeviceGrayRule)
 
@@ -121,6 +224,15 @@ func main() {
 		api.POST("/bins/:bin_name", binHandler.PostBin)
 		api.POST("/bins/:bin_name/progress", binHandler.PostProgress)
 		api.GET("/download/:bin_file_name", binHandler.Download)
+
+		api.GET("/artifacts", artifactHandler.List)
+		api.POST("/artifacts/gc", artifactHandler.GC)
+		api.GET("/artifacts/:ref", artifactHandler.Get)
+		api.GET("/artifacts/:ref/download", artifactHandler.Download)
+		api.GET("/artifacts/:ref/signature", artifactHandler.Signature)
+		api.GET("/artifact-keys", artifactHandler.Keys)
+		api.POST("/artifact-keys/rotate", requireAdmin, artifactHandler.RotateKey)
+		api.DELETE("/artifact-keys/:id", requireAdmin, artifactHandler.RetireKey)
 	}
 
 	r.GET("/health", binHandler.Health)
@@ -17,6 +17,15 @@ type JenkinsConf struct {
 	ApiToken   string `json:"apitoken"`
 	JenkinsURL string `json:"url"`
 	ProjectID  string `json:"projectID"`
+	// WebhookToken 非空时启用构建通知回调, 回调需要带上该 token, 构建状态轮询降为兜底
+	WebhookToken string `json:"webhookToken"`
+}
+
+// LocalBuildConf 本地构建后端, 在 Manager 所在机器上执行构建命令
+type LocalBuildConf struct {
+	Command string `json:"command"` // 构建配置没有 job 时通过 sh -c 执行, 构建变量和参数以环境变量传入, 产物写入 $ARTIFACT_DIR
+	WorkDir string `json:"workDir"` // 命令的工作目录, 默认为当前目录
+	Dir     string `json:"dir"`     // 构建日志和产物的保存目录, 默认 builds
 }
 
 type MongoConf struct {
@@ -24,9 +33,51 @@ type MongoConf struct {
 	Database string `json:"database"`
 }
 
+type DeployConf struct {
+	SuccessQuorum     float64 `json:"successQuorum"`     // 成功节点占比达到该值即完成, 默认 1
+	MaxFailureRatio   float64 `json:"maxFailureRatio"`   // 失败节点占比超过该值即失败, 0 表示仅在无法达到 quorum 时失败
+	TimeoutMinutes    int     `json:"timeoutMinutes"`    // 部署超时时间, 默认 30 分钟
+	NodeActiveMinutes int     `json:"nodeActiveMinutes"` // 最近该时间内有 keepalive 的节点作为部署目标, 默认 5 分钟
+	CanarySteps       []int   `json:"canarySteps"`       // 金丝雀每批累计升级的节点百分比, 默认 10, 50, 100
+	StepWaitSeconds   int     `json:"stepWaitSeconds"`   // 金丝雀每批升级完成后的观察时间, 默认 120 秒
+	MaxUnavailable    int     `json:"maxUnavailable"`    // 滚动更新每批最多同时升级的节点数, 默认 1
+
+	HealthCheckWindowSeconds    int `json:"healthCheckWindowSeconds"`    // 部署后健康检查的观察时间, 默认 120 秒
+	HealthCheckIntervalSeconds  int `json:"healthCheckIntervalSeconds"`  // 健康检查探测间隔, 默认 10 秒
+	HealthCheckTimeoutSeconds   int `json:"healthCheckTimeoutSeconds"`   // 单次探测超时时间, 默认 5 秒
+	HealthCheckFailureThreshold int `json:"healthCheckFailureThreshold"` // 同一地址连续失败该次数即自动回滚, 默认 3
+
+	LockLeaseMinutes int `json:"lockLeaseMinutes"` // 项目环境发布锁的租约时间, 进行中的发布单会自动续约, 默认 10 分钟
+	LockMaxHours     int `json:"lockMaxHours"`     // 发布锁最长持有时间, 超过后不再自动续约, 默认 24 小时
+}
+
+// ArtifactConf 构建产物仓库, 产物按 sha256 保存, 元数据保存在 MongoDB
+type ArtifactConf struct {
+	Dir               string `json:"dir"`               // 产物仓库目录, 默认 artifacts
+	RetainReleases    int    `json:"retainReleases"`    // 每个项目环境保留最近该数量已完成发布单引用的产物, 默认 10
+	MinAgeHours       int    `json:"minAgeHours"`       // 产物至少保留的时间, 默认 168 小时
+	GCIntervalMinutes int    `json:"gcIntervalMinutes"` // 清理间隔, 默认 60 分钟
+	SigningKeyDir     string `json:"signingKeyDir"`     // ed25519 签名密钥目录, 默认 <dir>/keys, 没有密钥时自动生成
+}
+
+// AuthConf 接口鉴权, 请求通过 Authorization: Bearer <token> 识别用户, 审批和管理接口需要对应角色
+type AuthConf struct {
+	Users []AuthUser `json:"users"`
+}
+
+type AuthUser struct {
+	Name  string   `json:"name"`
+	Token string   `json:"token"`
+	Roles []string `json:"roles"` // admin 或 approver, admin 拥有所有权限
+}
+
 type Config struct {
-	GitHubConf  GitHubConf  `json:"githubConf"`
-	GitlabConf  GitlabConf  `json:"gitlabConf"`
-	JenkinsConf JenkinsConf `json:"jenkinsConf"`
-	MongoConf   MongoConf   `json:"mongoConf"`
+	GitHubConf     GitHubConf     `json:"githubConf"`
+	GitlabConf     GitlabConf     `json:"gitlabConf"`
+	JenkinsConf    JenkinsConf    `json:"jenkinsConf"`
+	LocalBuildConf LocalBuildConf `json:"localBuildConf"`
+	MongoConf      MongoConf      `json:"mongoConf"`
+	DeployConf     DeployConf     `json:"deployConf"`
+	ArtifactConf   ArtifactConf   `json:"artifactConf"`
+	AuthConf       AuthConf       `json:"authConf"`
 }
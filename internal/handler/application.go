@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ApplicationHandler struct {
+	service *service.ApplicationService
+}
+
+func NewApplicationHandler(service *service.ApplicationService) *ApplicationHandler {
+	return &ApplicationHandler{service: service}
+}
+
+func (h *ApplicationHandler) List(c *gin.Context) {
+	applications, err := h.service.List(c.Query("projectId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    applications,
+	})
+}
+
+func (h *ApplicationHandler) Get(c *gin.Context) {
+	application, err := h.service.Get(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == mongo.ErrNoDocuments {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    application,
+	})
+}
+
+func (h *ApplicationHandler) Create(c *gin.Context) {
+	var application model.Application
+	if err := c.ShouldBindJSON(&application); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.Create(&application); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    application,
+	})
+}
+
+func (h *ApplicationHandler) Update(c *gin.Context) {
+	id := c.Param("id")
+	var application model.Application
+	if err := c.ShouldBindJSON(&application); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.Update(id, &application); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+	})
+}
+
+func (h *ApplicationHandler) Delete(c *gin.Context) {
+	if err := h.service.Delete(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+	})
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ApprovalHandler struct {
+	service *service.ApprovalService
+}
+
+func NewApprovalHandler(service *service.ApprovalService) *ApprovalHandler {
+	return &ApprovalHandler{service: service}
+}
+
+type approvalRequest struct {
+	Action  string `json:"action"`
+	Comment string `json:"comment"`
+}
+
+// Submit 对应设计文档 POST /approvals/{releaseId}, action 为 approve 或 reject, 审批人为认证的用户
+func (h *ApprovalHandler) Submit(c *gin.Context) {
+	h.submit(c, c.Param("releaseId"), "")
+}
+
+func (h *ApprovalHandler) Approve(c *gin.Context) {
+	h.submit(c, c.Param("id"), model.ApprovalActionApprove)
+}
+
+func (h *ApprovalHandler) Reject(c *gin.Context) {
+	h.submit(c, c.Param("id"), model.ApprovalActionReject)
+}
+
+func (h *ApprovalHandler) submit(c *gin.Context, releaseID string, action string) {
+	var req approvalRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+	if action == "" {
+		action = req.Action
+	}
+	approver := ""
+	if user := identity(c); user != nil {
+		approver = user.Name
+	}
+
+	status, err := h.service.Submit(releaseID, approver, action, req.Comment)
+	if err != nil {
+		c.JSON(approvalErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    status,
+	})
+}
+
+func (h *ApprovalHandler) List(c *gin.Context) {
+	status, err := h.service.Status(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    status,
+	})
+}
+
+func (h *ApprovalHandler) ListPolicies(c *gin.Context) {
+	policies, err := h.service.ListPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    policies,
+	})
+}
+
+func (h *ApprovalHandler) SavePolicy(c *gin.Context) {
+	var policy model.ApprovalPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	saved, err := h.service.SavePolicy(&policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    saved,
+	})
+}
+
+func (h *ApprovalHandler) DeletePolicy(c *gin.Context) {
+	if err := h.service.DeletePolicy(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+	})
+}
+
+func approvalErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrApproverRequired), errors.Is(err, service.ErrInvalidAction):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrSelfApproval), errors.Is(err, service.ErrNoRequester):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrAlreadyApproved):
+		return http.StatusConflict
+	}
+	return releaseErrorStatus(err)
+}
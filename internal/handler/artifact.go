@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"path/filepath"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+type ArtifactHandler struct {
+	store *service.ArtifactStore
+}
+
+func NewArtifactHandler(store *service.ArtifactStore) *ArtifactHandler {
+	return &ArtifactHandler{store: store}
+}
+
+func artifactErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrArtifactNotFound), errors.Is(err, service.ErrArtifactNotSigned),
+		errors.Is(err, service.ErrSigningKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrSigningKeyActive):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrArtifactAmbiguous):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *ArtifactHandler) List(c *gin.Context) {
+	artifacts, err := h.store.List(c.Query("projectId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    artifacts,
+	})
+}
+
+// Get 按 sha256 或版本查询产物元数据, 按版本查询时需通过 ?projectId= 指定项目
+func (h *ArtifactHandler) Get(c *gin.Context) {
+	artifact, err := h.store.Get(c.Query("projectId"), c.Param("ref"))
+	if err != nil {
+		c.JSON(artifactErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    artifact,
+	})
+}
+
+// Download 按 sha256 或版本下载产物, 响应头 X-Checksum-Sha256 为产物的 sha256, 已签名时带 X-Signature-Ed25519 和 X-Signature-Key-Id
+func (h *ArtifactHandler) Download(c *gin.Context) {
+	ref := c.Param("ref")
+	projectID := c.Query("projectId")
+	version, digest := ref, ""
+	if artifact, err := h.store.Get(projectID, ref); err == nil {
+		version, digest = artifact.Version, artifact.Digest
+	} else if !errors.Is(err, service.ErrArtifactNotFound) && !errors.Is(err, service.ErrArtifactAmbiguous) {
+		c.JSON(artifactErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// 仓库中没有时 Resolve 回退到 downloads 目录下的同名文件
+	path, digest, err := h.store.Resolve(projectID, version, digest)
+	if err != nil {
+		c.JSON(artifactErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("X-Checksum-Sha256", digest)
+	if _, signature, err := h.store.Signature(projectID, digest); err == nil {
+		c.Header("X-Signature-Ed25519", signature.Signature)
+		c.Header("X-Signature-Key-Id", signature.KeyID)
+	}
+	c.FileAttachment(path, filepath.Base(version))
+}
+
+// Signature 返回产物的分离签名, 签名内容为 "sha256:<digest>"; format=raw 时返回 64 字节的原始签名
+func (h *ArtifactHandler) Signature(c *gin.Context) {
+	artifact, signature, err := h.store.Signature(c.Query("projectId"), c.Param("ref"))
+	if err != nil {
+		c.JSON(artifactErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if c.Query("format") == "raw" {
+		raw, err := base64.StdEncoding.DecodeString(signature.Signature)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.Response{
+				Code:    1,
+				Message: err.Error(),
+			})
+			return
+		}
+		c.Header("X-Signature-Key-Id", signature.KeyID)
+		c.Header("Content-Disposition", `attachment; filename="`+artifact.Version+`.sig"`)
+		c.Data(http.StatusOK, "application/octet-stream", raw)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data: gin.H{
+			"version":   artifact.Version,
+			"digest":    artifact.Digest,
+			"signature": signature,
+		},
+	})
+}
+
+// Keys 返回受信任的签名公钥, 当前签名密钥在前
+func (h *ArtifactHandler) Keys(c *gin.Context) {
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    h.store.SigningKeys(),
+	})
+}
+
+// RotateKey 生成新的签名密钥
+func (h *ArtifactHandler) RotateKey(c *gin.Context) {
+	key, err := h.store.RotateSigningKey()
+	if err != nil {
+		c.JSON(artifactErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	log.Warn().Str("keyId", key.ID).Str("operator", operatorOf(c)).Msg("产物签名密钥被人工轮换")
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    key,
+	})
+}
+
+// RetireKey 移除不再信任的签名密钥, 该密钥签名的产物先用当前密钥重新签名
+func (h *ArtifactHandler) RetireKey(c *gin.Context) {
+	id := c.Param("id")
+	resigned, err := h.store.RetireSigningKey(id)
+	if err != nil {
+		c.JSON(artifactErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	log.Warn().Str("keyId", id).Int("resigned", resigned).Str("operator", operatorOf(c)).Msg("产物签名密钥被人工移除")
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    gin.H{"resigned": resigned},
+	})
+}
+
+// GC 立即执行一次产物清理
+func (h *ArtifactHandler) GC(c *gin.Context) {
+	result, err := h.store.GC()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    result,
+	})
+}
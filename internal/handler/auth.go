@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	cfg "github.com/felix-001/qnHackathon/internal/config"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RoleAdmin    = "admin"
+	RoleApprover = "approver"
+
+	contextIdentity = "identity"
+)
+
+// AuthHandler 按配置的 token 识别请求的用户
+type AuthHandler struct {
+	users []cfg.AuthUser
+}
+
+func NewAuthHandler(conf cfg.AuthConf) *AuthHandler {
+	return &AuthHandler{users: conf.Users}
+}
+
+// Authenticate 识别请求的用户, 没有携带 token 时作为匿名请求继续, token 无效时拒绝
+func (h *AuthHandler) Authenticate(c *gin.Context) {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		c.Next()
+		return
+	}
+
+	user := h.lookup(token)
+	if user == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
+			Code:    1,
+			Message: "invalid token",
+		})
+		return
+	}
+	c.Set(contextIdentity, user)
+	c.Next()
+}
+
+func (h *AuthHandler) lookup(token string) *cfg.AuthUser {
+	for i := range h.users {
+		if h.users[i].Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.users[i].Token)) == 1 {
+			return &h.users[i]
+		}
+	}
+	return nil
+}
+
+// Require 要求请求已认证且拥有任一角色
+func (h *AuthHandler) Require(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := identity(c)
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, model.Response{
+				Code:    1,
+				Message: "authentication required",
+			})
+			return
+		}
+		if !hasRole(user, roles) {
+			c.AbortWithStatusJSON(http.StatusForbidden, model.Response{
+				Code:    1,
+				Message: "permission denied",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func hasRole(user *cfg.AuthUser, roles []string) bool {
+	for _, have := range user.Roles {
+		if have == RoleAdmin {
+			return true
+		}
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// identity 返回已认证的用户, 匿名请求返回 nil
+func identity(c *gin.Context) *cfg.AuthUser {
+	if value, ok := c.Get(contextIdentity); ok {
+		return value.(*cfg.AuthUser)
+	}
+	return nil
+}
+
+// operatorOf 返回操作人, 已认证时为认证的用户名, 否则为 X-Operator 头
+func operatorOf(c *gin.Context) string {
+	if user := identity(c); user != nil {
+		return user.Name
+	}
+	return c.GetHeader(headerOperator)
+}
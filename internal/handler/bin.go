@@ -2,25 +2,26 @@ package handler
 
 import (
 	"crypto/md5"
-	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 
+	"github.com/felix-001/qnHackathon/internal/model"
 	"github.com/felix-001/qnHackathon/internal/service"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
-	gitlab "gitlab.com/gitlab-org/api/client-go"
 )
 
 type BinHandler struct {
 	binService     *service.BinService
 	gitlabMgr      *service.GitLabMgr
 	releaseService *service.ReleaseService
+	deployService  *service.DeployService
+	artifacts      *service.ArtifactStore
 }
 
 func NewBinHandler(binService *service.BinService) *BinHandler {
@@ -37,6 +38,14 @@ func (h *BinHandler) SetReleaseService(releaseService *service.ReleaseService) {
 	h.releaseService = releaseService
 }
 
+func (h *BinHandler) SetDeployService(deployService *service.DeployService) {
+	h.deployService = deployService
+}
+
+func (h *BinHandler) SetArtifactStore(artifacts *service.ArtifactStore) {
+	h.artifacts = artifacts
+}
+
 func (h *BinHandler) GetKeepalive(c *gin.Context) {
 	nodeID := c.Query("node_id")
 	if nodeID == "" {
@@ -60,12 +69,29 @@ func (h *BinHandler) PostKeepalive(c *gin.Context) {
 		OSRelease       string `json:"os_release"`
 		NodeName        string `json:"node_name"`
 		BinProxyVersion string `json:"bin_proxy_version"`
+		// scripts/binproxy.py 上报的是驼峰字段
+		CPUArchCamel         string `json:"cpuArch"`
+		OSReleaseCamel       string `json:"osRelease"`
+		NodeNameCamel        string `json:"nodeName"`
+		BinProxyVersionCamel string `json:"binProxyVersion"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "node_id required in request body"})
 		return
 	}
+	if req.CPUArch == "" {
+		req.CPUArch = req.CPUArchCamel
+	}
+	if req.OSRelease == "" {
+		req.OSRelease = req.OSReleaseCamel
+	}
+	if req.NodeName == "" {
+		req.NodeName = req.NodeNameCamel
+	}
+	if req.BinProxyVersion == "" {
+		req.BinProxyVersion = req.BinProxyVersionCamel
+	}
 
 	node := h.binService.RegisterNode(
 		req.NodeID,
@@ -87,42 +113,29 @@ func (h *BinHandler) GetBin(c *gin.Context) {
 		return
 	}
 
-	masterBranch := "master"
-	file, resp, err := h.gitlabMgr.Client.RepositoryFiles.GetFile(
-		h.gitlabMgr.Conf.ProjectID,
-		"streamd.json",
-		&gitlab.GetFileOptions{
-			Ref: &masterBranch,
-		})
+	nodeID := c.Query("node_id")
+	artifact, err := h.servedArtifact(c.Param("bin_name"), nodeID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to fetch streamd.json: %v", err)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch streamd.json from GitLab"})
+	artifact, err = h.nodeVariant(nodeID, artifact)
+	if errors.Is(err, service.ErrNoPlatformArtifact) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
-
-	var streamdData struct {
-		Version string `json:"version"`
-	}
-	log.Debug().Str("content", file.Content).Msg("读取 streamd.json 内容")
-	// 先对 file.Content 进行 base64 解码
-	decoded, err := base64.StdEncoding.DecodeString(file.Content)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to decode streamd.json content: %v", err)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	log.Debug().Str("decoded", string(decoded)).Msg("解析 streamd.json 内容")
-	if err := json.Unmarshal(decoded, &streamdData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to parse streamd.json: %v", err)})
+	filePath, sha256sum, err := h.artifacts.Resolve(artifact.ProjectID, artifact.Version, artifact.Digest)
+	if errors.Is(err, service.ErrArtifactNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "version file not found in artifact store"})
 		return
 	}
-
-	filePath := filepath.Join("downloads", streamdData.Version)
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "version file not found in downloads"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -133,20 +146,75 @@ func (h *BinHandler) GetBin(c *gin.Context) {
 	}
 	defer fileHandle.Close()
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, fileHandle); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to calculate MD5: %v", err)})
+	md5Hash := md5.New()
+	if _, err := io.Copy(md5Hash, fileHandle); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to calculate checksum: %v", err)})
 		return
 	}
 
-	md5Sum := hex.EncodeToString(hash.Sum(nil))
+	// 签名内容为 "sha256:<sha256sum>", bin-proxy 用 /artifact-keys 中受信任的公钥验签; 签名功能之前入库的产物没有签名
+	var signature *model.ArtifactSignature
+	if _, sig, err := h.artifacts.Signature(artifact.ProjectID, sha256sum); err == nil {
+		signature = sig
+	} else if !errors.Is(err, service.ErrArtifactNotSigned) && !errors.Is(err, service.ErrArtifactNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"version": streamdData.Version,
-		"md5":     md5Sum,
+		"version":   artifact.Version,
+		"md5":       hex.EncodeToString(md5Hash.Sum(nil)),
+		"sha256sum": sha256sum,
+		"signature": signature,
 	})
 }
 
+// servedArtifact 该 bin 分批部署期间按节点所在批次返回新旧发布单的产物, 否则返回最近部署的发布单的产物;
+// 没有记录产物的发布单时才读取版本文件, 版本没有对应发布单时只有版本名, 只能从 downloads 目录查找;
+// 未配置 GitLab 时不读取版本文件
+func (h *BinHandler) servedArtifact(binName, nodeID string) (*service.ArtifactRef, error) {
+	if h.deployService != nil {
+		if nodeID != "" {
+			if artifact, ok := h.deployService.ServedArtifact(binName, nodeID); ok {
+				return artifact, nil
+			}
+		}
+		if artifact, ok := h.deployService.CurrentArtifact(binName); ok {
+			return artifact, nil
+		}
+	}
+	if h.gitlabMgr == nil {
+		return &service.ArtifactRef{}, nil
+	}
+	version, err := h.gitlabMgr.GetVersion("streamd.json")
+	if err != nil {
+		return nil, err
+	}
+	if h.deployService != nil {
+		if artifact, ok := h.deployService.VersionArtifact(binName, version); ok {
+			return artifact, nil
+		}
+	}
+	return &service.ArtifactRef{Version: version}, nil
+}
+
+// nodeVariant 按节点 keepalive 上报的 CPU 架构和发行版从发布单的多平台产物中选择, 之后按该产物的 sha256 下载;
+// 未上报过的节点和没有多平台产物的发布单使用主产物
+func (h *BinHandler) nodeVariant(nodeID string, artifact *service.ArtifactRef) (*service.ArtifactRef, error) {
+	if nodeID == "" {
+		return artifact, nil
+	}
+	node, ok := h.binService.GetNode(nodeID)
+	if !ok {
+		return artifact, nil
+	}
+	variant, err := service.SelectVariant(artifact.Variants, node.CPUArch, node.OSRelease)
+	if err != nil || variant == nil {
+		return artifact, err
+	}
+	return &service.ArtifactRef{ProjectID: artifact.ProjectID, Version: variant.Version, Digest: variant.Digest}, nil
+}
+
 func (h *BinHandler) PostBin(c *gin.Context) {
 	binName := c.Param("bin_name")
 
@@ -192,16 +260,25 @@ func (h *BinHandler) PostProgress(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get release"})
 			return
 		}
-		if release.Status != "approved" {
+		if !releaseServable(release.Status) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "release not approved"})
 			return
 		}
+	}
 
-		if req.Status == "success" {
-			if err := h.releaseService.Complete(req.ReleaseID); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update release status"})
-				return
-			}
+	if h.deployService != nil {
+		err := h.deployService.RecordProgress(&model.NodeProgress{
+			ReleaseID:      req.ReleaseID,
+			NodeName:       req.NodeName,
+			BinName:        binName,
+			TargetHash:     req.TargetHash,
+			Status:         req.Status,
+			ProcessingTime: req.ProcessingTime,
+		})
+		if err != nil {
+			log.Error().Err(err).Str("nodeName", req.NodeName).Msg("记录部署进度失败")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update release progress"})
+			return
 		}
 	}
 
@@ -231,19 +308,45 @@ func (h *BinHandler) Download(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get release"})
 			return
 		}
-		if release.Status != "approved" {
+		if !releaseServable(release.Status) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "release not approved"})
 			return
 		}
 	}
 
-	filePath := filepath.Join("downloads", binFileName)
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	// 与 GetBin 相同按发布单的项目和 sha256 下载产物, 分批部署期间为节点所在批次对应的产物;
+	// bin-proxy 以 bin 名称作为下载文件名, 也可以通过 ?bin= 指定. 不是发布单服务的 bin 时按文件名从 downloads 目录下载
+	nodeID := c.Query("node_id")
+	artifact, err := h.servedArtifact(c.DefaultQuery("bin", binFileName), nodeID)
+	if err != nil {
+		// 读取版本文件失败不影响下载, 按文件名从 downloads 目录下载
+		log.Warn().Err(err).Str("file", binFileName).Msg("查询 bin 当前产物失败, 使用本地文件")
+		artifact = &service.ArtifactRef{}
+	}
+	if artifact.ProjectID == "" {
+		artifact = &service.ArtifactRef{Version: binFileName}
+	}
+	artifact, err = h.nodeVariant(nodeID, artifact)
+	if errors.Is(err, service.ErrNoPlatformArtifact) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filePath, _, err := h.artifacts.Resolve(artifact.ProjectID, artifact.Version, artifact.Digest)
+	if errors.Is(err, service.ErrArtifactNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	c.File(filePath)
+	c.FileAttachment(filePath, filepath.Base(artifact.Version))
 }
 
 func (h *BinHandler) Health(c *gin.Context) {
@@ -253,3 +356,12 @@ func (h *BinHandler) Health(c *gin.Context) {
 		"bins_count":  h.binService.GetBinsCount(),
 	})
 }
+
+// releaseServable 审批通过后的发布单才允许节点下载和上报进度
+func releaseServable(status string) bool {
+	switch status {
+	case model.ReleaseStatusApproved, model.ReleaseStatusDeploying, model.ReleaseStatusCompleted:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cfg "github.com/felix-001/qnHackathon/internal/config"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// newBinProxyServer 注册 bin-proxy 使用的接口, 不依赖 MongoDB 和 GitLab
+func newBinProxyServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	h := NewBinHandler(service.NewBinService())
+	r := gin.New()
+	api := r.Group("/api/v1")
+	api.GET("/keepalive", h.GetKeepalive)
+	api.POST("/keepalive", h.PostKeepalive)
+	api.GET("/bins/:bin_name", h.GetBin)
+	api.POST("/bins/:bin_name", h.PostBin)
+	api.POST("/bins/:bin_name/progress", h.PostProgress)
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func doJSON(t *testing.T, method, url string, body any) (int, map[string]any) {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	decoded := map[string]any{}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("%s %s: response is not a JSON object: %v", method, url, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+// TestBinProxyContract 按 scripts/binproxy.py 发送的请求检查接口的状态码和响应字段
+func TestBinProxyContract(t *testing.T) {
+	server := newBinProxyServer(t)
+	api := server.URL + "/api/v1"
+
+	// keepalive_check: GET 不是 200 时 POST get_node_info() 的结果
+	status, _ := doJSON(t, http.MethodGet, api+"/keepalive?node_id=node-1", nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("GET /keepalive for unknown node: status %d, want %d", status, http.StatusNotFound)
+	}
+	status, _ = doJSON(t, http.MethodPost, api+"/keepalive", map[string]string{
+		"node_id":         "node-1",
+		"cpuArch":         "aarch64",
+		"osRelease":       "Ubuntu 22.04.4 LTS",
+		"nodeName":        "node-1",
+		"binProxyVersion": "1.0.0",
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("POST /keepalive: status %d, want %d", status, http.StatusCreated)
+	}
+	status, node := doJSON(t, http.MethodGet, api+"/keepalive?node_id=node-1", nil)
+	if status != http.StatusOK {
+		t.Fatalf("GET /keepalive after register: status %d, want %d", status, http.StatusOK)
+	}
+	for key, want := range map[string]string{
+		"cpu_arch":          "aarch64",
+		"os_release":        "Ubuntu 22.04.4 LTS",
+		"node_name":         "node-1",
+		"bin_proxy_version": "1.0.0",
+	} {
+		if node[key] != want {
+			t.Errorf("keepalive node %s = %v, want %q", key, node[key], want)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		status int
+		fields []string
+	}{
+		{
+			name:   "post_update_status",
+			method: http.MethodPost,
+			path:   "/bins/streamd",
+			body:   map[string]string{"node_id": "node-1", "sha256sum": "abc"},
+			status: http.StatusOK,
+			fields: []string{"sha256sum", "bin_name"},
+		},
+		{
+			name:   "post_update_status without sha256sum",
+			method: http.MethodPost,
+			path:   "/bins/streamd",
+			body:   map[string]string{"node_id": "node-1"},
+			status: http.StatusBadRequest,
+			fields: []string{"error"},
+		},
+		{
+			name:   "report_progress",
+			method: http.MethodPost,
+			path:   "/bins/streamd/progress",
+			body: map[string]any{
+				"nodeName":       "node-1",
+				"binName":        "streamd",
+				"targetHash":     "abc",
+				"processingTime": 3,
+				"status":         "in_progress",
+			},
+			status: http.StatusOK,
+			fields: []string{"nodeName", "binName"},
+		},
+		{
+			name:   "report_completion",
+			method: http.MethodPost,
+			path:   "/bins/streamd/progress",
+			body: map[string]any{
+				"nodeName":       "node-1",
+				"binName":        "streamd",
+				"targetHash":     "abc",
+				"processingTime": 12,
+				"status":         "success",
+			},
+			status: http.StatusOK,
+			fields: []string{"nodeName", "binName"},
+		},
+		{
+			name:   "report_progress without status",
+			method: http.MethodPost,
+			path:   "/bins/streamd/progress",
+			body:   map[string]any{"nodeName": "node-1", "targetHash": "abc"},
+			status: http.StatusBadRequest,
+			fields: []string{"error"},
+		},
+		{
+			// query_latest_sha256 把非 200 视为失败, 错误响应也必须是 JSON
+			name:   "query_latest_sha256 without GitLab",
+			method: http.MethodGet,
+			path:   "/bins/streamd?node_id=node-1",
+			status: http.StatusInternalServerError,
+			fields: []string{"error"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := doJSON(t, tt.method, api+tt.path, tt.body)
+			if status != tt.status {
+				t.Fatalf("status %d, want %d, body %v", status, tt.status, body)
+			}
+			for _, field := range tt.fields {
+				if _, ok := body[field]; !ok {
+					t.Errorf("response has no %q field: %v", field, body)
+				}
+			}
+		})
+	}
+}
+
+// TestDownloadFallsBackWhenGitLabFails 读取版本文件失败时仍按文件名从 downloads 目录下载
+func TestDownloadFallsBackWhenGitLabFails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("downloads", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("downloads", "streamd"), []byte("streamd-binary"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	gitlab := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(gitlab.Close)
+
+	h := NewBinHandler(service.NewBinService())
+	h.SetGitLabMgr(service.NewGitLabMgr(cfg.GitlabConf{GitLabURL: gitlab.URL, ProjectID: "1"}))
+	r := gin.New()
+	r.GET("/download/:bin_file_name", h.Download)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/download/streamd?node_id=node-1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d, body %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got := w.Body.String(); got != "streamd-binary" {
+		t.Fatalf("body %q, want the local download", got)
+	}
+}
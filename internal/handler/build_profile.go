@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type BuildProfileHandler struct {
+	service        *service.BuildProfileService
+	projectService *service.ProjectService
+}
+
+func NewBuildProfileHandler(service *service.BuildProfileService, projectService *service.ProjectService) *BuildProfileHandler {
+	return &BuildProfileHandler{
+		service:        service,
+		projectService: projectService,
+	}
+}
+
+func (h *BuildProfileHandler) List(c *gin.Context) {
+	profiles, err := h.service.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    profiles,
+	})
+}
+
+func (h *BuildProfileHandler) Get(c *gin.Context) {
+	profile, err := h.service.Get(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == mongo.ErrNoDocuments {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    profile,
+	})
+}
+
+// Save 创建或覆盖项目的构建配置
+func (h *BuildProfileHandler) Save(c *gin.Context) {
+	var profile model.BuildProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	projectID := c.Param("id")
+	project, err := h.projectService.Get(projectID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == mongo.ErrNoDocuments {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if project.Builder == service.BuilderLocal {
+		if err := service.ValidateLocalBuildJob(profile.Job); err != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Code:    1,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
+	profile.ProjectID = projectID
+	profile.UpdatedBy = operatorOf(c)
+	if err := h.service.Save(&profile); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrInvalidBuildProfile) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	log.Info().Str("projectId", projectID).Str("operator", profile.UpdatedBy).Msg("构建配置已更新")
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    profile,
+	})
+}
+
+func (h *BuildProfileHandler) Delete(c *gin.Context) {
+	projectID := c.Param("id")
+	if err := h.service.Delete(projectID); err != nil {
+		status := http.StatusInternalServerError
+		if err == mongo.ErrNoDocuments {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	log.Info().Str("projectId", projectID).Str("operator", operatorOf(c)).Msg("构建配置已删除")
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+	})
+}
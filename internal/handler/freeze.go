@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	headerOperator       = "X-Operator"
+	headerOverrideReason = "X-Freeze-Override-Reason"
+)
+
+// FreezeScopeFunc 从请求中解析变更所属的项目和环境
+type FreezeScopeFunc func(c *gin.Context) (projectID string, environment string, err error)
+
+type FreezeHandler struct {
+	service        *service.FreezeService
+	releaseService *service.ReleaseService
+	configService  *service.ConfigService
+	promotion      *service.PromotionService
+}
+
+func NewFreezeHandler(service *service.FreezeService, releaseService *service.ReleaseService, configService *service.ConfigService) *FreezeHandler {
+	return &FreezeHandler{
+		service:        service,
+		releaseService: releaseService,
+		configService:  configService,
+	}
+}
+
+func (h *FreezeHandler) SetPromotionService(promotion *service.PromotionService) {
+	h.promotion = promotion
+}
+
+// Guard 封版检查中间件, 封版期间需已认证的用户通过 X-Freeze-Override-Reason 头给出紧急原因才能继续,
+// 紧急变更在 handler 成功返回后才记录
+func (h *FreezeHandler) Guard(action string, scope FreezeScopeFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		projectID, environment, err := scope(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, model.Response{
+				Code:    1,
+				Message: err.Error(),
+			})
+			return
+		}
+
+		// 紧急变更只接受认证用户, 操作人不取 X-Operator 头
+		user := identity(c)
+		operator, reason := "", ""
+		if user != nil {
+			operator, reason = user.Name, c.GetHeader(headerOverrideReason)
+		}
+		override, err := h.service.Check(projectID, environment, action, c.Request.URL.Path, operator, reason)
+		if err != nil {
+			status := http.StatusInternalServerError
+			message := err.Error()
+			if errors.Is(err, service.ErrFrozen) {
+				status = http.StatusLocked
+				if user == nil && c.GetHeader(headerOverrideReason) != "" {
+					status = http.StatusUnauthorized
+					message = "freeze override requires authentication: " + message
+				}
+			}
+			c.AbortWithStatusJSON(status, model.Response{
+				Code:    1,
+				Message: message,
+			})
+			return
+		}
+
+		c.Next()
+
+		if override == nil || c.Writer.Status() >= http.StatusMultipleChoices {
+			return
+		}
+		if err := h.service.RecordOverride(override); err != nil {
+			log.Error().Err(err).Str("freezeId", override.FreezeID).Str("target", override.Target).
+				Str("operator", override.Operator).Msg("记录封版期间紧急变更失败")
+		}
+	}
+}
+
+// BodyScope 从请求体的 projectId/environment 或 config.projectId/config.environment 解析范围,
+// 读取后会还原请求体供后续 handler 绑定
+func (h *FreezeHandler) BodyScope(c *gin.Context) (string, string, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", "", err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req struct {
+		ProjectID   string `json:"projectId"`
+		Environment string `json:"environment"`
+		Config      *struct {
+			ProjectID   string `json:"projectId"`
+			Environment string `json:"environment"`
+		} `json:"config"`
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			return "", "", err
+		}
+	}
+	if req.Config != nil && req.ProjectID == "" && req.Environment == "" {
+		return req.Config.ProjectID, req.Config.Environment, nil
+	}
+	return req.ProjectID, req.Environment, nil
+}
+
+func (h *FreezeHandler) ReleaseScope(c *gin.Context) (string, string, error) {
+	release, err := h.releaseService.Get(c.Param("id"))
+	if err != nil {
+		return "", "", err
+	}
+	return release.ProjectID, release.Environment, nil
+}
+
+// PromoteScope 晋级按目标环境检查封版
+func (h *FreezeHandler) PromoteScope(c *gin.Context) (string, string, error) {
+	release, err := h.releaseService.Get(c.Param("id"))
+	if err != nil {
+		return "", "", err
+	}
+	next, err := h.promotion.NextEnvironment(release)
+	if err != nil {
+		return "", "", err
+	}
+	return release.ProjectID, next, nil
+}
+
+func (h *FreezeHandler) ConfigScope(c *gin.Context) (string, string, error) {
+	config, err := h.configService.Get(c.Param("id"))
+	if err != nil {
+		return "", "", err
+	}
+	return config.ProjectID, config.Environment, nil
+}
+
+func (h *FreezeHandler) List(c *gin.Context) {
+	windows, err := h.service.List(c.Query("active") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    windows,
+	})
+}
+
+func (h *FreezeHandler) Get(c *gin.Context) {
+	window, err := h.service.Get(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == mongo.ErrNoDocuments {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    window,
+	})
+}
+
+func (h *FreezeHandler) Create(c *gin.Context) {
+	var window model.FreezeWindow
+	if err := c.ShouldBindJSON(&window); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.Create(&window); err != nil {
+		c.JSON(freezeErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    window,
+	})
+}
+
+func (h *FreezeHandler) Update(c *gin.Context) {
+	id := c.Param("id")
+	var window model.FreezeWindow
+	if err := c.ShouldBindJSON(&window); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.Update(id, &window); err != nil {
+		c.JSON(freezeErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	window.ID = id
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    window,
+	})
+}
+
+func (h *FreezeHandler) Delete(c *gin.Context) {
+	if err := h.service.Delete(c.Param("id")); err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+	})
+}
+
+func (h *FreezeHandler) ListOverrides(c *gin.Context) {
+	overrides, err := h.service.ListOverrides(c.Query("freezeId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    overrides,
+	})
+}
+
+func freezeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidFreeze):
+		return http.StatusBadRequest
+	case err == mongo.ErrNoDocuments:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
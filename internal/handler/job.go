@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type JobHandler struct {
+	service *service.JobService
+}
+
+func NewJobHandler(service *service.JobService) *JobHandler {
+	return &JobHandler{service: service}
+}
+
+func (h *JobHandler) ListByRelease(c *gin.Context) {
+	releaseID := c.Param("id")
+	jobs, err := h.service.ListByRelease(releaseID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    jobs,
+	})
+}
+
+func (h *JobHandler) Get(c *gin.Context) {
+	id := c.Param("id")
+	job, err := h.service.Get(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    job,
+	})
+}
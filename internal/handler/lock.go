@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type LockHandler struct {
+	service *service.LockService
+}
+
+func NewLockHandler(service *service.LockService) *LockHandler {
+	return &LockHandler{service: service}
+}
+
+func (h *LockHandler) List(c *gin.Context) {
+	locks, err := h.service.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    locks,
+	})
+}
+
+// Delete 人工释放发布锁, id 为 projectId:environment, 仅管理员可用
+func (h *LockHandler) Delete(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.service.Delete(id); err != nil {
+		status := http.StatusInternalServerError
+		if err == mongo.ErrNoDocuments {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	log.Warn().Str("lock", id).Str("operator", operatorOf(c)).Msg("发布锁被人工释放")
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+	})
+}
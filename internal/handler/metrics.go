@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsHandler struct {
+	service *service.MetricsService
+}
+
+func NewMetricsHandler(service *service.MetricsService) *MetricsHandler {
+	return &MetricsHandler{service: service}
+}
+
+// Delivery 返回 DORA 交付指标, from/to 为 RFC3339 时间或 2006-01-02 (北京时间) 日期
+func (h *MetricsHandler) Delivery(c *gin.Context) {
+	from, err := parseMetricsTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+	to, err := parseMetricsTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: "from must be before to",
+		})
+		return
+	}
+
+	report, err := h.service.Delivery(c.Query("projectId"), c.Query("environment"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    report,
+	})
+}
+
+func parseMetricsTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.FixedZone("CST", 8*3600))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 or 2006-01-02", value)
+	}
+	return t, nil
+}
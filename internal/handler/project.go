@@ -29,12 +29,20 @@ func (h *ProjectHandler) Create(c *gin.Context) {
 	var project model.Project
 	if err := c.ShouldBindJSON(&project); err != nil {
 		c.JSON(http.StatusBadRequest, model.Response{
-			Code:    1,
+			Code:    400,
 			Message: err.Error(),
 		})
 		return
 	}
 
+	if !service.IsValidBuilder(project.Builder) {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    400,
+			Message: "unknown builder " + project.Builder,
+		})
+		return
+	}
+
 	if err := h.service.Create(&project); err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Code:    500,
@@ -61,6 +69,14 @@ func (h *ProjectHandler) Update(c *gin.Context) {
 		return
 	}
 
+	if !service.IsValidBuilder(project.Builder) {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    400,
+			Message: "unknown builder " + project.Builder,
+		})
+		return
+	}
+
 	if err := h.service.Update(id, &project); err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Code:    500,
@@ -1,8 +1,9 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
-	"net/url"
+	"strconv"
 
 	"github.com/felix-001/qnHackathon/internal/model"
 	"github.com/felix-001/qnHackathon/internal/service"
@@ -10,10 +11,16 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// headerPromotionOverrideReason 跳过环境晋级顺序直接创建发布单的原因
+const headerPromotionOverrideReason = "X-Promotion-Override-Reason"
+
 type ReleaseHandler struct {
 	service        *service.ReleaseService
 	manager        *service.Manager
 	projectService *service.ProjectService
+	jobService     *service.JobService
+	deployService  *service.DeployService
+	promotion      *service.PromotionService
 }
 
 func NewReleaseHandler(service *service.ReleaseService, manager *service.Manager, projectService *service.ProjectService) *ReleaseHandler {
@@ -24,6 +31,18 @@ func NewReleaseHandler(service *service.ReleaseService, manager *service.Manager
 	}
 }
 
+func (h *ReleaseHandler) SetJobService(jobService *service.JobService) {
+	h.jobService = jobService
+}
+
+func (h *ReleaseHandler) SetDeployService(deployService *service.DeployService) {
+	h.deployService = deployService
+}
+
+func (h *ReleaseHandler) SetPromotionService(promotion *service.PromotionService) {
+	h.promotion = promotion
+}
+
 func (h *ReleaseHandler) List(c *gin.Context) {
 	releases := h.service.List()
 	c.JSON(http.StatusOK, model.Response{
@@ -33,9 +52,20 @@ func (h *ReleaseHandler) List(c *gin.Context) {
 	})
 }
 
+// createReleaseRequest 创建发布单时用户可以填写的字段, 状态、构建、产物等由服务端维护
+type createReleaseRequest struct {
+	ProjectID     string `json:"projectId"`
+	ApplicationID string `json:"applicationId"`
+	Version       string `json:"version"`
+	Environment   string `json:"environment"`
+	Strategy      string `json:"strategy"`
+	Description   string `json:"description"`
+	Scheduler     string `json:"scheduler"`
+}
+
 func (h *ReleaseHandler) Create(c *gin.Context) {
-	var release model.Release
-	if err := c.ShouldBindJSON(&release); err != nil {
+	var req createReleaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, model.Response{
 			Code:    1,
 			Message: err.Error(),
@@ -43,6 +73,22 @@ func (h *ReleaseHandler) Create(c *gin.Context) {
 		return
 	}
 
+	release := model.Release{
+		ProjectID:     req.ProjectID,
+		ApplicationID: req.ApplicationID,
+		Version:       req.Version,
+		Environment:   req.Environment,
+		Strategy:      req.Strategy,
+		Description:   req.Description,
+		Scheduler:     req.Scheduler,
+	}
+	if user := identity(c); user != nil {
+		release.CreatedBy = user.Name
+	}
+	if release.Scheduler == "" {
+		release.Scheduler = operatorOf(c)
+	}
+
 	projects := h.projectService.List()
 	for _, p := range projects {
 		if p.ID == release.ProjectID {
@@ -51,7 +97,35 @@ func (h *ReleaseHandler) Create(c *gin.Context) {
 		}
 	}
 
+	var override *model.PromotionOverride
+	if h.promotion != nil {
+		var err error
+		override, err = h.promotion.CheckCreate(release.ProjectID, release.Environment,
+			operatorOf(c), c.GetHeader(headerPromotionOverrideReason))
+		if err != nil {
+			c.JSON(releaseErrorStatus(err), model.Response{
+				Code:    1,
+				Message: err.Error(),
+			})
+			return
+		}
+	}
+
 	if err := h.service.Create(&release); err != nil {
+		c.JSON(releaseErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	err := h.jobService.Enqueue(&model.Job{
+		ReleaseID: release.ID,
+		Type:      model.JobTypeBuild,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("releaseId", release.ID).Msg("构建任务入队失败")
+		h.service.Fail(release.ID, "system", "构建任务入队失败")
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Code:    1,
 			Message: err.Error(),
@@ -59,24 +133,20 @@ func (h *ReleaseHandler) Create(c *gin.Context) {
 		return
 	}
 
-	go func() {
-		buildInfo := h.manager.Build()
-		if buildInfo != nil {
-			if buildInfo.GitlabPRURL != "" {
-				u, err := url.Parse(buildInfo.GitlabPRURL)
-				if err != nil {
-					log.Error().Err(err).Str("url", buildInfo.GitlabPRURL).Msg("解析 GitLab PR URL 失败")
-					return
-				}
-				u.Host = "101.133.131.188:30811"
-				buildInfo.GitlabPRURL = u.String()
-				h.service.UpdateGitlabPR(release.ID, u.String())
-			}
-			if buildInfo.TarFileName != "" {
-				h.service.UpdateTarFileName(release.ID, buildInfo.TarFileName)
-			}
+	err = h.jobService.Enqueue(&model.Job{
+		ReleaseID: release.ID,
+		Type:      model.JobTypeReleaseNote,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("releaseId", release.ID).Msg("发布说明任务入队失败")
+	}
+
+	if override != nil {
+		override.ReleaseID = release.ID
+		if err := h.promotion.RecordOverride(override); err != nil {
+			log.Error().Err(err).Str("releaseId", release.ID).Str("operator", override.Operator).Msg("记录跳过晋级顺序失败")
 		}
-	}()
+	}
 
 	c.JSON(http.StatusOK, model.Response{
 		Code:    0,
@@ -117,7 +187,46 @@ func (h *ReleaseHandler) Rollback(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.Rollback(id, req.TargetVersion, req.Reason); err != nil {
+	rollback, err := h.service.Rollback(id, req.TargetVersion, req.Reason, operatorOf(c))
+	if err != nil {
+		c.JSON(releaseErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+	if err := h.deployService.Track(rollback.ID); err != nil {
+		log.Error().Err(err).Str("releaseId", rollback.ID).Msg("跟踪回滚部署进度失败")
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    rollback,
+	})
+}
+
+// Promote 将已完成的发布单晋级到项目环境顺序中的下一个环境
+func (h *ReleaseHandler) Promote(c *gin.Context) {
+	promoted, err := h.promotion.Promote(c.Param("id"), operatorOf(c))
+	if err != nil {
+		c.JSON(releaseErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    promoted,
+	})
+}
+
+func (h *ReleaseHandler) PromotionOverrides(c *gin.Context) {
+	overrides, err := h.promotion.ListOverrides(c.Query("projectId"))
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Code:    1,
 			Message: err.Error(),
@@ -125,16 +234,51 @@ func (h *ReleaseHandler) Rollback(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    overrides,
+	})
+}
+
+func (h *ReleaseHandler) Deploy(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.deployService.Deploy(id, operatorOf(c)); err != nil {
+		c.JSON(releaseErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, model.Response{
 		Code:    0,
 		Message: "success",
 	})
 }
 
-func (h *ReleaseHandler) Approve(c *gin.Context) {
+func (h *ReleaseHandler) Events(c *gin.Context) {
 	id := c.Param("id")
+	events, err := h.service.ListEvents(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
 
-	if err := h.service.Approve(id); err != nil {
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    events,
+	})
+}
+
+func (h *ReleaseHandler) Nodes(c *gin.Context) {
+	id := c.Param("id")
+	summary, err := h.deployService.Summary(id)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Code:    1,
 			Message: err.Error(),
@@ -145,13 +289,143 @@ func (h *ReleaseHandler) Approve(c *gin.Context) {
 	c.JSON(http.StatusOK, model.Response{
 		Code:    0,
 		Message: "success",
+		Data:    summary,
 	})
 }
 
-func (h *ReleaseHandler) Deploy(c *gin.Context) {
+// Notes 返回发布说明, ?format=markdown 时直接返回 Markdown 文本
+func (h *ReleaseHandler) Notes(c *gin.Context) {
+	release, err := h.service.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+	if release.ReleaseNotes == nil {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    1,
+			Message: "release notes not generated yet",
+		})
+		return
+	}
+
+	if c.Query("format") == "markdown" {
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(release.ReleaseNotes.Markdown))
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    release.ReleaseNotes,
+	})
+}
+
+// BuildLog 返回构建日志中 offset 之后的部分, 构建期间按返回的 next 轮询获取增量日志;
+// ?attempt=N 返回第 N 次历史构建的日志, ?format=text 时直接返回完整的日志文本
+func (h *ReleaseHandler) BuildLog(c *gin.Context) {
+	id := c.Param("id")
+	attempt, err := strconv.Atoi(c.DefaultQuery("attempt", "0"))
+	if err != nil || attempt < 0 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: "invalid attempt",
+		})
+		return
+	}
+
+	if c.Query("format") == "text" {
+		if _, err := h.service.Get(id); err != nil {
+			c.JSON(http.StatusNotFound, model.Response{
+				Code:    1,
+				Message: err.Error(),
+			})
+			return
+		}
+		path := service.BuildLogPath(id)
+		if attempt > 0 {
+			path = service.BuildAttemptLogPath(id, attempt)
+		}
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		c.File(path)
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: "invalid offset",
+		})
+		return
+	}
+
+	buildLog, err := h.service.BuildLog(id, attempt, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    buildLog,
+	})
+}
+
+type buildActionRequest struct {
+	Operator     string `json:"operator"`
+	ForceRebuild bool   `json:"forceRebuild"` // 重新构建时不使用构建缓存
+}
+
+// buildAction 解析构建操作的请求体, 操作人取请求体中的 operator, 没有时取 X-Operator 头
+func buildAction(c *gin.Context) buildActionRequest {
+	var req buildActionRequest
+	if c.Request.ContentLength > 0 {
+		_ = c.ShouldBindJSON(&req)
+	}
+	if req.Operator == "" {
+		req.Operator = c.GetHeader(headerOperator)
+	}
+	return req
+}
+
+// CancelBuild 中止发布单正在进行的构建, 发布单置为失败
+func (h *ReleaseHandler) CancelBuild(c *gin.Context) {
 	id := c.Param("id")
+	if err := h.manager.CancelBuild(h.jobService, h.service, id, buildAction(c).Operator); err != nil {
+		c.JSON(releaseErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+	})
+}
+
+// RetryBuild 构建失败或取消后为同一发布单重新构建, 之前的构建保留在 buildAttempts 中
+func (h *ReleaseHandler) RetryBuild(c *gin.Context) {
+	id := c.Param("id")
+	req := buildAction(c)
+	if err := h.manager.RetryBuild(h.jobService, h.service, id, req.Operator, req.ForceRebuild); err != nil {
+		c.JSON(releaseErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
 
-	if err := h.service.Deploy(id); err != nil {
+	release, err := h.service.Get(id)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.Response{
 			Code:    1,
 			Message: err.Error(),
@@ -159,13 +433,28 @@ func (h *ReleaseHandler) Deploy(c *gin.Context) {
 		return
 	}
 
-	go func() {
-		h.service.Complete(id)
-	}()
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    release,
+	})
+}
+
+// GenerateNotes 重新生成发布说明
+func (h *ReleaseHandler) GenerateNotes(c *gin.Context) {
+	notes, err := h.manager.GenerateReleaseNotes(h.service, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, model.Response{
 		Code:    0,
 		Message: "success",
+		Data:    notes,
 	})
 }
 
@@ -202,3 +491,12 @@ func (h *ReleaseHandler) BatchDelete(c *gin.Context) {
 		Message: "success",
 	})
 }
+
+// releaseErrorStatus 非法的状态流转或当前无法执行的操作返回 409, 其余按服务端错误处理
+func releaseErrorStatus(err error) int {
+	if errors.Is(err, service.ErrInvalidTransition) || errors.Is(err, service.ErrNoTargetNodes) ||
+		errors.Is(err, service.ErrEnvironmentOrder) || errors.Is(err, service.ErrReleaseLocked) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ScheduleHandler struct {
+	service *service.ScheduleService
+}
+
+func NewScheduleHandler(service *service.ScheduleService) *ScheduleHandler {
+	return &ScheduleHandler{service: service}
+}
+
+type scheduleRequest struct {
+	RunAt    *time.Time               `json:"runAt"`
+	Window   *model.MaintenanceWindow `json:"window"`
+	Operator string                   `json:"operator"`
+}
+
+func (h *ScheduleHandler) Create(c *gin.Context) {
+	releaseID := c.Param("id")
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	schedule, err := h.service.Create(releaseID, req.RunAt, req.Window, req.Operator)
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    schedule,
+	})
+}
+
+// List 默认只返回待执行的计划, status=all 返回全部
+func (h *ScheduleHandler) List(c *gin.Context) {
+	status := c.DefaultQuery("status", model.ScheduleStatusPending)
+	if status == "all" {
+		status = ""
+	}
+
+	schedules, err := h.service.List(status, c.Query("releaseId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    schedules,
+	})
+}
+
+func (h *ScheduleHandler) Reschedule(c *gin.Context) {
+	id := c.Param("id")
+	var req scheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	schedule, err := h.service.Reschedule(id, req.RunAt, req.Window, req.Operator)
+	if err != nil {
+		c.JSON(scheduleErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    schedule,
+	})
+}
+
+func (h *ScheduleHandler) Cancel(c *gin.Context) {
+	id := c.Param("id")
+	var req struct {
+		Operator string `json:"operator"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.Cancel(id, req.Operator); err != nil {
+		c.JSON(scheduleErrorStatus(err), model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+	})
+}
+
+func scheduleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidSchedule):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrScheduleNotPending), errors.Is(err, service.ErrScheduleExists):
+		return http.StatusConflict
+	}
+	return releaseErrorStatus(err)
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// streamHeartbeat 定期发送注释行, 防止代理因空闲断开连接
+const streamHeartbeat = 15 * time.Second
+
+type StreamHandler struct {
+	bus *service.EventBus
+}
+
+func NewStreamHandler(bus *service.EventBus) *StreamHandler {
+	return &StreamHandler{bus: bus}
+}
+
+// Stream 以 SSE 推送发布事件, 支持 projectId/releaseId/types 过滤.
+// 断线重连时浏览器会带上 Last-Event-ID 头, 也可以用 lastEventId 参数指定
+func (h *StreamHandler) Stream(c *gin.Context) {
+	filter := service.StreamFilter{
+		ProjectID: c.Query("projectId"),
+		ReleaseID: c.Query("releaseId"),
+	}
+	if id := c.Param("id"); id != "" {
+		filter.ReleaseID = id
+	}
+	if types := c.Query("types"); types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+	var lastID int64
+	if lastEventID != "" {
+		id, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, model.Response{
+				Code:    1,
+				Message: "invalid last event id",
+			})
+			return
+		}
+		lastID = id
+	}
+
+	sub, backlog, missed := h.bus.Subscribe(filter, lastID)
+	defer h.bus.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	// 缓存中已没有 lastEventID 之后的全部事件, 通知客户端重新拉取发布单状态
+	if missed {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range backlog {
+		if err := writeStreamEvent(w, event); err != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// 消费过慢被断开, 客户端重连后从 Last-Event-ID 续传
+				log.Warn().Str("releaseId", filter.ReleaseID).Str("projectId", filter.ProjectID).Msg("事件订阅者消费过慢, 已断开")
+				return
+			}
+			if err := writeStreamEvent(w, event); err != nil {
+				return
+			}
+			w.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+		}
+	}
+}
+
+func writeStreamEvent(w gin.ResponseWriter, event *model.StreamEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
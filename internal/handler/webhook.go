@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/felix-001/qnHackathon/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+const headerJenkinsToken = "X-Jenkins-Token"
+
+// WebhookHandler 接收构建后端的通知回调
+type WebhookHandler struct {
+	manager      *service.Manager
+	releases     *service.ReleaseService
+	jenkinsToken string
+}
+
+func NewWebhookHandler(manager *service.Manager, releases *service.ReleaseService, jenkinsToken string) *WebhookHandler {
+	return &WebhookHandler{
+		manager:      manager,
+		releases:     releases,
+		jenkinsToken: jenkinsToken,
+	}
+}
+
+// Jenkins 接收 Jenkins Notification 插件的回调, token 通过 X-Jenkins-Token 头或 ?token= 传入
+func (h *WebhookHandler) Jenkins(c *gin.Context) {
+	if h.jenkinsToken == "" {
+		c.JSON(http.StatusNotFound, model.Response{
+			Code:    1,
+			Message: "jenkins webhook not enabled",
+		})
+		return
+	}
+	token := c.GetHeader(headerJenkinsToken)
+	if token == "" {
+		token = c.Query("token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.jenkinsToken)) != 1 {
+		c.JSON(http.StatusUnauthorized, model.Response{
+			Code:    1,
+			Message: "invalid webhook token",
+		})
+		return
+	}
+
+	var notification service.JenkinsNotification
+	if err := c.ShouldBindJSON(&notification); err != nil {
+		c.JSON(http.StatusBadRequest, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	release, err := h.manager.HandleJenkinsNotification(h.releases, &notification)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.Response{
+			Code:    1,
+			Message: err.Error(),
+		})
+		return
+	}
+	if release == nil {
+		c.JSON(http.StatusOK, model.Response{
+			Code:    0,
+			Message: "no pending build matched",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, model.Response{
+		Code:    0,
+		Message: "success",
+		Data:    gin.H{"releaseId": release.ID},
+	})
+}
@@ -13,7 +13,7 @@ type FlexibleVersion string
 
 func (v *FlexibleVersion) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
 	raw := bson.RawValue{Type: t, Value: data}
-	
+
 	switch t {
 	case bsontype.String:
 		var s string
@@ -67,11 +67,82 @@ type Project struct {
 	GithubURL      string    `json:"githubUrl" bson:"githubUrl"`
 	BuildTool      string    `json:"buildTool" bson:"buildTool"`
 	DeploymentType string    `json:"deploymentType" bson:"deploymentType"`
+	Environments   []string  `json:"environments,omitempty" bson:"environments,omitempty"` // 环境晋级顺序, 为空时使用默认顺序
+	Builder        string    `json:"builder,omitempty" bson:"builder,omitempty"`           // 构建后端: jenkins (默认), gitlab-ci, local
 	Status         string    `json:"status" bson:"status"`
 	CreatedAt      time.Time `json:"createdAt" bson:"createdAt"`
 	UpdatedAt      time.Time `json:"updatedAt" bson:"updatedAt"`
 }
 
+// BuildProfile 项目的构建配置, 以项目 ID 为主键. Params、Job 和产物匹配规则中可以使用变量:
+// {version} {branch} {date} {module} {toolchain} {releaseId} {commit}
+type BuildProfile struct {
+	ProjectID        string            `json:"projectId" bson:"_id"`
+	Job              string            `json:"job" bson:"job"`                           // Jenkins 任务名 / GitLab 项目路径 / 本地命令, 为空时使用构建后端的默认值
+	Repository       string            `json:"repository" bson:"repository"`             // 源码仓库, github.com/<owner>/<repo> 或 GitLab 项目路径, 用于解析提交和构建缓存
+	Module           string            `json:"module" bson:"module"`                     // 为空时使用项目 code
+	Branch           string            `json:"branch" bson:"branch"`                     // 默认 main
+	Toolchain        string            `json:"toolchain" bson:"toolchain"`               // 如 miku_go1.22.9
+	Params           map[string]string `json:"params" bson:"params"`                     // 构建参数模板
+	ArtifactPatterns []string          `json:"artifactPatterns" bson:"artifactPatterns"` // 需要下载的产物, 按顺序取第一个匹配的文件, 文件名即版本号
+	PackagePattern   string            `json:"packagePattern" bson:"packagePattern"`     // 产物包, 默认 *.tar.gz
+	Platforms        []BuildPlatform   `json:"platforms" bson:"platforms"`               // 多平台产物, 配置后按平台分别匹配产物, 第一个为主产物
+	UpdatedBy        string            `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt        time.Time         `json:"updatedAt" bson:"updatedAt"`
+}
+
+// BuildPlatform 一个目标平台的产物匹配规则. OS 和 Arch 使用 GOOS/GOARCH 的写法,
+// OSRelease 为节点发行版 (os-release 的 PRETTY_NAME) 的前缀, 为空时匹配该 OS 的所有节点
+type BuildPlatform struct {
+	OS               string   `json:"os" bson:"os"` // 默认 linux
+	Arch             string   `json:"arch" bson:"arch"`
+	OSRelease        string   `json:"osRelease,omitempty" bson:"osRelease,omitempty"`
+	ArtifactPatterns []string `json:"artifactPatterns" bson:"artifactPatterns"`
+}
+
+// Artifact 产物仓库中一个版本的元数据, 文件内容按 Digest (sha256) 保存, 相同内容的版本共用一份文件
+type Artifact struct {
+	ID         string              `json:"id" bson:"_id"`
+	ProjectID  string              `json:"projectId" bson:"projectId"`
+	Version    string              `json:"version" bson:"version"` // 产物文件名, 与发布单的 artifactVersion 一致
+	Digest     string              `json:"digest" bson:"digest"`
+	Size       int64               `json:"size" bson:"size"`
+	OS         string              `json:"os,omitempty" bson:"os,omitempty"`
+	Arch       string              `json:"arch,omitempty" bson:"arch,omitempty"`
+	OSRelease  string              `json:"osRelease,omitempty" bson:"osRelease,omitempty"`
+	Group      string              `json:"group,omitempty" bson:"group,omitempty"`       // 多平台产物所属的主产物版本
+	BuildID    string              `json:"buildId,omitempty" bson:"buildId,omitempty"`   // 构建后端/构建 ID
+	Releases   []string            `json:"releases,omitempty" bson:"releases,omitempty"` // 引用该产物的发布单
+	Signatures []ArtifactSignature `json:"signatures,omitempty" bson:"signatures,omitempty"`
+	CreatedAt  time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// ArtifactSignature 产物的分离签名, 签名内容为 "sha256:<产物 sha256>", Signature 为 base64 编码
+type ArtifactSignature struct {
+	KeyID     string    `json:"keyId" bson:"keyId"`
+	Algorithm string    `json:"algorithm" bson:"algorithm"`
+	Signature string    `json:"signature" bson:"signature"`
+	SignedAt  time.Time `json:"signedAt" bson:"signedAt"`
+}
+
+// SigningKey 受信任的产物签名公钥, Active 为当前用于签名的密钥, PublicKey 为 base64 编码的原始公钥
+type SigningKey struct {
+	ID        string    `json:"id"`
+	Algorithm string    `json:"algorithm"`
+	PublicKey string    `json:"publicKey"`
+	PEM       string    `json:"pem"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ArtifactGCResult 一次产物清理的结果
+type ArtifactGCResult struct {
+	Artifacts  int      `json:"artifacts"`
+	Blobs      int      `json:"blobs"`
+	FreedBytes int64    `json:"freedBytes"`
+	Versions   []string `json:"versions,omitempty"`
+}
+
 type Application struct {
 	ID             string    `json:"id" bson:"_id,omitempty"`
 	ProjectID      string    `json:"projectId" bson:"projectId"`
@@ -84,43 +155,467 @@ type Application struct {
 }
 
 type Release struct {
-	ID            string     `json:"id" bson:"_id,omitempty"`
-	ProjectID     string     `json:"projectId" bson:"projectId"`
-	ProjectName   string     `json:"projectName" bson:"projectName"`
-	ApplicationID string     `json:"applicationId" bson:"applicationId"`
-	Version       string     `json:"version" bson:"version"`
-	Environment   string     `json:"environment" bson:"environment"`
-	Strategy      string     `json:"strategy" bson:"strategy"`
-	Status        string     `json:"status" bson:"status"`
-	Description   string     `json:"description" bson:"description"`
-	Scheduler     string     `json:"scheduler" bson:"scheduler"`
-	GitlabPRURL   string     `json:"gitlabPrUrl" bson:"gitlabPrUrl"`
-	TarFileName   string     `json:"tarFileName" bson:"tarFileName"`
-	StartedAt     *time.Time `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
-	CompletedAt   *time.Time `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
-	CreatedAt     time.Time  `json:"createdAt" bson:"createdAt"`
+	ID               string             `json:"id" bson:"_id,omitempty"`
+	ProjectID        string             `json:"projectId" bson:"projectId"`
+	ProjectName      string             `json:"projectName" bson:"projectName"`
+	ApplicationID    string             `json:"applicationId" bson:"applicationId"`
+	Version          string             `json:"version" bson:"version"`
+	Environment      string             `json:"environment" bson:"environment"`
+	Strategy         string             `json:"strategy" bson:"strategy"`
+	Status           string             `json:"status" bson:"status"`
+	Description      string             `json:"description" bson:"description"`
+	Scheduler        string             `json:"scheduler" bson:"scheduler"`
+	TriggeredBy      string             `json:"triggeredBy,omitempty" bson:"triggeredBy,omitempty"` // 发起回滚的操作人
+	CreatedBy        string             `json:"createdBy,omitempty" bson:"createdBy,omitempty"`     // 创建发布单的认证用户
+	GitlabPRURL      string             `json:"gitlabPrUrl" bson:"gitlabPrUrl"`
+	TarFileName      string             `json:"tarFileName" bson:"tarFileName"`
+	ArtifactVersion  string             `json:"artifactVersion,omitempty" bson:"artifactVersion,omitempty"`
+	RollbackOf       string             `json:"rollbackOf,omitempty" bson:"rollbackOf,omitempty"`
+	PromotedFrom     string             `json:"promotedFrom,omitempty" bson:"promotedFrom,omitempty"`
+	RolledBackBy     string             `json:"rolledBackBy,omitempty" bson:"rolledBackBy,omitempty"`
+	ArtifactSHA256   string             `json:"artifactSha256,omitempty" bson:"artifactSha256,omitempty"`
+	Artifacts        []ArtifactVariant  `json:"artifacts,omitempty" bson:"artifacts,omitempty"` // 多平台产物, 第一个为主产物
+	TargetNodes      []string           `json:"targetNodes,omitempty" bson:"targetNodes,omitempty"`
+	DeployDeadline   *time.Time         `json:"deployDeadline,omitempty" bson:"deployDeadline,omitempty"`
+	PreviousArtifact string             `json:"previousArtifact,omitempty" bson:"previousArtifact,omitempty"`
+	PreviousRelease  string             `json:"previousRelease,omitempty" bson:"previousRelease,omitempty"` // 提供 PreviousArtifact 的发布单
+	RolloutSteps     []RolloutStep      `json:"rolloutSteps,omitempty" bson:"rolloutSteps,omitempty"`
+	ReleaseNotes     *ReleaseNotes      `json:"releaseNotes,omitempty" bson:"releaseNotes,omitempty"`
+	HealthCheck      *HealthCheckResult `json:"healthCheck,omitempty" bson:"healthCheck,omitempty"`
+	ForceRebuild     bool               `json:"forceRebuild,omitempty" bson:"forceRebuild,omitempty"` // 不使用构建缓存
+	BuildCache       *BuildCache        `json:"buildCache,omitempty" bson:"buildCache,omitempty"`
+	Build            *BuildHandle       `json:"build,omitempty" bson:"build,omitempty"`
+	BuildSummary     *BuildSummary      `json:"buildSummary,omitempty" bson:"buildSummary,omitempty"`
+	BuildAttempts    []BuildAttempt     `json:"buildAttempts,omitempty" bson:"buildAttempts,omitempty"`
+	Stages           []ReleaseStage     `json:"stages,omitempty" bson:"stages,omitempty"`
+	CurrentStage     string             `json:"currentStage,omitempty" bson:"-"`
+	Progress         int                `json:"progress" bson:"-"`
+	StartedAt        *time.Time         `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
+	CompletedAt      *time.Time         `json:"completedAt,omitempty" bson:"completedAt,omitempty"`
+	CreatedAt        time.Time          `json:"createdAt" bson:"createdAt"`
+}
+
+// ArtifactVariant 发布单某个平台的产物
+type ArtifactVariant struct {
+	OS        string `json:"os" bson:"os"`
+	Arch      string `json:"arch" bson:"arch"`
+	OSRelease string `json:"osRelease,omitempty" bson:"osRelease,omitempty"`
+	Version   string `json:"version" bson:"version"`
+	Digest    string `json:"digest" bson:"digest"`
+}
+
+// BuildCache 发布单构建的缓存信息, Hit 为 true 时没有触发构建, 复用了 SourceReleaseID 构建的产物
+type BuildCache struct {
+	Key             string `json:"key" bson:"key"`
+	Repository      string `json:"repository" bson:"repository"`
+	Commit          string `json:"commit" bson:"commit"`
+	Hit             bool   `json:"hit" bson:"hit"`
+	SourceReleaseID string `json:"sourceReleaseId,omitempty" bson:"sourceReleaseId,omitempty"`
+}
+
+// BuildCacheEntry 一次成功构建的产物, Key 由构建后端、仓库、提交、任务和构建参数计算
+type BuildCacheEntry struct {
+	Key         string            `json:"key" bson:"_id"`
+	ProjectID   string            `json:"projectId" bson:"projectId"`
+	Builder     string            `json:"builder" bson:"builder"`
+	Repository  string            `json:"repository" bson:"repository"`
+	Commit      string            `json:"commit" bson:"commit"`
+	Job         string            `json:"job,omitempty" bson:"job,omitempty"`
+	Params      map[string]string `json:"params,omitempty" bson:"params,omitempty"`
+	Version     string            `json:"version" bson:"version"`
+	TarFileName string            `json:"tarFileName,omitempty" bson:"tarFileName,omitempty"`
+	Digest      string            `json:"digest,omitempty" bson:"digest,omitempty"`
+	Artifacts   []ArtifactVariant `json:"artifacts,omitempty" bson:"artifacts,omitempty"`
+	ReleaseID   string            `json:"releaseId" bson:"releaseId"` // 构建该产物的发布单
+	Hits        int               `json:"hits" bson:"hits"`
+	CreatedAt   time.Time         `json:"createdAt" bson:"createdAt"`
+	LastHitAt   *time.Time        `json:"lastHitAt,omitempty" bson:"lastHitAt,omitempty"`
+}
+
+// BuildHandle 标识构建后端中的一次构建, ID 的含义由后端决定:
+// Jenkins 为队列项 ID, GitLab CI 为流水线 ID, 本地构建为构建目录名
+type BuildHandle struct {
+	Builder string `json:"builder" bson:"builder"`
+	Job     string `json:"job,omitempty" bson:"job,omitempty"`
+	ID      string `json:"id" bson:"id"`
+	Number  int64  `json:"number,omitempty" bson:"number,omitempty"` // Jenkins 构建号, 队列项开始执行后才有
+	URL     string `json:"url,omitempty" bson:"url,omitempty"`
+	Result  string `json:"result,omitempty" bson:"result,omitempty"` // 构建结束后的结果
+}
+
+// BuildAttempt 发布单之前的一次构建, 重新构建时由当前构建归档而来
+type BuildAttempt struct {
+	Attempt    int           `json:"attempt" bson:"attempt"`
+	Build      BuildHandle   `json:"build" bson:"build"`
+	Summary    *BuildSummary `json:"summary,omitempty" bson:"summary,omitempty"`
+	ArchivedAt time.Time     `json:"archivedAt" bson:"archivedAt"`
+}
+
+// BuildSummary 构建失败时从构建日志中提取的失败阶段和错误行
+type BuildSummary struct {
+	Result     string   `json:"result" bson:"result"`
+	Stage      string   `json:"stage,omitempty" bson:"stage,omitempty"`
+	ErrorLines []string `json:"errorLines,omitempty" bson:"errorLines,omitempty"`
+}
+
+// BuildLog 发布单构建日志中从请求 offset 开始的一段, Next 为下次请求的 offset
+type BuildLog struct {
+	Text string `json:"text"`
+	Next int64  `json:"next"`
+	More bool   `json:"more"`
+}
+
+const (
+	ReleaseStatusBuilding        = "building"
+	ReleaseStatusPendingApproval = "pending_approval"
+	ReleaseStatusApproved        = "approved"
+	ReleaseStatusDeploying       = "deploying"
+	ReleaseStatusCompleted       = "completed"
+	ReleaseStatusFailed          = "failed"
+	ReleaseStatusRolledBack      = "rolled_back"
+)
+
+const (
+	StrategyBlueGreen = "blue-green"
+	StrategyCanary    = "canary"
+	StrategyRolling   = "rolling-update"
+)
+
+// StepStatusVerifying 批次节点已全部升级, 处于观察期
+const StepStatusVerifying = "verifying"
+
+// RolloutStep 按发布策略拆分的部署批次, 状态复用 StageStatus*
+type RolloutStep struct {
+	Index       int        `json:"index" bson:"index"`
+	Percent     int        `json:"percent" bson:"percent"`
+	Nodes       []string   `json:"nodes" bson:"nodes"`
+	Status      string     `json:"status" bson:"status"`
+	Message     string     `json:"message,omitempty" bson:"message,omitempty"`
+	StartedAt   *time.Time `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
+	VerifyUntil *time.Time `json:"verifyUntil,omitempty" bson:"verifyUntil,omitempty"`
+	EndedAt     *time.Time `json:"endedAt,omitempty" bson:"endedAt,omitempty"`
+}
+
+const (
+	HealthCheckInProgress = "in_progress"
+	HealthCheckPassed     = "passed"
+	HealthCheckFailed     = "failed"
+)
+
+// HealthProbe 一次健康检查探测结果
+type HealthProbe struct {
+	Node       string    `json:"node,omitempty" bson:"node,omitempty"`
+	URL        string    `json:"url" bson:"url"`
+	StatusCode int       `json:"statusCode" bson:"statusCode"`
+	Error      string    `json:"error,omitempty" bson:"error,omitempty"`
+	LatencyMs  int64     `json:"latencyMs" bson:"latencyMs"`
+	Healthy    bool      `json:"healthy" bson:"healthy"`
+	CheckedAt  time.Time `json:"checkedAt" bson:"checkedAt"`
+}
+
+// HealthCheckResult 部署后的健康检查, Evidence 保留最近的失败探测
+type HealthCheckResult struct {
+	Status     string        `json:"status" bson:"status"`
+	Targets    []string      `json:"targets" bson:"targets"`
+	StartedAt  time.Time     `json:"startedAt" bson:"startedAt"`
+	Until      time.Time     `json:"until" bson:"until"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+	Rounds     int           `json:"rounds" bson:"rounds"`
+	Failures   int           `json:"failures" bson:"failures"`
+	Evidence   []HealthProbe `json:"evidence,omitempty" bson:"evidence,omitempty"`
+}
+
+// ReleaseNoteItem 一条已合并的 MR/PR
+type ReleaseNoteItem struct {
+	Source   string     `json:"source" bson:"source"` // github 或 gitlab
+	ID       string     `json:"id" bson:"id"`
+	Title    string     `json:"title" bson:"title"`
+	URL      string     `json:"url,omitempty" bson:"url,omitempty"`
+	Author   string     `json:"author,omitempty" bson:"author,omitempty"`
+	MergedAt *time.Time `json:"mergedAt,omitempty" bson:"mergedAt,omitempty"`
+}
+
+// ReleaseNoteIssue 同一模块下按 Jira 单聚合的变更, JiraID 为空表示标题中没有 Jira 单
+type ReleaseNoteIssue struct {
+	JiraID  string            `json:"jiraId" bson:"jiraId"`
+	JiraURL string            `json:"jiraUrl,omitempty" bson:"jiraUrl,omitempty"`
+	Items   []ReleaseNoteItem `json:"items" bson:"items"`
+}
+
+type ReleaseNoteModule struct {
+	Module string             `json:"module" bson:"module"`
+	Issues []ReleaseNoteIssue `json:"issues" bson:"issues"`
+}
+
+// ReleaseNotes 自上一次已完成发布以来合并的 MR/PR, Modules 为结构化内容, Markdown 为渲染结果
+type ReleaseNotes struct {
+	PreviousReleaseID string              `json:"previousReleaseId,omitempty" bson:"previousReleaseId,omitempty"`
+	Since             *time.Time          `json:"since,omitempty" bson:"since,omitempty"`
+	Modules           []ReleaseNoteModule `json:"modules" bson:"modules"`
+	Total             int                 `json:"total" bson:"total"`
+	Markdown          string              `json:"markdown" bson:"markdown"`
+	GeneratedAt       time.Time           `json:"generatedAt" bson:"generatedAt"`
+}
+
+// ReleaseLock 同一项目和环境同时只允许一个进行中的发布单, 租约到期未续约的锁可被其他发布单获取
+type ReleaseLock struct {
+	ID          string    `json:"id" bson:"_id"` // projectId:environment
+	ProjectID   string    `json:"projectId" bson:"projectId"`
+	Environment string    `json:"environment" bson:"environment"`
+	ReleaseID   string    `json:"releaseId" bson:"releaseId"`
+	AcquiredAt  time.Time `json:"acquiredAt" bson:"acquiredAt"`
+	ExpiresAt   time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// ReleaseEvent 记录发布单的一次状态流转
+type ReleaseEvent struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`
+	ReleaseID  string    `json:"releaseId" bson:"releaseId"`
+	FromStatus string    `json:"fromStatus" bson:"fromStatus"`
+	ToStatus   string    `json:"toStatus" bson:"toStatus"`
+	Operator   string    `json:"operator" bson:"operator"`
+	Reason     string    `json:"reason" bson:"reason"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// StreamEvent 推送给订阅者的发布事件, ID 单调递增, 用于断线重连时续传
+type StreamEvent struct {
+	ID        int64       `json:"id"`
+	Type      string      `json:"type"`
+	ReleaseID string      `json:"releaseId"`
+	ProjectID string      `json:"projectId,omitempty"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+// NodeProgress 节点在某次发布中的升级进度
+type NodeProgress struct {
+	ID             string    `json:"id" bson:"_id,omitempty"`
+	ReleaseID      string    `json:"releaseId" bson:"releaseId"`
+	NodeName       string    `json:"nodeName" bson:"nodeName"`
+	BinName        string    `json:"binName" bson:"binName"`
+	TargetHash     string    `json:"targetHash" bson:"targetHash"`
+	Status         string    `json:"status" bson:"status"`
+	ProcessingTime *int      `json:"processingTime,omitempty" bson:"processingTime,omitempty"`
+	UpdatedAt      time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+type DeploySummary struct {
+	ReleaseID  string          `json:"releaseId"`
+	Status     string          `json:"status"`
+	Targets    int             `json:"targets"`
+	Required   int             `json:"required"`
+	Success    int             `json:"success"`
+	Failed     int             `json:"failed"`
+	InProgress int             `json:"inProgress"`
+	Pending    int             `json:"pending"`
+	Deadline   *time.Time      `json:"deadline,omitempty"`
+	Nodes      []*NodeProgress `json:"nodes"`
+}
+
+const (
+	ScheduleStatusPending   = "pending"
+	ScheduleStatusTriggered = "triggered"
+	ScheduleStatusFailed    = "failed"
+	ScheduleStatusCancelled = "cancelled"
+)
+
+// FreezeWindow 封版窗口, ProjectID 和 Environment 为空表示全局生效
+type FreezeWindow struct {
+	ID          string    `json:"id" bson:"_id,omitempty"`
+	Name        string    `json:"name" bson:"name"`
+	ProjectID   string    `json:"projectId" bson:"projectId"`
+	Environment string    `json:"environment" bson:"environment"`
+	StartAt     time.Time `json:"startAt" bson:"startAt"`
+	EndAt       time.Time `json:"endAt" bson:"endAt"`
+	Reason      string    `json:"reason" bson:"reason"`
+	CreatedBy   string    `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+// FreezeOverride 封版期间的紧急变更记录
+type FreezeOverride struct {
+	ID          string    `json:"id" bson:"_id,omitempty"`
+	FreezeID    string    `json:"freezeId" bson:"freezeId"`
+	ProjectID   string    `json:"projectId" bson:"projectId"`
+	Environment string    `json:"environment" bson:"environment"`
+	Action      string    `json:"action" bson:"action"`
+	Target      string    `json:"target" bson:"target"`
+	Operator    string    `json:"operator" bson:"operator"`
+	Reason      string    `json:"reason" bson:"reason"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// PromotionOverride 跳过环境晋级顺序直接创建发布单的记录
+type PromotionOverride struct {
+	ID          string    `json:"id" bson:"_id,omitempty"`
+	ReleaseID   string    `json:"releaseId" bson:"releaseId"`
+	ProjectID   string    `json:"projectId" bson:"projectId"`
+	Environment string    `json:"environment" bson:"environment"`
+	Skipped     []string  `json:"skipped" bson:"skipped"` // 被跳过的前序环境
+	Operator    string    `json:"operator" bson:"operator"`
+	Reason      string    `json:"reason" bson:"reason"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+const (
+	ApprovalActionApprove = "approve"
+	ApprovalActionReject  = "reject"
+)
+
+// Approval 审批记录, 对应设计文档 5.4 approvals 表
+type Approval struct {
+	ID        string    `json:"id" bson:"_id,omitempty"`
+	ReleaseID string    `json:"releaseId" bson:"releaseId"`
+	Level     int       `json:"level" bson:"level"`
+	Approver  string    `json:"approver" bson:"approver"`
+	Action    string    `json:"action" bson:"action"`
+	Comment   string    `json:"comment" bson:"comment"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
+
+// ApprovalPolicy 项目和环境的审批策略, ProjectID 或 Environment 为空表示匹配全部
+type ApprovalPolicy struct {
+	ID                string    `json:"id" bson:"_id,omitempty"`
+	ProjectID         string    `json:"projectId" bson:"projectId"`
+	Environment       string    `json:"environment" bson:"environment"`
+	RequiredApprovals int       `json:"requiredApprovals" bson:"requiredApprovals"`
+	CreatedAt         time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+type ApprovalStatus struct {
+	ReleaseID string      `json:"releaseId"`
+	Status    string      `json:"status"`
+	Required  int         `json:"required"`
+	Approved  int         `json:"approved"`
+	Satisfied bool        `json:"satisfied"`
+	Approvals []*Approval `json:"approvals"`
+}
+
+// MaintenanceWindow 周期性维护窗口, Weekdays 为空表示每天, 0 表示周日
+type MaintenanceWindow struct {
+	Weekdays        []int  `json:"weekdays,omitempty" bson:"weekdays,omitempty"`
+	StartTime       string `json:"startTime" bson:"startTime"`
+	DurationMinutes int    `json:"durationMinutes" bson:"durationMinutes"`
+}
+
+// DeploySchedule 发布单的定时部署计划, 指定 Window 时在下一个维护窗口开始时部署
+type DeploySchedule struct {
+	ID          string             `json:"id" bson:"_id,omitempty"`
+	ReleaseID   string             `json:"releaseId" bson:"releaseId"`
+	ProjectID   string             `json:"projectId" bson:"projectId"`
+	Environment string             `json:"environment" bson:"environment"`
+	RunAt       time.Time          `json:"runAt" bson:"runAt"`
+	Window      *MaintenanceWindow `json:"window,omitempty" bson:"window,omitempty"`
+	Status      string             `json:"status" bson:"status"`
+	Operator    string             `json:"operator" bson:"operator"`
+	LastError   string             `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	TriggeredAt *time.Time         `json:"triggeredAt,omitempty" bson:"triggeredAt,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+const (
+	JobTypeBuild       = "build"
+	JobTypeVersionBump = "version_bump"
+	JobTypeCreateMR    = "create_mr"
+	JobTypeReleaseNote = "release_notes"
+
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// Job 持久化在 MongoDB 中的异步任务, 由 JobService 领取执行
+type Job struct {
+	ID          string            `json:"id" bson:"_id,omitempty"`
+	ReleaseID   string            `json:"releaseId" bson:"releaseId"`
+	Type        string            `json:"type" bson:"type"`
+	Status      string            `json:"status" bson:"status"`
+	Payload     map[string]string `json:"payload,omitempty" bson:"payload,omitempty"`
+	Result      map[string]string `json:"result,omitempty" bson:"result,omitempty"`
+	Attempts    int               `json:"attempts" bson:"attempts"`
+	MaxAttempts int               `json:"maxAttempts" bson:"maxAttempts"`
+	LastError   string            `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	WorkerID    string            `json:"workerId,omitempty" bson:"workerId,omitempty"`
+	NextRunAt   time.Time         `json:"nextRunAt" bson:"nextRunAt"`
+	LockedUntil time.Time         `json:"lockedUntil" bson:"lockedUntil"`
+	CreatedAt   time.Time         `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt" bson:"updatedAt"`
+	FinishedAt  *time.Time        `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+}
+
+const (
+	StageBuild            = "build"
+	StageArtifactDownload = "artifact_download"
+	StageVersionBumpMR    = "version_bump_mr"
+	StageApproval         = "approval"
+	StageDeploy           = "deploy"
+	StagePostCheck        = "post_check"
+
+	StageStatusPending    = "pending"
+	StageStatusInProgress = "in_progress"
+	StageStatusCompleted  = "completed"
+	StageStatusFailed     = "failed"
+	StageStatusSkipped    = "skipped"
+)
+
+// ReleaseStageNames 发布流水线的阶段顺序
+var ReleaseStageNames = []string{
+	StageBuild,
+	StageArtifactDownload,
+	StageVersionBumpMR,
+	StageApproval,
+	StageDeploy,
+	StagePostCheck,
 }
 
 type ReleaseStage struct {
-	Name      string     `json:"name"`
-	Status    string     `json:"status"`
-	StartTime *time.Time `json:"startTime,omitempty"`
-	EndTime   *time.Time `json:"endTime,omitempty"`
+	Name      string     `json:"name" bson:"name"`
+	Status    string     `json:"status" bson:"status"`
+	StartTime *time.Time `json:"startTime,omitempty" bson:"startTime,omitempty"`
+	EndTime   *time.Time `json:"endTime,omitempty" bson:"endTime,omitempty"`
+}
+
+// DeliveryMetrics DORA 交付指标, 时长单位为小时, 没有样本时为 null
+type DeliveryMetrics struct {
+	Start              time.Time `json:"start"`
+	End                time.Time `json:"end"`
+	Deployments        int       `json:"deployments"`
+	DeploymentsPerWeek float64   `json:"deploymentsPerWeek"`
+	LeadTimeHours      *float64  `json:"leadTimeHours"`
+	Changes            int       `json:"changes"`
+	FailedChanges      int       `json:"failedChanges"`
+	ChangeFailureRate  *float64  `json:"changeFailureRate"`
+	Restores           int       `json:"restores"`
+	Unrestored         int       `json:"unrestored"`
+	TimeToRestoreHours *float64  `json:"timeToRestoreHours"`
+}
+
+type DeliveryMetricsReport struct {
+	ProjectID   string             `json:"projectId,omitempty"`
+	Environment string             `json:"environment,omitempty"`
+	Summary     DeliveryMetrics    `json:"summary"`
+	Weeks       []*DeliveryMetrics `json:"weeks"`
 }
 
 type MonitoringMetrics struct {
-	RequestRate     float64 `json:"requestRate"`
-	ErrorRate       float64 `json:"errorRate"`
-	LatencyP50      float64 `json:"latencyP50"`
-	LatencyP95      float64 `json:"latencyP95"`
-	LatencyP99      float64 `json:"latencyP99"`
-	CPUUsage        float64 `json:"cpuUsage"`
-	MemoryUsage     float64 `json:"memoryUsage"`
-	FDCount         float64 `json:"fdCount"`
-	ConnCount       float64 `json:"connCount"`
-	PacketLossRate  float64 `json:"packetLossRate"`
-	DiskUsage       float64 `json:"diskUsage"`
-	SystemLoad      float64 `json:"systemLoad"`
+	RequestRate      float64 `json:"requestRate"`
+	ErrorRate        float64 `json:"errorRate"`
+	LatencyP50       float64 `json:"latencyP50"`
+	LatencyP95       float64 `json:"latencyP95"`
+	LatencyP99       float64 `json:"latencyP99"`
+	CPUUsage         float64 `json:"cpuUsage"`
+	MemoryUsage      float64 `json:"memoryUsage"`
+	FDCount          float64 `json:"fdCount"`
+	ConnCount        float64 `json:"connCount"`
+	PacketLossRate   float64 `json:"packetLossRate"`
+	DiskUsage        float64 `json:"diskUsage"`
+	SystemLoad       float64 `json:"systemLoad"`
 	NetworkBandwidth float64 `json:"networkBandwidth"`
 }
 
@@ -202,44 +697,44 @@ type GrayReleaseStrategy struct {
 }
 
 type GrayReleaseConfig struct {
-	ID           string                  `json:"id" bson:"_id,omitempty"`
-	ConfigID     string                  `json:"configId" bson:"configId"`
-	ProjectID    string                  `json:"projectId" bson:"projectId"`
-	ProjectName  string                  `json:"projectName" bson:"projectName"`
-	Environment  string                  `json:"environment" bson:"environment"`
-	Version      string                  `json:"version" bson:"version"`
-	Rules        []GrayReleaseRule       `json:"rules" bson:"rules"`
-	StrategyType string                  `json:"strategyType,omitempty" bson:"strategyType,omitempty"`
-	Strategies   []GrayReleaseStrategy   `json:"strategies,omitempty" bson:"strategies,omitempty"`
-	RuleLogic    string                  `json:"ruleLogic,omitempty" bson:"ruleLogic,omitempty"`
-	Stage        int                     `json:"stage,omitempty" bson:"stage,omitempty"`
-	Status       string                  `json:"status" bson:"status"`
-	Operator     string                  `json:"operator" bson:"operator"`
-	Description  string                  `json:"description" bson:"description"`
-	CreatedAt    time.Time               `json:"createdAt" bson:"createdAt"`
-	UpdatedAt    time.Time               `json:"updatedAt" bson:"updatedAt"`
+	ID           string                `json:"id" bson:"_id,omitempty"`
+	ConfigID     string                `json:"configId" bson:"configId"`
+	ProjectID    string                `json:"projectId" bson:"projectId"`
+	ProjectName  string                `json:"projectName" bson:"projectName"`
+	Environment  string                `json:"environment" bson:"environment"`
+	Version      string                `json:"version" bson:"version"`
+	Rules        []GrayReleaseRule     `json:"rules" bson:"rules"`
+	StrategyType string                `json:"strategyType,omitempty" bson:"strategyType,omitempty"`
+	Strategies   []GrayReleaseStrategy `json:"strategies,omitempty" bson:"strategies,omitempty"`
+	RuleLogic    string                `json:"ruleLogic,omitempty" bson:"ruleLogic,omitempty"`
+	Stage        int                   `json:"stage,omitempty" bson:"stage,omitempty"`
+	Status       string                `json:"status" bson:"status"`
+	Operator     string                `json:"operator" bson:"operator"`
+	Description  string                `json:"description" bson:"description"`
+	CreatedAt    time.Time             `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time             `json:"updatedAt" bson:"updatedAt"`
 }
 
 type DeviceGrayStatus struct {
-	ID           string    `json:"id" bson:"_id,omitempty"`
-	NodeID       string    `json:"nodeId" bson:"nodeId"`
-	NodeName     string    `json:"nodeName" bson:"nodeName"`
-	ProjectID    string    `json:"projectId" bson:"projectId"`
-	ProjectName  string    `json:"projectName" bson:"projectName"`
-	Environment  string    `json:"environment" bson:"environment"`
-	CurrentVersion string  `json:"currentVersion" bson:"currentVersion"`
-	ISP          string    `json:"isp" bson:"isp"`
-	Region       string    `json:"region" bson:"region"`
-	Province     string    `json:"province" bson:"province"`
-	DataCenter   string    `json:"dataCenter" bson:"dataCenter"`
-	Status       string    `json:"status" bson:"status"`
-	UpdatedAt    time.Time `json:"updatedAt" bson:"updatedAt"`
+	ID             string    `json:"id" bson:"_id,omitempty"`
+	NodeID         string    `json:"nodeId" bson:"nodeId"`
+	NodeName       string    `json:"nodeName" bson:"nodeName"`
+	ProjectID      string    `json:"projectId" bson:"projectId"`
+	ProjectName    string    `json:"projectName" bson:"projectName"`
+	Environment    string    `json:"environment" bson:"environment"`
+	CurrentVersion string    `json:"currentVersion" bson:"currentVersion"`
+	ISP            string    `json:"isp" bson:"isp"`
+	Region         string    `json:"region" bson:"region"`
+	Province       string    `json:"province" bson:"province"`
+	DataCenter     string    `json:"dataCenter" bson:"dataCenter"`
+	Status         string    `json:"status" bson:"status"`
+	UpdatedAt      time.Time `json:"updatedAt" bson:"updatedAt"`
 }
 
 type GrayReleaseStats struct {
-	Version      string            `json:"version"`
-	DeviceCount  int               `json:"deviceCount"`
-	ByDimension  map[string]int    `json:"byDimension"`
+	Version     string         `json:"version"`
+	DeviceCount int            `json:"deviceCount"`
+	ByDimension map[string]int `json:"byDimension"`
 }
 
 type Machine struct {
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ApplicationService struct {
+	collection *mongo.Collection
+}
+
+func NewApplicationService(mongodb *db.MongoDB) *ApplicationService {
+	return &ApplicationService{
+		collection: mongodb.Database.Collection("applications"),
+	}
+}
+
+// List projectID 为空时返回全部应用
+func (s *ApplicationService) List(projectID string) ([]*model.Application, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if projectID != "" {
+		filter["projectId"] = projectID
+	}
+
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	applications := []*model.Application{}
+	if err = cursor.All(ctx, &applications); err != nil {
+		return nil, err
+	}
+
+	return applications, nil
+}
+
+func (s *ApplicationService) Get(id string) (*model.Application, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var application model.Application
+	if err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&application); err != nil {
+		return nil, err
+	}
+
+	return &application, nil
+}
+
+func (s *ApplicationService) Create(application *model.Application) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if application.ID == "" {
+		application.ID = primitive.NewObjectID().Hex()
+	}
+	application.CreatedAt = time.Now()
+	application.UpdatedAt = time.Now()
+
+	_, err := s.collection.InsertOne(ctx, application)
+	return err
+}
+
+func (s *ApplicationService) Update(id string, application *model.Application) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id}
+	update := bson.M{"$set": bson.M{
+		"projectId":      application.ProjectID,
+		"name":           application.Name,
+		"code":           application.Code,
+		"description":    application.Description,
+		"healthCheckUrl": application.HealthCheckURL,
+		"updatedAt":      time.Now(),
+	}}
+
+	_, err := s.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+func (s *ApplicationService) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
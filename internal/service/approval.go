@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrApproverRequired = errors.New("approver is required")
+	ErrSelfApproval     = errors.New("requester cannot approve their own release")
+	ErrNoRequester      = errors.New("release has no authenticated requester and cannot be approved")
+	ErrAlreadyApproved  = errors.New("approver has already approved this release")
+	ErrInvalidAction    = errors.New("action must be approve or reject")
+)
+
+const defaultRequiredApprovals = 1
+
+// ApprovalService 按项目和环境的审批策略收集审批, 通过人数满足策略后发布单才流转到 approved
+type ApprovalService struct {
+	approvals *mongo.Collection
+	policies  *mongo.Collection
+	releases  *ReleaseService
+}
+
+func NewApprovalService(mongodb *db.MongoDB, releases *ReleaseService) *ApprovalService {
+	return &ApprovalService{
+		approvals: mongodb.Database.Collection("approvals"),
+		policies:  mongodb.Database.Collection("approval_policies"),
+		releases:  releases,
+	}
+}
+
+// Submit 提交一次审批, 通过人数达到策略要求时发布单流转到 approved, 任一拒绝则发布单失败.
+// approver 为认证的用户, 同一审批人的通过记录以 releaseId/approver 作为 _id, 并发重复提交时只有一次成功
+func (s *ApprovalService) Submit(releaseID, approver, action, comment string) (*model.ApprovalStatus, error) {
+	if approver == "" {
+		return nil, ErrApproverRequired
+	}
+	if action != model.ApprovalActionApprove && action != model.ApprovalActionReject {
+		return nil, ErrInvalidAction
+	}
+
+	release, err := s.releases.Get(releaseID)
+	if err != nil {
+		return nil, err
+	}
+	if release.Status != model.ReleaseStatusPendingApproval {
+		return nil, fmt.Errorf("%w: release %s is %q, not pending approval", ErrInvalidTransition, releaseID, release.Status)
+	}
+	if action == model.ApprovalActionApprove {
+		// 没有认证的发起人时无法排除自审, 不允许通过
+		if release.CreatedBy == "" {
+			return nil, ErrNoRequester
+		}
+		if approver == release.CreatedBy {
+			return nil, ErrSelfApproval
+		}
+	}
+
+	approvals, err := s.List(releaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	approval := &model.Approval{
+		ID:        primitive.NewObjectID().Hex(),
+		ReleaseID: releaseID,
+		Level:     approvedCount(approvals) + 1,
+		Approver:  approver,
+		Action:    action,
+		Comment:   comment,
+		CreatedAt: time.Now(),
+	}
+	if action == model.ApprovalActionApprove {
+		approval.ID = releaseID + "/" + approver
+	}
+	_, err = s.approvals.InsertOne(ctx, approval)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrAlreadyApproved
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("releaseId", releaseID).Str("approver", approver).Str("action", action).Msg("已记录审批")
+
+	if action == model.ApprovalActionReject {
+		reason := fmt.Sprintf("%s 审批拒绝: %s", approver, comment)
+		if err := s.releases.Fail(releaseID, approver, reason); err != nil {
+			return nil, err
+		}
+		return s.Status(releaseID)
+	}
+
+	// 插入后重新统计, 并发审批时以数据库中的记录为准
+	approvals, err = s.List(releaseID)
+	if err != nil {
+		return nil, err
+	}
+	required := s.requiredApprovals(release.ProjectID, release.Environment)
+	if approvedCount(approvals) >= required {
+		err := s.releases.Approve(releaseID, approver, comment)
+		// 并发审批时可能已被其他审批人流转
+		if err != nil && !errors.Is(err, ErrInvalidTransition) {
+			return nil, err
+		}
+	}
+
+	return s.Status(releaseID)
+}
+
+func (s *ApprovalService) List(releaseID string) ([]*model.Approval, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.approvals.Find(ctx, bson.M{"releaseId": releaseID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	approvals := []*model.Approval{}
+	if err = cursor.All(ctx, &approvals); err != nil {
+		return nil, err
+	}
+
+	return approvals, nil
+}
+
+func (s *ApprovalService) Status(releaseID string) (*model.ApprovalStatus, error) {
+	release, err := s.releases.Get(releaseID)
+	if err != nil {
+		return nil, err
+	}
+	approvals, err := s.List(releaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	required := s.requiredApprovals(release.ProjectID, release.Environment)
+	approved := approvedCount(approvals)
+	return &model.ApprovalStatus{
+		ReleaseID: releaseID,
+		Status:    release.Status,
+		Required:  required,
+		Approved:  approved,
+		Satisfied: approved >= required,
+		Approvals: approvals,
+	}, nil
+}
+
+// approvedCount 统计不同审批人的通过数
+func approvedCount(approvals []*model.Approval) int {
+	approvers := make(map[string]bool, len(approvals))
+	for _, a := range approvals {
+		if a.Action == model.ApprovalActionApprove {
+			approvers[a.Approver] = true
+		}
+	}
+	return len(approvers)
+}
+
+// requiredApprovals 依次匹配 项目+环境、项目、环境 的策略, 都没有时需要 1 人审批
+func (s *ApprovalService) requiredApprovals(projectID, environment string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	candidates := []bson.M{
+		{"projectId": projectID, "environment": environment},
+		{"projectId": projectID, "environment": ""},
+		{"projectId": "", "environment": environment},
+	}
+	for _, filter := range candidates {
+		var policy model.ApprovalPolicy
+		err := s.policies.FindOne(ctx, filter).Decode(&policy)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Str("projectId", projectID).Str("environment", environment).Msg("查询审批策略失败")
+			break
+		}
+		if policy.RequiredApprovals > 0 {
+			return policy.RequiredApprovals
+		}
+	}
+	return defaultRequiredApprovals
+}
+
+func (s *ApprovalService) ListPolicies() ([]*model.ApprovalPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.policies.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	policies := []*model.ApprovalPolicy{}
+	if err = cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
+
+// SavePolicy 按项目和环境创建或更新审批策略
+func (s *ApprovalService) SavePolicy(policy *model.ApprovalPolicy) (*model.ApprovalPolicy, error) {
+	if policy.RequiredApprovals <= 0 {
+		return nil, fmt.Errorf("requiredApprovals must be positive")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{"projectId": policy.ProjectID, "environment": policy.Environment}
+	update := bson.M{
+		"$set": bson.M{
+			"requiredApprovals": policy.RequiredApprovals,
+			"updatedAt":         now,
+		},
+		"$setOnInsert": bson.M{
+			"_id":       primitive.NewObjectID().Hex(),
+			"createdAt": now,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var saved model.ApprovalPolicy
+	if err := s.policies.FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved); err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+func (s *ApprovalService) DeletePolicy(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.policies.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,650 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/felix-001/qnHackathon/internal/config"
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrArtifactNotFound   = errors.New("artifact not found")
+	ErrArtifactAmbiguous  = errors.New("artifact version is ambiguous without projectId")
+	ErrNoPlatformArtifact = errors.New("no artifact for node platform")
+
+	digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// ArtifactStore 构建产物仓库: 文件按 sha256 保存在 <dir>/blobs/sha256/<前两位>/<digest>,
+// 每个版本的元数据保存在 artifacts 集合, 相同内容的版本共用一份文件.
+// 清理时保留每个项目环境最近 RetainReleases 个发布单和未结束的发布单引用的产物, 以及 MinAgeHours 内新入库的产物
+type ArtifactStore struct {
+	collection *mongo.Collection
+	releases   *mongo.Collection
+	conf       cfg.ArtifactConf
+	signer     *artifactSigner
+	blobMu     sync.Mutex
+}
+
+func NewArtifactStore(mongodb *db.MongoDB, conf cfg.ArtifactConf) *ArtifactStore {
+	if conf.Dir == "" {
+		conf.Dir = "artifacts"
+	}
+	if conf.RetainReleases <= 0 {
+		conf.RetainReleases = 10
+	}
+	if conf.MinAgeHours <= 0 {
+		conf.MinAgeHours = 7 * 24
+	}
+	if conf.GCIntervalMinutes <= 0 {
+		conf.GCIntervalMinutes = 60
+	}
+	if conf.SigningKeyDir == "" {
+		conf.SigningKeyDir = filepath.Join(conf.Dir, "keys")
+	}
+	return &ArtifactStore{
+		collection: mongodb.Database.Collection("artifacts"),
+		releases:   mongodb.Database.Collection("releases"),
+		conf:       conf,
+	}
+}
+
+// LoadSigningKeys 加载产物签名密钥, 目录中没有私钥时生成一个, 之后入库的产物都会签名
+func (s *ArtifactStore) LoadSigningKeys() error {
+	signer, err := newArtifactSigner(s.conf.SigningKeyDir)
+	if err != nil {
+		return err
+	}
+	s.signer = signer
+	return nil
+}
+
+// TempDir 发布单的构建产物先下载到该目录, 与仓库在同一文件系统, 入库时直接移动; s 为 nil 时为 downloads 目录
+func (s *ArtifactStore) TempDir(releaseID string) string {
+	if s == nil {
+		return downloadDir
+	}
+	return filepath.Join(s.conf.Dir, "tmp", filepath.Base(releaseID))
+}
+
+func (s *ArtifactStore) blobPath(digest string) string {
+	return filepath.Join(s.conf.Dir, "blobs", "sha256", digest[:2], digest)
+}
+
+// Put 将文件移入仓库并保存元数据, artifact 中的 ProjectID、Version、平台、Group、BuildID 由调用方填写.
+// 同一项目同一版本同一内容重复入库时只追加引用的发布单
+func (s *ArtifactStore) Put(file string, artifact *model.Artifact, releaseID string) (*model.Artifact, error) {
+	digest, err := fileSHA256(file)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	// 与 sweepBlobs 互斥, 文件和元数据都写入后才允许清理
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+
+	blob := s.blobPath(digest)
+	now := time.Now()
+	if err := os.Chtimes(blob, now, now); err == nil {
+		// 已有相同内容的文件: 更新修改时间, 其他实例清理时按 MinAgeHours 跳过该文件
+		os.Remove(file)
+	} else if os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(file, blob); err != nil {
+			return nil, fmt.Errorf("failed to move artifact into store: %w", err)
+		}
+	} else {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"projectId": artifact.ProjectID, "version": artifact.Version, "digest": digest}
+	update := bson.M{
+		"$setOnInsert": bson.M{
+			"_id":       primitive.NewObjectID().Hex(),
+			"createdAt": time.Now(),
+		},
+		"$set": bson.M{
+			"size":      info.Size(),
+			"os":        artifact.OS,
+			"arch":      artifact.Arch,
+			"osRelease": artifact.OSRelease,
+			"group":     artifact.Group,
+			"buildId":   artifact.BuildID,
+		},
+	}
+	if releaseID != "" {
+		update["$addToSet"] = bson.M{"releases": releaseID}
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var stored model.Artifact
+	if err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&stored); err != nil {
+		return nil, err
+	}
+	if err := s.sign(ctx, &stored); err != nil {
+		return nil, fmt.Errorf("failed to sign artifact %s: %w", stored.Version, err)
+	}
+	log.Info().Str("version", stored.Version).Str("digest", digest).Int64("size", stored.Size).Msg("产物已入库")
+	return &stored, nil
+}
+
+// sign 用当前密钥签名产物, 已有当前密钥的签名时跳过
+func (s *ArtifactStore) sign(ctx context.Context, artifact *model.Artifact) error {
+	if s.signer == nil {
+		return nil
+	}
+	active := s.signer.ActiveKeyID()
+	for _, signature := range artifact.Signatures {
+		if signature.KeyID == active {
+			return nil
+		}
+	}
+
+	signature, err := s.signer.Sign(artifact.Digest)
+	if err != nil {
+		return err
+	}
+	filter := bson.M{"_id": artifact.ID, "signatures.keyId": bson.M{"$ne": signature.KeyID}}
+	if _, err := s.collection.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"signatures": signature}}); err != nil {
+		return err
+	}
+	artifact.Signatures = append(artifact.Signatures, *signature)
+	return nil
+}
+
+// Signature 返回产物由受信任密钥签发的签名, 优先返回当前密钥的签名; ref 为版本时需指定项目
+func (s *ArtifactStore) Signature(projectID, ref string) (*model.Artifact, *model.ArtifactSignature, error) {
+	if s == nil || s.signer == nil {
+		return nil, nil, ErrArtifactNotSigned
+	}
+	artifact, err := s.Get(projectID, ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var trusted *model.ArtifactSignature
+	for i := range artifact.Signatures {
+		signature := &artifact.Signatures[i]
+		if !s.signer.Verify(artifact.Digest, signature) {
+			continue
+		}
+		if trusted == nil || signature.KeyID == s.signer.ActiveKeyID() {
+			trusted = signature
+		}
+	}
+	if trusted == nil {
+		return artifact, nil, fmt.Errorf("%w: %s", ErrArtifactNotSigned, ref)
+	}
+	return artifact, trusted, nil
+}
+
+// SigningKeys 返回受信任的签名公钥
+func (s *ArtifactStore) SigningKeys() []*model.SigningKey {
+	if s.signer == nil {
+		return []*model.SigningKey{}
+	}
+	return s.signer.Keys()
+}
+
+// RotateSigningKey 生成新的签名密钥, 之后入库的产物使用新密钥签名, 旧密钥签发的签名在移除旧密钥前仍然有效
+func (s *ArtifactStore) RotateSigningKey() (*model.SigningKey, error) {
+	if s.signer == nil {
+		return nil, fmt.Errorf("%w: signing is not enabled", ErrSigningKeyNotFound)
+	}
+	key, err := s.signer.Rotate()
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("keyId", key.ID).Msg("产物签名密钥已轮换")
+	return key, nil
+}
+
+// RetireSigningKey 移除签名密钥: 先用当前密钥重新签名只有该密钥签名的产物, 再删除该密钥的签名和密钥文件.
+// 返回重新签名的产物数
+func (s *ArtifactStore) RetireSigningKey(id string) (int, error) {
+	if s.signer == nil {
+		return 0, fmt.Errorf("%w: signing is not enabled", ErrSigningKeyNotFound)
+	}
+	if id == s.signer.ActiveKeyID() {
+		return 0, fmt.Errorf("%w: %s, rotate before retiring it", ErrSigningKeyActive, id)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"signatures.keyId": id})
+	if err != nil {
+		return 0, err
+	}
+	var artifacts []*model.Artifact
+	if err = cursor.All(ctx, &artifacts); err != nil {
+		return 0, err
+	}
+
+	resigned := 0
+	for _, artifact := range artifacts {
+		if err := s.sign(ctx, artifact); err != nil {
+			return resigned, err
+		}
+		if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": artifact.ID}, bson.M{"$pull": bson.M{"signatures": bson.M{"keyId": id}}}); err != nil {
+			return resigned, err
+		}
+		resigned++
+	}
+
+	if err := s.signer.Retire(id); err != nil {
+		return resigned, err
+	}
+	log.Info().Str("keyId", id).Int("resigned", resigned).Msg("产物签名密钥已移除")
+	return resigned, nil
+}
+
+// Reference 记录发布单引用了项目中的产物及其多平台产物, 晋级、回滚和命中构建缓存复用产物时调用.
+// 有 sha256 时按 sha256 查找, 否则取该版本最新入库的
+func (s *ArtifactStore) Reference(projectID, version, digest, releaseID string) error {
+	if s == nil {
+		return nil
+	}
+	artifact, err := s.find(projectID, version, digest)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	filter := bson.M{"$or": []bson.M{{"_id": artifact.ID}, {"projectId": artifact.ProjectID, "group": artifact.Version}}}
+	_, err = s.collection.UpdateMany(ctx, filter, bson.M{"$addToSet": bson.M{"releases": releaseID}})
+	return err
+}
+
+// SelectVariant 按节点上报的 CPU 架构和发行版从发布单的多平台产物中选择, 第一个为主产物.
+// 没有平台信息的产物所有节点通用; 节点平台未知或发布单没有多平台产物时返回 nil (使用主产物), 没有节点平台的产物时返回 ErrNoPlatformArtifact
+func SelectVariant(variants []model.ArtifactVariant, cpuArch, osRelease string) (*model.ArtifactVariant, error) {
+	if len(variants) == 0 || cpuArch == "" {
+		return nil, nil
+	}
+
+	arch, nodeOS := normalizeArch(cpuArch), osFromRelease(osRelease)
+	var matched *model.ArtifactVariant
+	var available []string
+	for i := range variants {
+		variant := &variants[i]
+		if variant.Arch == "" {
+			if matched == nil {
+				matched = variant
+			}
+			continue
+		}
+		name := platformName(platformOS(variant.OS), normalizeArch(variant.Arch), variant.OSRelease)
+		if indexOf(available, name) < 0 {
+			available = append(available, name)
+		}
+		if normalizeArch(variant.Arch) != arch || (nodeOS != "" && platformOS(variant.OS) != nodeOS) {
+			continue
+		}
+		if variant.OSRelease != "" && !strings.HasPrefix(strings.ToLower(osRelease), strings.ToLower(variant.OSRelease)) {
+			continue
+		}
+		// 指定架构的产物优先于通用产物, 指定发行版的优先于不限发行版的
+		if matched == nil || matched.Arch == "" || (matched.OSRelease == "" && variant.OSRelease != "") {
+			matched = variant
+		}
+	}
+	if matched == nil {
+		return nil, fmt.Errorf("%w: %s has no artifact for %s (%s), available: %s",
+			ErrNoPlatformArtifact, variants[0].Version, platformName(nodeOS, arch, ""), osRelease, strings.Join(available, ", "))
+	}
+	return matched, nil
+}
+
+// Get 按 sha256 (可带 sha256: 前缀) 或版本查找产物, projectID 不为空时只查该项目; 版本名在项目之间可能重复, 按版本查找时必须指定项目
+func (s *ArtifactStore) Get(projectID, ref string) (*model.Artifact, error) {
+	if digest := strings.TrimPrefix(ref, "sha256:"); digestPattern.MatchString(digest) {
+		return s.find(projectID, "", digest)
+	}
+	if projectID == "" {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactAmbiguous, ref)
+	}
+	return s.find(projectID, ref, "")
+}
+
+// find 有 sha256 时按 sha256 查找, 否则按项目内的版本查找, 同一版本有多个时返回最新入库的
+func (s *ArtifactStore) find(projectID, version, digest string) (*model.Artifact, error) {
+	filter := bson.M{}
+	if projectID != "" {
+		filter["projectId"] = projectID
+	}
+	ref := version
+	switch {
+	case digest != "":
+		filter["digest"] = digest
+		ref = digest
+	case projectID != "" && version != "":
+		filter["version"] = version
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrArtifactAmbiguous, version)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	var artifact model.Artifact
+	err := s.collection.FindOne(ctx, filter, opts).Decode(&artifact)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+// List 按入库时间倒序返回产物, projectID 为空时不过滤
+func (s *ArtifactStore) List(projectID string) ([]*model.Artifact, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if projectID != "" {
+		filter["projectId"] = projectID
+	}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	artifacts := []*model.Artifact{}
+	if err = cursor.All(ctx, &artifacts); err != nil {
+		return nil, err
+	}
+	return artifacts, nil
+}
+
+// Resolve 返回项目中产物的文件路径和 sha256, 有 sha256 (发布单的 artifactSha256 或 artifacts[].digest) 时按 sha256 查找,
+// 否则按版本查找. 仓库中没有时回退到 downloads 目录下与版本同名的文件, 兼容产物仓库之前下载的版本, 指定了 sha256 时校验内容;
+// 未指定项目和 sha256 或 s 为 nil 时只查 downloads 目录
+func (s *ArtifactStore) Resolve(projectID, version, digest string) (path string, sum string, err error) {
+	if s != nil && (projectID != "" || digest != "") {
+		artifact, err := s.find(projectID, version, digest)
+		if err == nil {
+			path = s.blobPath(artifact.Digest)
+			if _, err := os.Stat(path); err != nil {
+				return "", "", fmt.Errorf("blob of artifact %s is missing: %w", artifact.Version, err)
+			}
+			return path, artifact.Digest, nil
+		}
+		if !errors.Is(err, ErrArtifactNotFound) {
+			return "", "", err
+		}
+	}
+
+	if version == "" {
+		return "", "", fmt.Errorf("%w: %s", ErrArtifactNotFound, digest)
+	}
+	path = filepath.Join(downloadDir, filepath.Base(version))
+	sum, err = fileSHA256(path)
+	if os.IsNotExist(err) {
+		return "", "", fmt.Errorf("%w: %s", ErrArtifactNotFound, version)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if digest != "" && sum != digest {
+		return "", "", fmt.Errorf("%w: %s with sha256 %s", ErrArtifactNotFound, version, digest)
+	}
+	return path, sum, nil
+}
+
+// releaseArtifact 发布单写入版本文件的产物名和 sha256, 构建时未记录 artifactSha256 的发布单取主产物的 sha256
+func releaseArtifact(release *model.Release) (version, digest string) {
+	version = release.ArtifactVersion
+	if version == "" {
+		version = release.TarFileName
+	}
+	digest = release.ArtifactSHA256
+	if digest == "" && len(release.Artifacts) > 0 {
+		digest = release.Artifacts[0].Digest
+	}
+	return version, digest
+}
+
+// Start 定期清理不再被近期发布单引用的产物
+func (s *ArtifactStore) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Duration(s.conf.GCIntervalMinutes) * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := s.GC(); err != nil {
+					log.Error().Err(err).Msg("清理产物失败")
+				}
+			}
+		}
+	}()
+}
+
+// retainedReleases 返回需要保留产物的发布单及其产物版本 (<项目>/<版本>), 见 retainReleases
+func (s *ArtifactStore) retainedReleases(ctx context.Context) (releaseIDs map[string]bool, versions map[string]bool, err error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}}).
+		SetProjection(bson.M{"_id": 1, "projectId": 1, "environment": 1, "status": 1, "artifactVersion": 1})
+	cursor, err := s.releases.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var releases []*model.Release
+	if err = cursor.All(ctx, &releases); err != nil {
+		return nil, nil, err
+	}
+
+	releaseIDs, versions = retainReleases(releases, s.conf.RetainReleases)
+	return releaseIDs, versions, nil
+}
+
+// retainReleases 按创建时间倒序的发布单中, 每个项目环境保留最近 n 个已完成的 (至少保留最新的一个, 回滚时需要)
+// 以及所有未结束的; 失败和已回滚的发布单不计入 n, 否则连续失败后已完成的产物会被清理
+func retainReleases(releases []*model.Release, n int) (releaseIDs map[string]bool, versions map[string]bool) {
+	if n < 1 {
+		n = 1
+	}
+	releaseIDs = make(map[string]bool)
+	versions = make(map[string]bool)
+	completed := make(map[string]int)
+	for _, release := range releases {
+		key := release.ProjectID + "/" + release.Environment
+		retain := !isTerminalStatus(release.Status)
+		if release.Status == model.ReleaseStatusCompleted {
+			retain = completed[key] < n
+			completed[key]++
+		}
+		if !retain {
+			continue
+		}
+		releaseIDs[release.ID] = true
+		if release.ArtifactVersion != "" {
+			versions[release.ProjectID+"/"+release.ArtifactVersion] = true
+		}
+	}
+	return releaseIDs, versions
+}
+
+// GC 删除不再被保留的发布单引用 (按 releases 或发布单的 artifactVersion) 且超过 MinAgeHours 的产物元数据,
+// 再删除没有元数据引用的文件
+func (s *ArtifactStore) GC() (*model.ArtifactGCResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	retained, versions, err := s.retainedReleases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	minAge := time.Now().Add(-time.Duration(s.conf.MinAgeHours) * time.Hour)
+	cursor, err := s.collection.Find(ctx, bson.M{"createdAt": bson.M{"$lt": minAge}})
+	if err != nil {
+		return nil, err
+	}
+	var candidates []*model.Artifact
+	if err = cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	result := &model.ArtifactGCResult{}
+	for _, artifact := range candidates {
+		referenced := versions[artifact.ProjectID+"/"+artifact.Version] || (artifact.Group != "" && versions[artifact.ProjectID+"/"+artifact.Group])
+		for _, releaseID := range artifact.Releases {
+			if retained[releaseID] {
+				referenced = true
+				break
+			}
+		}
+		if referenced {
+			continue
+		}
+		if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": artifact.ID}); err != nil {
+			return result, err
+		}
+		result.Artifacts++
+		result.Versions = append(result.Versions, artifact.Version)
+	}
+	sort.Strings(result.Versions)
+
+	if err := s.sweepBlobs(ctx, minAge, result); err != nil {
+		return result, err
+	}
+	log.Info().Int("artifacts", result.Artifacts).Int("blobs", result.Blobs).Int64("freedBytes", result.FreedBytes).Msg("产物清理完成")
+	return result, nil
+}
+
+// sweepBlobs 删除没有元数据引用的文件, 只删除 minAge 之前写入的, 避免和其他实例正在入库的产物冲突
+func (s *ArtifactStore) sweepBlobs(ctx context.Context, minAge time.Time, result *model.ArtifactGCResult) error {
+	s.blobMu.Lock()
+	defer s.blobMu.Unlock()
+
+	digests, err := s.collection.Distinct(ctx, "digest", bson.M{})
+	if err != nil {
+		return err
+	}
+	used := make(map[string]bool, len(digests))
+	for _, digest := range digests {
+		if d, ok := digest.(string); ok {
+			used[d] = true
+		}
+	}
+
+	root := filepath.Join(s.conf.Dir, "blobs", "sha256")
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if used[info.Name()] || info.ModTime().After(minAge) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		result.Blobs++
+		result.FreedBytes += info.Size()
+		return nil
+	})
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// normalizeArch 统一节点上报的 uname -m 和 GOARCH 两种架构写法
+func normalizeArch(arch string) string {
+	arch = strings.ToLower(strings.TrimSpace(arch))
+	switch {
+	case arch == "x86_64" || arch == "x64":
+		return "amd64"
+	case arch == "aarch64" || strings.HasPrefix(arch, "armv8"):
+		return "arm64"
+	case strings.HasPrefix(arch, "armv") || arch == "armhf":
+		return "arm"
+	case arch == "i386" || arch == "i686":
+		return "386"
+	}
+	return arch
+}
+
+// platformOS 产物的 OS, 未填写时为 linux
+func platformOS(os string) string {
+	if os == "" {
+		return "linux"
+	}
+	return strings.ToLower(os)
+}
+
+// osFromRelease 从节点上报的发行版 (os-release 的 PRETTY_NAME 或 uname -s) 推断 OS
+func osFromRelease(osRelease string) string {
+	release := strings.ToLower(osRelease)
+	switch {
+	case release == "":
+		return ""
+	case strings.Contains(release, "darwin") || strings.Contains(release, "mac"):
+		return "darwin"
+	case strings.Contains(release, "windows"):
+		return "windows"
+	case strings.Contains(release, "freebsd"):
+		return "freebsd"
+	}
+	return "linux"
+}
+
+func platformName(os, arch, osRelease string) string {
+	name := os + "/" + arch
+	if osRelease != "" {
+		name += " " + osRelease
+	}
+	return name
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+)
+
+func TestReleaseArtifact(t *testing.T) {
+	tests := []struct {
+		name        string
+		release     *model.Release
+		wantVersion string
+		wantDigest  string
+	}{
+		{
+			name:        "artifact sha256 recorded at build time",
+			release:     &model.Release{ArtifactVersion: "streamd-v1", TarFileName: "streamd.tar.gz", ArtifactSHA256: "aaa"},
+			wantVersion: "streamd-v1",
+			wantDigest:  "aaa",
+		},
+		{
+			name: "primary variant digest when artifactSha256 is missing",
+			release: &model.Release{ArtifactVersion: "streamd-linux-amd64", Artifacts: []model.ArtifactVariant{
+				{Arch: "amd64", Version: "streamd-linux-amd64", Digest: "bbb"},
+				{Arch: "arm64", Version: "streamd-linux-arm64", Digest: "ccc"},
+			}},
+			wantVersion: "streamd-linux-amd64",
+			wantDigest:  "bbb",
+		},
+		{
+			name:        "legacy release with only a tar file name",
+			release:     &model.Release{TarFileName: "streamd.tar.gz"},
+			wantVersion: "streamd.tar.gz",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, digest := releaseArtifact(tt.release)
+			if version != tt.wantVersion || digest != tt.wantDigest {
+				t.Fatalf("releaseArtifact() = %q, %q, want %q, %q", version, digest, tt.wantVersion, tt.wantDigest)
+			}
+		})
+	}
+}
+
+// TestArtifactGetRequiresProject 版本名在项目之间可能重复, 不指定项目时不能按版本查找
+func TestArtifactGetRequiresProject(t *testing.T) {
+	store := &ArtifactStore{}
+	if _, err := store.Get("", "streamd-v1"); !errors.Is(err, ErrArtifactAmbiguous) {
+		t.Fatalf("Get without projectId: err = %v, want %v", err, ErrArtifactAmbiguous)
+	}
+	if _, err := store.find("", "streamd-v1", ""); !errors.Is(err, ErrArtifactAmbiguous) {
+		t.Fatalf("find without projectId and digest: err = %v, want %v", err, ErrArtifactAmbiguous)
+	}
+}
+
+func TestSelectVariant(t *testing.T) {
+	variants := []model.ArtifactVariant{
+		{OS: "linux", Arch: "amd64", Version: "streamd-linux-amd64", Digest: "d1"},
+		{OS: "linux", Arch: "arm64", Version: "streamd-linux-arm64", Digest: "d2"},
+		{OS: "linux", Arch: "amd64", OSRelease: "CentOS Linux 7", Version: "streamd-centos7-amd64", Digest: "d3"},
+	}
+
+	tests := []struct {
+		name      string
+		variants  []model.ArtifactVariant
+		cpuArch   string
+		osRelease string
+		want      string
+		wantErr   error
+	}{
+		{name: "no variants", cpuArch: "x86_64", want: ""},
+		{name: "platform unknown", variants: variants, want: ""},
+		{name: "uname arch", variants: variants, cpuArch: "aarch64", osRelease: "Ubuntu 22.04.4 LTS", want: "d2"},
+		{name: "os release prefix preferred", variants: variants, cpuArch: "x86_64", osRelease: "CentOS Linux 7 (Core)", want: "d3"},
+		{name: "other release falls back to arch", variants: variants, cpuArch: "x86_64", osRelease: "Ubuntu 22.04.4 LTS", want: "d1"},
+		{name: "generic variant", variants: []model.ArtifactVariant{{Version: "streamd", Digest: "d4"}}, cpuArch: "riscv64", want: "d4"},
+		{name: "no artifact for platform", variants: variants, cpuArch: "riscv64", osRelease: "Ubuntu", wantErr: ErrNoPlatformArtifact},
+		{name: "other os", variants: variants, cpuArch: "arm64", osRelease: "Darwin", wantErr: ErrNoPlatformArtifact},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variant, err := SelectVariant(tt.variants, tt.cpuArch, tt.osRelease)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SelectVariant() err = %v, want %v", err, tt.wantErr)
+			}
+			got := ""
+			if variant != nil {
+				got = variant.Digest
+			}
+			if got != tt.want {
+				t.Fatalf("SelectVariant() digest = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetainReleases(t *testing.T) {
+	// 按创建时间倒序
+	releases := []*model.Release{
+		{ID: "p1-9", ProjectID: "p1", Environment: "prod", Status: model.ReleaseStatusFailed, ArtifactVersion: "v9"},
+		{ID: "p1-8", ProjectID: "p1", Environment: "prod", Status: model.ReleaseStatusRolledBack, ArtifactVersion: "v8"},
+		{ID: "p1-7", ProjectID: "p1", Environment: "prod", Status: model.ReleaseStatusDeploying, ArtifactVersion: "v7"},
+		{ID: "p1-6", ProjectID: "p1", Environment: "prod", Status: model.ReleaseStatusFailed, ArtifactVersion: "v6"},
+		{ID: "p1-5", ProjectID: "p1", Environment: "prod", Status: model.ReleaseStatusCompleted, ArtifactVersion: "v5"},
+		{ID: "p1-4", ProjectID: "p1", Environment: "prod", Status: model.ReleaseStatusCompleted, ArtifactVersion: "v4"},
+		{ID: "p1-3", ProjectID: "p1", Environment: "prod", Status: model.ReleaseStatusCompleted, ArtifactVersion: "v3"},
+		{ID: "p1-test", ProjectID: "p1", Environment: "test", Status: model.ReleaseStatusCompleted, ArtifactVersion: "v2"},
+		{ID: "p2-1", ProjectID: "p2", Environment: "prod", Status: model.ReleaseStatusCompleted, ArtifactVersion: "v5"},
+	}
+
+	tests := []struct {
+		name string
+		n    int
+		want []string
+	}{
+		{name: "failures do not count", n: 2, want: []string{"p1-7", "p1-5", "p1-4", "p1-test", "p2-1"}},
+		{name: "newest completed kept when n is 0", n: 0, want: []string{"p1-7", "p1-5", "p1-test", "p2-1"}},
+		{name: "retain more than exist", n: 10, want: []string{"p1-7", "p1-5", "p1-4", "p1-3", "p1-test", "p2-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releaseIDs, versions := retainReleases(releases, tt.n)
+			if len(releaseIDs) != len(tt.want) {
+				t.Fatalf("retainReleases() kept %v, want %v", releaseIDs, tt.want)
+			}
+			for _, id := range tt.want {
+				if !releaseIDs[id] {
+					t.Fatalf("retainReleases() kept %v, want %v", releaseIDs, tt.want)
+				}
+			}
+			if versions["p1/v9"] || versions["p1/v6"] || !versions["p2/v5"] {
+				t.Fatalf("retainReleases() versions = %v", versions)
+			}
+		})
+	}
+}
@@ -94,6 +94,21 @@ func (s *BinService) RegisterNode(nodeID, cpuArch, osRelease, nodeName, binProxy
 	return node
 }
 
+// ActiveNodes 返回最近 within 时间内有 keepalive 的节点
+func (s *BinService) ActiveNodes(within time.Duration) []*Node {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deadline := time.Now().UTC().Add(-within)
+	nodes := make([]*Node, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		if node.LastSeen.After(deadline) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
 func (s *BinService) GetBin(binName string) (*Bin, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
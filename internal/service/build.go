@@ -1 +1,273 @@
 package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	versionFileName = "streamd.json"
+	downloadDir     = "downloads"
+
+	// buildResultAbandoned 重新构建时仍没有结果的上一次构建
+	buildResultAbandoned = "ABANDONED"
+)
+
+// RegisterBuildJobs 注册发布单构建流水线: build -> version_bump -> create_mr,
+// 以及与构建并行的 release_notes, 发布说明生成失败不影响发布单
+func (m *Manager) RegisterBuildJobs(jobs *JobService, releases *ReleaseService) {
+	onFailed := func(job *model.Job) {
+		reason := fmt.Sprintf("%s 任务失败: %s", job.Type, job.LastError)
+		if err := releases.Fail(job.ReleaseID, "system", reason); err != nil {
+			log.Error().Err(err).Str("releaseId", job.ReleaseID).Msg("更新发布单状态失败")
+		}
+	}
+
+	stageReporter := func(releaseID string) StageFunc {
+		return func(stage, status string) {
+			if err := releases.UpdateStage(releaseID, stage, status); err != nil {
+				log.Error().Err(err).Str("releaseId", releaseID).Str("stage", stage).Msg("更新发布阶段失败")
+			}
+		}
+	}
+
+	logReporter := func(releaseID string) LogFunc {
+		return func(line string) {
+			releases.Publish(StreamEventBuildLog, releaseID, map[string]string{"line": line})
+		}
+	}
+
+	jobs.Register(model.JobTypeBuild, func(ctx context.Context, job *model.Job) (map[string]string, error) {
+		release, err := releases.Get(job.ReleaseID)
+		if err != nil {
+			return nil, err
+		}
+		saveHandle := func(handle *model.BuildHandle) {
+			if err := releases.UpdateBuild(job.ReleaseID, handle); err != nil {
+				log.Error().Err(err).Str("releaseId", job.ReleaseID).Msg("保存构建信息失败")
+			}
+		}
+		// 上一次构建已结束 (失败、取消或任务重试) 时归档为历史构建, 未结束时继续跟踪
+		if release.Build != nil && release.Build.Result != "" {
+			if err := releases.ArchiveBuild(job.ReleaseID); err != nil {
+				return nil, err
+			}
+			release.Build = nil
+		}
+		buildInfo, err := m.Build(ctx, release, stageReporter(job.ReleaseID), logReporter(job.ReleaseID), saveHandle)
+		var failed *BuildFailedError
+		if errors.As(err, &failed) {
+			if err := releases.UpdateBuildSummary(job.ReleaseID, failed.Summary); err != nil {
+				log.Error().Err(err).Str("releaseId", job.ReleaseID).Msg("保存构建失败摘要失败")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := releases.UpdateArtifact(job.ReleaseID, buildInfo.TarFileName, buildInfo.Version, buildInfo.Digest, buildInfo.Artifacts); err != nil {
+			return nil, err
+		}
+		if err := releases.UpdateBuildCache(job.ReleaseID, buildInfo.Cache); err != nil {
+			return nil, err
+		}
+		if release.ForceRebuild {
+			if err := releases.ClearForceRebuild(job.ReleaseID); err != nil {
+				return nil, err
+			}
+		}
+
+		err = jobs.Enqueue(&model.Job{
+			ID:        downstreamJobID(job, model.JobTypeVersionBump),
+			ReleaseID: job.ReleaseID,
+			Type:      model.JobTypeVersionBump,
+			Payload:   map[string]string{"version": buildInfo.Version},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		result := map[string]string{
+			"version":     buildInfo.Version,
+			"tarFileName": buildInfo.TarFileName,
+			"digest":      buildInfo.Digest,
+		}
+		if len(buildInfo.Artifacts) > 0 {
+			platforms := make([]string, 0, len(buildInfo.Artifacts))
+			for _, variant := range buildInfo.Artifacts {
+				platforms = append(platforms, platformName(variant.OS, variant.Arch, variant.OSRelease))
+			}
+			result["platforms"] = strings.Join(platforms, ", ")
+		}
+		if buildInfo.Cache != nil {
+			result["commit"] = buildInfo.Cache.Commit
+			result["cacheHit"] = fmt.Sprint(buildInfo.Cache.Hit)
+		}
+		return result, nil
+	}, onFailed)
+
+	jobs.Register(model.JobTypeVersionBump, func(ctx context.Context, job *model.Job) (map[string]string, error) {
+		report := stageReporter(job.ReleaseID)
+		report(model.StageVersionBumpMR, model.StageStatusInProgress)
+
+		version := job.Payload["version"]
+		branch, err := m.gitlabMgr.CommitVersion(versionFileName, version)
+		if err != nil {
+			report(model.StageVersionBumpMR, model.StageStatusFailed)
+			return nil, err
+		}
+
+		err = jobs.Enqueue(&model.Job{
+			ID:        downstreamJobID(job, model.JobTypeCreateMR),
+			ReleaseID: job.ReleaseID,
+			Type:      model.JobTypeCreateMR,
+			Payload:   map[string]string{"version": version, "branch": branch},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]string{"branch": branch}, nil
+	}, onFailed)
+
+	jobs.Register(model.JobTypeReleaseNote, func(ctx context.Context, job *model.Job) (map[string]string, error) {
+		notes, err := m.GenerateReleaseNotes(releases, job.ReleaseID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"total": fmt.Sprint(notes.Total)}, nil
+	}, func(job *model.Job) {
+		log.Warn().Str("releaseId", job.ReleaseID).Str("error", job.LastError).Msg("生成发布说明失败")
+	})
+
+	jobs.Register(model.JobTypeCreateMR, func(ctx context.Context, job *model.Job) (map[string]string, error) {
+		report := stageReporter(job.ReleaseID)
+
+		version := job.Payload["version"]
+		description := version
+		if notes := m.releaseNotes(releases, job.ReleaseID); notes != nil {
+			description = notes.Markdown
+		}
+		mrUrl, err := m.gitlabMgr.CreateMergeRequest(job.Payload["branch"], "", version, description)
+		if err != nil {
+			report(model.StageVersionBumpMR, model.StageStatusFailed)
+			return nil, err
+		}
+
+		mrUrl, err = m.gitlabMgr.WebURL(mrUrl)
+		if err != nil {
+			report(model.StageVersionBumpMR, model.StageStatusFailed)
+			return nil, err
+		}
+		log.Info().Str("url", mrUrl).Msg("获取 MR URL 成功")
+
+		if err := releases.UpdateGitlabPR(job.ReleaseID, mrUrl); err != nil {
+			return nil, err
+		}
+		report(model.StageVersionBumpMR, model.StageStatusCompleted)
+		if err := releases.BuildSucceeded(job.ReleaseID); err != nil {
+			return nil, err
+		}
+
+		return map[string]string{"mrUrl": mrUrl}, nil
+	}, onFailed)
+}
+
+// CancelBuild 取消发布单的构建: 取消构建任务使等待构建的协程退出, 中止构建后端中的构建, 发布单置为失败
+func (m *Manager) CancelBuild(jobs *JobService, releases *ReleaseService, releaseID, operator string) error {
+	release, err := releases.Get(releaseID)
+	if err != nil {
+		return err
+	}
+	if release.Status != model.ReleaseStatusBuilding {
+		return fmt.Errorf("%w: release %s is not building", ErrInvalidTransition, releaseID)
+	}
+
+	if _, err := jobs.Cancel(releaseID, model.JobTypeBuild); err != nil {
+		return err
+	}
+
+	if handle := release.Build; handle != nil && handle.Result == "" {
+		if builder, ok := m.builders[handle.Builder]; ok {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := builder.Cancel(ctx, handle)
+			cancel()
+			if err != nil {
+				log.Error().Err(err).Str("releaseId", releaseID).Str("builder", handle.Builder).Str("id", handle.ID).Msg("中止构建失败")
+			}
+		}
+		handle.Result = buildResultCancelled
+		if err := releases.UpdateBuild(releaseID, handle); err != nil {
+			log.Error().Err(err).Str("releaseId", releaseID).Msg("保存构建信息失败")
+		}
+	}
+
+	if operator == "" {
+		operator = "system"
+	}
+	log.Info().Str("releaseId", releaseID).Str("operator", operator).Msg("构建已取消")
+	return releases.Fail(releaseID, operator, "取消构建")
+}
+
+// RetryBuild 构建失败、取消或超时后重新构建, 上一次构建归档为历史构建, 仍在运行时尝试取消. force 为 true 时不使用构建缓存
+func (m *Manager) RetryBuild(jobs *JobService, releases *ReleaseService, releaseID, operator string, force bool) error {
+	if operator == "" {
+		operator = "system"
+	}
+	release, err := releases.Get(releaseID)
+	if err != nil {
+		return err
+	}
+	if err := releases.Rebuild(releaseID, operator, force); err != nil {
+		return err
+	}
+	if stale := release.Build; stale != nil && stale.Result == "" {
+		m.cancelStaleBuild(releaseID, stale)
+	}
+
+	err = jobs.Enqueue(&model.Job{
+		ReleaseID: releaseID,
+		Type:      model.JobTypeBuild,
+	})
+	if err != nil {
+		if err := releases.Fail(releaseID, "system", "构建任务入队失败"); err != nil {
+			log.Error().Err(err).Str("releaseId", releaseID).Msg("更新发布单状态失败")
+		}
+		return err
+	}
+	return nil
+}
+
+// cancelStaleBuild 取消已归档但可能仍在构建后端运行的构建, 失败时只记录告警
+func (m *Manager) cancelStaleBuild(releaseID string, handle *model.BuildHandle) {
+	builder, ok := m.builders[handle.Builder]
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := builder.Cancel(ctx, handle); err != nil {
+		log.Warn().Err(err).Str("releaseId", releaseID).Str("builder", handle.Builder).Str("id", handle.ID).Msg("取消上一次构建失败")
+	}
+}
+
+// releaseNotes 返回发布单已生成的发布说明, 尚未生成时当场生成, 失败时返回 nil
+func (m *Manager) releaseNotes(releases *ReleaseService, releaseID string) *model.ReleaseNotes {
+	release, err := releases.Get(releaseID)
+	if err == nil && release.ReleaseNotes != nil {
+		return release.ReleaseNotes
+	}
+
+	notes, err := m.GenerateReleaseNotes(releases, releaseID)
+	if err != nil {
+		log.Warn().Err(err).Str("releaseId", releaseID).Msg("生成发布说明失败, MR 描述只包含版本号")
+		return nil
+	}
+	return notes
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BuildCacheService 保存成功构建的产物, 同一仓库同一提交以相同参数再次构建时直接复用
+type BuildCacheService struct {
+	collection *mongo.Collection
+}
+
+func NewBuildCacheService(mongodb *db.MongoDB) *BuildCacheService {
+	return &BuildCacheService{
+		collection: mongodb.Database.Collection("build_cache"),
+	}
+}
+
+func (s *BuildCacheService) Get(key string) (*model.BuildCacheEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var entry model.BuildCacheEntry
+	if err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Save 保存或覆盖同一 key 的缓存
+func (s *BuildCacheService) Save(entry *model.BuildCacheEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	entry.CreatedAt = time.Now()
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": entry.Key}, entry, options.Replace().SetUpsert(true))
+	return err
+}
+
+// Hit 记录一次缓存命中
+func (s *BuildCacheService) Hit(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{
+		"$inc": bson.M{"hits": 1},
+		"$set": bson.M{"lastHitAt": time.Now()},
+	}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": key}, update)
+	return err
+}
+
+func (s *BuildCacheService) Delete(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// buildCacheKey 由构建后端、仓库、提交和代入变量后的构建配置计算缓存 key,
+// 参数中使用了 {date} {releaseId} 等每次不同的变量时不会命中
+func buildCacheKey(builder, repository, commit string, profile *renderedBuildProfile) string {
+	payload, _ := json.Marshal(struct {
+		Builder    string
+		Repository string
+		Commit     string
+		Profile    *renderedBuildProfile
+	}{builder, repository, commit, profile})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// buildPinsCommit 构建配置的 job 或 params 使用了 {commit} 时, 构建的源码由解析到的提交决定, 才能按提交缓存产物
+func buildPinsCommit(profile *model.BuildProfile) bool {
+	if strings.Contains(profile.Job, "{commit}") {
+		return true
+	}
+	for _, value := range profile.Params {
+		if strings.Contains(value, "{commit}") {
+			return true
+		}
+	}
+	return false
+}
+
+// buildRepository 返回构建配置的源码仓库, 未配置时 GitLab CI 构建使用流水线所在项目
+func buildRepository(builder Builder, profile *model.BuildProfile, rendered *renderedBuildProfile) string {
+	if profile.Repository != "" {
+		return profile.Repository
+	}
+	if builder.Name() == BuilderGitLabCI {
+		return rendered.Job
+	}
+	return ""
+}
+
+// resolveCommit 返回源码仓库中构建分支当前的提交, repository 为 github.com/<owner>/<repo> 时查询 GitHub, 否则查询 GitLab
+func (m *Manager) resolveCommit(ctx context.Context, repository, ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if name, ok := strings.CutPrefix(repository, "github.com/"); ok {
+		owner, repo, ok := strings.Cut(name, "/")
+		if !ok || owner == "" || repo == "" {
+			return "", fmt.Errorf("invalid GitHub repository %q", repository)
+		}
+		if m.githubMgr == nil {
+			return "", fmt.Errorf("GitHub manager not initialized")
+		}
+		return m.githubMgr.CommitSHA(ctx, owner, repo, ref)
+	}
+	if m.gitlabMgr == nil {
+		return "", fmt.Errorf("GitLab manager not initialized")
+	}
+	return m.gitlabMgr.CommitSHA(ctx, repository, ref)
+}
+
+// cachedBuild 查找构建缓存, 命中且产物仍在仓库中时返回复用的产物, 否则返回 nil 继续构建
+func (m *Manager) cachedBuild(release *model.Release, cache *model.BuildCache, logf LogFunc) *BuildInfo {
+	if m.cache == nil {
+		return nil
+	}
+	entry, err := m.cache.Get(cache.Key)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("releaseId", release.ID).Msg("查询构建缓存失败")
+		return nil
+	}
+
+	if err := m.verifyCachedArtifacts(entry); err != nil {
+		log.Warn().Err(err).Str("releaseId", release.ID).Str("key", cache.Key).Msg("构建缓存的产物不可用, 重新构建")
+		logf(fmt.Sprintf("构建缓存的产物不可用, 重新构建: %v", err))
+		if err := m.cache.Delete(cache.Key); err != nil {
+			log.Warn().Err(err).Str("key", cache.Key).Msg("删除构建缓存失败")
+		}
+		return nil
+	}
+	if err := m.artifacts.Reference(entry.ProjectID, entry.Version, entry.Digest, release.ID); err != nil {
+		log.Warn().Err(err).Str("releaseId", release.ID).Msg("记录产物引用失败")
+	}
+	if err := m.cache.Hit(cache.Key); err != nil {
+		log.Warn().Err(err).Str("key", cache.Key).Msg("记录构建缓存命中失败")
+	}
+
+	cache.Hit = true
+	cache.SourceReleaseID = entry.ReleaseID
+	log.Info().Str("releaseId", release.ID).Str("commit", cache.Commit).Str("source", entry.ReleaseID).
+		Str("version", entry.Version).Msg("命中构建缓存")
+	logf(fmt.Sprintf("命中构建缓存: %s@%s 已由发布单 %s 构建, 复用产物 %s", cache.Repository, cache.Commit, entry.ReleaseID, entry.Version))
+	return &BuildInfo{
+		Version:     entry.Version,
+		TarFileName: entry.TarFileName,
+		Digest:      entry.Digest,
+		Artifacts:   entry.Artifacts,
+		Cache:       cache,
+	}
+}
+
+// verifyCachedArtifacts 按项目和 sha256 检查缓存的产物 (含多平台产物) 仍在仓库中且内容未变
+func (m *Manager) verifyCachedArtifacts(entry *model.BuildCacheEntry) error {
+	artifacts := append([]model.ArtifactVariant{{Version: entry.Version, Digest: entry.Digest}}, entry.Artifacts...)
+	for _, artifact := range artifacts {
+		_, digest, err := m.artifacts.Resolve(entry.ProjectID, artifact.Version, artifact.Digest)
+		if err != nil {
+			return err
+		}
+		if artifact.Digest != "" && digest != artifact.Digest {
+			return fmt.Errorf("artifact %s sha256 mismatch: expected %s, got %s", artifact.Version, artifact.Digest, digest)
+		}
+	}
+	return nil
+}
+
+// saveBuildCache 构建成功后保存缓存
+func (m *Manager) saveBuildCache(release *model.Release, builder Builder, rendered *renderedBuildProfile, info *BuildInfo) {
+	if m.cache == nil || info.Cache == nil {
+		return
+	}
+	err := m.cache.Save(&model.BuildCacheEntry{
+		Key:         info.Cache.Key,
+		ProjectID:   release.ProjectID,
+		Builder:     builder.Name(),
+		Repository:  info.Cache.Repository,
+		Commit:      info.Cache.Commit,
+		Job:         rendered.Job,
+		Params:      rendered.Params,
+		Version:     info.Version,
+		TarFileName: info.TarFileName,
+		Digest:      info.Digest,
+		Artifacts:   info.Artifacts,
+		ReleaseID:   release.ID,
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("releaseId", release.ID).Msg("保存构建缓存失败")
+	}
+}
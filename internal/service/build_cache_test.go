@@ -0,0 +1,106 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+)
+
+func TestBuildCacheKey(t *testing.T) {
+	profile := func(params map[string]string) *renderedBuildProfile {
+		return &renderedBuildProfile{
+			Job:              "streamd-build",
+			Params:           params,
+			Branch:           "main",
+			ArtifactPatterns: []string{"streamd*"},
+		}
+	}
+	base := buildCacheKey(BuilderJenkins, "github.com/qiniu/streamd", "abc123",
+		profile(map[string]string{"COMMIT": "abc123", "GO_VERSION": "go1.22"}))
+
+	tests := []struct {
+		name       string
+		builder    string
+		repository string
+		commit     string
+		profile    *renderedBuildProfile
+		same       bool
+	}{
+		{
+			name:       "same inputs with params in another order",
+			builder:    BuilderJenkins,
+			repository: "github.com/qiniu/streamd",
+			commit:     "abc123",
+			profile:    profile(map[string]string{"GO_VERSION": "go1.22", "COMMIT": "abc123"}),
+			same:       true,
+		},
+		{
+			name:       "other commit",
+			builder:    BuilderJenkins,
+			repository: "github.com/qiniu/streamd",
+			commit:     "def456",
+			profile:    profile(map[string]string{"COMMIT": "def456", "GO_VERSION": "go1.22"}),
+		},
+		{
+			name:       "other builder",
+			builder:    BuilderGitLabCI,
+			repository: "github.com/qiniu/streamd",
+			commit:     "abc123",
+			profile:    profile(map[string]string{"COMMIT": "abc123", "GO_VERSION": "go1.22"}),
+		},
+		{
+			name:       "other repository",
+			builder:    BuilderJenkins,
+			repository: "github.com/qiniu/streamd-fork",
+			commit:     "abc123",
+			profile:    profile(map[string]string{"COMMIT": "abc123", "GO_VERSION": "go1.22"}),
+		},
+		{
+			name:       "other params",
+			builder:    BuilderJenkins,
+			repository: "github.com/qiniu/streamd",
+			commit:     "abc123",
+			profile:    profile(map[string]string{"COMMIT": "abc123", "GO_VERSION": "go1.23"}),
+		},
+		{
+			name:       "other artifact patterns",
+			builder:    BuilderJenkins,
+			repository: "github.com/qiniu/streamd",
+			commit:     "abc123",
+			profile: &renderedBuildProfile{
+				Job:              "streamd-build",
+				Params:           map[string]string{"COMMIT": "abc123", "GO_VERSION": "go1.22"},
+				Branch:           "main",
+				ArtifactPatterns: []string{"streamd-linux-*"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := buildCacheKey(tt.builder, tt.repository, tt.commit, tt.profile)
+			if (key == base) != tt.same {
+				t.Fatalf("buildCacheKey() == base is %v, want %v", key == base, tt.same)
+			}
+		})
+	}
+}
+
+func TestBuildPinsCommit(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *model.BuildProfile
+		want    bool
+	}{
+		{name: "no commit", profile: &model.BuildProfile{Job: "streamd-build", Params: map[string]string{"BRANCH": "{branch}"}}},
+		{name: "commit in job", profile: &model.BuildProfile{Job: "streamd-build-{commit}"}, want: true},
+		{name: "commit in params", profile: &model.BuildProfile{Job: "streamd-build", Params: map[string]string{"GIT_COMMIT": "{commit}"}}, want: true},
+		{name: "commit only in artifact patterns", profile: &model.BuildProfile{Job: "streamd-build", ArtifactPatterns: []string{"streamd-{commit}*"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildPinsCommit(tt.profile); got != tt.want {
+				t.Fatalf("buildPinsCommit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// buildLogDir 构建日志按发布单归档在该目录下, 文件名为 <发布单 ID>.log
+	buildLogDir = "build-logs"
+	// buildLogPollInterval 构建期间拉取增量日志的间隔
+	buildLogPollInterval = 2 * time.Second
+	// buildLogReadLimit 接口单次返回的日志字节数上限
+	buildLogReadLimit = 1 << 20
+
+	buildSummaryMaxLines   = 20
+	buildSummaryMaxLineLen = 500
+)
+
+var (
+	// Jenkins 流水线进入阶段时输出 "[Pipeline] { (阶段名)", 前面阶段失败时后面的阶段会被跳过
+	jenkinsStagePattern   = regexp.MustCompile(`^\[Pipeline\] \{ \((.+)\)$`)
+	jenkinsSkippedPattern = regexp.MustCompile(`^Stage "(.+)" skipped due to`)
+	// GitLabCIBuilder.Logs 在每个任务日志结束后输出 "==> 任务名 (状态)"
+	gitlabJobPattern = regexp.MustCompile(`^==> (\S+) \((\w+)\)$`)
+	errorLinePattern = regexp.MustCompile(`(?i)(^|\W)(error|fatal|panic|failed|exception)(\W|$)`)
+	ansiPattern      = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+)
+
+// BuildFailedError 构建结束但未成功, Summary 为从构建日志中提取的失败摘要
+type BuildFailedError struct {
+	Builder string
+	ID      string
+	Summary *model.BuildSummary
+}
+
+func (e *BuildFailedError) Error() string {
+	msg := fmt.Sprintf("%s build %s finished with %s", e.Builder, e.ID, e.Summary.Result)
+	if e.Summary.Stage != "" {
+		msg += fmt.Sprintf(" at stage %s", e.Summary.Stage)
+	}
+	if n := len(e.Summary.ErrorLines); n > 0 {
+		msg += ": " + e.Summary.ErrorLines[n-1]
+	}
+	return msg
+}
+
+// BuildLogPath 返回发布单构建日志的归档路径
+func BuildLogPath(releaseID string) string {
+	return filepath.Join(buildLogDir, filepath.Base(releaseID)+".log")
+}
+
+// BuildAttemptLogPath 返回发布单第 attempt 次历史构建的日志路径
+func BuildAttemptLogPath(releaseID string, attempt int) string {
+	return filepath.Join(buildLogDir, fmt.Sprintf("%s.%d.log", filepath.Base(releaseID), attempt))
+}
+
+// buildLogArchive 将构建后端的增量日志追加到归档文件, 并按行通过 logf 推送.
+// offset 为构建后端日志的读取位置, 与归档文件大小一致, 继续跟踪构建时从文件末尾接着拉取
+type buildLogArchive struct {
+	file    *os.File
+	offset  int64
+	partial string
+	logf    LogFunc
+}
+
+// openBuildLog resume 为 true 时追加到已有的归档, 否则清空重新记录
+func openBuildLog(releaseID string, resume bool, logf LogFunc) (*buildLogArchive, error) {
+	if err := os.MkdirAll(buildLogDir, 0755); err != nil {
+		return nil, err
+	}
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(BuildLogPath(releaseID), flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &buildLogArchive{file: file, offset: info.Size(), logf: logf}, nil
+}
+
+func (a *buildLogArchive) write(chunk *BuildLogChunk) error {
+	a.offset = chunk.Next
+	if chunk.Text == "" {
+		return nil
+	}
+	if _, err := a.file.WriteString(chunk.Text); err != nil {
+		return err
+	}
+
+	lines := strings.Split(a.partial+chunk.Text, "\n")
+	a.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		a.logf(strings.TrimRight(line, "\r"))
+	}
+	return nil
+}
+
+func (a *buildLogArchive) Close() error {
+	if a.partial != "" {
+		a.logf(a.partial)
+		a.partial = ""
+	}
+	return a.file.Close()
+}
+
+// pull 拉取一次增量日志, 返回构建后端是否还有后续日志
+func (a *buildLogArchive) pull(ctx context.Context, builder Builder, handle *model.BuildHandle) (bool, error) {
+	chunk, err := builder.Logs(ctx, handle, a.offset)
+	if err != nil {
+		return false, err
+	}
+	if err := a.write(chunk); err != nil {
+		return false, err
+	}
+	return chunk.More, nil
+}
+
+// follow 构建期间定时拉取增量日志, 直到 ctx 结束
+func (a *buildLogArchive) follow(ctx context.Context, builder Builder, handle *model.BuildHandle) {
+	ticker := time.NewTicker(buildLogPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.pull(ctx, builder, handle); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("builder", builder.Name()).Str("id", handle.ID).Msg("拉取构建日志失败")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// drain 构建结束后拉取剩余日志, Jenkins 在结果产生后可能还有少量输出
+func (a *buildLogArchive) drain(ctx context.Context, builder Builder, handle *model.BuildHandle) {
+	for i := 0; i < 10; i++ {
+		more, err := a.pull(ctx, builder, handle)
+		if err != nil {
+			log.Warn().Err(err).Str("builder", builder.Name()).Str("id", handle.ID).Msg("拉取构建日志失败")
+			return
+		}
+		if !more {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// summarizeBuildLog 从归档的构建日志中提取失败阶段和最后的错误行.
+// 失败阶段: GitLab CI 为第一个失败的任务, Jenkins 为最后一个进入且未被跳过的阶段
+func summarizeBuildLog(releaseID, result string) (*model.BuildSummary, error) {
+	summary := &model.BuildSummary{Result: result}
+
+	file, err := os.Open(BuildLogPath(releaseID))
+	if os.IsNotExist(err) {
+		return summary, nil
+	}
+	if err != nil {
+		return summary, err
+	}
+	defer file.Close()
+
+	var stages []string
+	var failedJob string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(ansiPattern.ReplaceAllString(scanner.Text(), ""))
+
+		if match := jenkinsStagePattern.FindStringSubmatch(line); match != nil {
+			stages = append(stages, match[1])
+			continue
+		}
+		if match := jenkinsSkippedPattern.FindStringSubmatch(line); match != nil {
+			if n := len(stages); n > 0 && stages[n-1] == match[1] {
+				stages = stages[:n-1]
+			}
+			continue
+		}
+		if match := gitlabJobPattern.FindStringSubmatch(line); match != nil {
+			if match[2] == "failed" && failedJob == "" {
+				failedJob = match[1]
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "[Pipeline]") || !errorLinePattern.MatchString(line) {
+			continue
+		}
+
+		if len(line) > buildSummaryMaxLineLen {
+			line = line[:buildSummaryMaxLineLen]
+		}
+		summary.ErrorLines = append(summary.ErrorLines, line)
+		if len(summary.ErrorLines) > buildSummaryMaxLines {
+			summary.ErrorLines = summary.ErrorLines[1:]
+		}
+	}
+
+	summary.Stage = failedJob
+	if summary.Stage == "" && len(stages) > 0 {
+		summary.Stage = stages[len(stages)-1]
+	}
+	return summary, scanner.Err()
+}
+
+// ReadBuildLog 读取归档的构建日志中 offset 之后的部分, 单次最多 buildLogReadLimit 字节
+func ReadBuildLog(path string, offset int64) (text string, next int64, err error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return "", 0, err
+	}
+	data, err := io.ReadAll(io.LimitReader(file, buildLogReadLimit))
+	if err != nil {
+		return "", 0, err
+	}
+	// 达到上限时截到最后一个完整行, 避免切断多字节字符
+	if len(data) == buildLogReadLimit {
+		if i := strings.LastIndexByte(string(data), '\n'); i >= 0 {
+			data = data[:i+1]
+		}
+	}
+	return string(data), offset + int64(len(data)), nil
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrInvalidBuildProfile  = errors.New("invalid build profile")
+	ErrInvalidBuildVariable = errors.New("invalid build variable")
+)
+
+const (
+	defaultBuildBranch    = "main"
+	defaultPackagePattern = "*.tar.gz"
+	buildDateLayout       = "2006-01-02-15-04-05"
+)
+
+var buildVariablePattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// buildValuePattern 版本号、分支等来自发布单和构建配置的变量取值, 不允许空白、shell 元字符和以 - 开头
+var buildValuePattern = regexp.MustCompile(`^[0-9A-Za-z_][0-9A-Za-z._+/-]*$`)
+
+// buildVariables 构建配置模板中可以使用的变量
+var buildVariables = map[string]bool{
+	"version":   true,
+	"branch":    true,
+	"date":      true,
+	"module":    true,
+	"toolchain": true,
+	"releaseId": true,
+	"commit":    true,
+}
+
+// BuildProfileService 按项目保存构建配置, 新模块接入只需要配置, 不需要改代码
+type BuildProfileService struct {
+	collection *mongo.Collection
+}
+
+func NewBuildProfileService(mongodb *db.MongoDB) *BuildProfileService {
+	return &BuildProfileService{
+		collection: mongodb.Database.Collection("build_profiles"),
+	}
+}
+
+func (s *BuildProfileService) List() ([]*model.BuildProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	profiles := []*model.BuildProfile{}
+	if err = cursor.All(ctx, &profiles); err != nil {
+		return nil, err
+	}
+
+	return profiles, nil
+}
+
+func (s *BuildProfileService) Get(projectID string) (*model.BuildProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var profile model.BuildProfile
+	if err := s.collection.FindOne(ctx, bson.M{"_id": projectID}).Decode(&profile); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// Save 校验后创建或覆盖项目的构建配置
+func (s *BuildProfileService) Save(profile *model.BuildProfile) error {
+	if err := ValidateBuildProfile(profile); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	profile.UpdatedAt = time.Now()
+	_, err := s.collection.ReplaceOne(ctx, bson.M{"_id": profile.ProjectID}, profile, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *BuildProfileService) Delete(projectID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": projectID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// ValidateBuildProfile 检查模板变量和产物匹配规则
+func ValidateBuildProfile(profile *model.BuildProfile) error {
+	if len(profile.ArtifactPatterns) == 0 && len(profile.Platforms) == 0 {
+		return fmt.Errorf("%w: artifactPatterns is required", ErrInvalidBuildProfile)
+	}
+
+	templates := []string{profile.Job, profile.PackagePattern}
+	templates = append(templates, profile.ArtifactPatterns...)
+	platforms := make(map[string]bool, len(profile.Platforms))
+	for _, platform := range profile.Platforms {
+		if platform.Arch == "" || len(platform.ArtifactPatterns) == 0 {
+			return fmt.Errorf("%w: platform arch and artifactPatterns are required", ErrInvalidBuildProfile)
+		}
+		key := platformName(platformOS(platform.OS), normalizeArch(platform.Arch), platform.OSRelease)
+		if platforms[key] {
+			return fmt.Errorf("%w: duplicate platform %s", ErrInvalidBuildProfile, key)
+		}
+		platforms[key] = true
+		templates = append(templates, platform.ArtifactPatterns...)
+	}
+	for _, value := range profile.Params {
+		templates = append(templates, value)
+	}
+	for _, template := range templates {
+		for _, match := range buildVariablePattern.FindAllStringSubmatch(template, -1) {
+			if !buildVariables[match[1]] {
+				return fmt.Errorf("%w: unknown variable {%s} in %q", ErrInvalidBuildProfile, match[1], template)
+			}
+		}
+	}
+
+	patterns := append([]string{profile.PackagePattern}, profile.ArtifactPatterns...)
+	for _, platform := range profile.Platforms {
+		patterns = append(patterns, platform.ArtifactPatterns...)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: bad pattern %q", ErrInvalidBuildProfile, pattern)
+		}
+	}
+	return nil
+}
+
+// defaultBuildProfile 项目没有构建配置时使用, 与接入构建配置前的行为一致
+func defaultBuildProfile(projectID string) *model.BuildProfile {
+	return &model.BuildProfile{
+		ProjectID:        projectID,
+		ArtifactPatterns: []string{"*" + buildArtifactName + "*"},
+	}
+}
+
+// buildProfile 返回发布单所属项目的构建配置
+func (m *Manager) buildProfile(release *model.Release) (*model.BuildProfile, error) {
+	if m.profiles == nil {
+		return defaultBuildProfile(release.ProjectID), nil
+	}
+	profile, err := m.profiles.Get(release.ProjectID)
+	if err == mongo.ErrNoDocuments {
+		return defaultBuildProfile(release.ProjectID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// renderedBuildProfile 构建配置代入变量后的结果
+type renderedBuildProfile struct {
+	Job              string
+	Params           map[string]string
+	Env              map[string]string `json:",omitempty"` // 本地构建以环境变量传入的变量
+	Branch           string
+	ArtifactPatterns []string
+	PackagePattern   string
+	Platforms        []model.BuildPlatform
+}
+
+// renderBuildProfile 代入变量, commit 为构建分支当前的提交, 没有配置源码仓库时为空.
+// 本地构建的命令不代入变量, 变量通过环境变量传入
+func (m *Manager) renderBuildProfile(profile *model.BuildProfile, release *model.Release, builder, commit string, now time.Time) (*renderedBuildProfile, error) {
+	module := profile.Module
+	if module == "" && m.projects != nil {
+		if project, err := m.projects.Get(release.ProjectID); err == nil {
+			module = project.Code
+		}
+	}
+	branch := profile.Branch
+	if branch == "" {
+		branch = defaultBuildBranch
+	}
+	variables := map[string]string{
+		"version":   release.Version,
+		"branch":    branch,
+		"date":      now.Format(buildDateLayout),
+		"module":    module,
+		"toolchain": profile.Toolchain,
+		"releaseId": release.ID,
+		"commit":    commit,
+	}
+	for _, name := range []string{"version", "branch", "module", "toolchain"} {
+		if value := variables[name]; value != "" && !buildValuePattern.MatchString(value) {
+			return nil, fmt.Errorf("%w: %s %q contains unsupported characters", ErrInvalidBuildVariable, name, value)
+		}
+	}
+	render := func(template string) string {
+		return buildVariablePattern.ReplaceAllStringFunc(template, func(match string) string {
+			return variables[match[1:len(match)-1]]
+		})
+	}
+
+	rendered := &renderedBuildProfile{
+		Job:            render(profile.Job),
+		Branch:         branch,
+		Params:         make(map[string]string, len(profile.Params)),
+		PackagePattern: render(profile.PackagePattern),
+	}
+	if builder == BuilderLocal {
+		rendered.Job = profile.Job
+		rendered.Env = localBuildEnv(variables)
+	}
+	if rendered.PackagePattern == "" {
+		rendered.PackagePattern = defaultPackagePattern
+	}
+	for key, value := range profile.Params {
+		rendered.Params[key] = render(value)
+	}
+	for _, pattern := range profile.ArtifactPatterns {
+		rendered.ArtifactPatterns = append(rendered.ArtifactPatterns, render(pattern))
+	}
+	for _, platform := range profile.Platforms {
+		patterns := make([]string, 0, len(platform.ArtifactPatterns))
+		for _, pattern := range platform.ArtifactPatterns {
+			patterns = append(patterns, render(pattern))
+		}
+		rendered.Platforms = append(rendered.Platforms, model.BuildPlatform{
+			OS:               platformOS(platform.OS),
+			Arch:             normalizeArch(platform.Arch),
+			OSRelease:        platform.OSRelease,
+			ArtifactPatterns: patterns,
+		})
+	}
+	if len(rendered.ArtifactPatterns) == 0 && len(rendered.Platforms) == 0 {
+		return nil, fmt.Errorf("%w: project %s has no artifact patterns", ErrInvalidBuildProfile, release.ProjectID)
+	}
+	return rendered, nil
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	BuilderJenkins  = "jenkins"
+	BuilderGitLabCI = "gitlab-ci"
+	BuilderLocal    = "local"
+
+	// 构建状态轮询间隔从 buildPollInterval 开始逐次翻倍, 最长 buildPollMaxInterval
+	buildPollInterval    = 2 * time.Second
+	buildPollMaxInterval = 30 * time.Second
+	buildTimeout         = 3 * time.Hour
+	// buildReconcileInterval 构建后端有通知回调时的兜底轮询间隔
+	buildReconcileInterval = 2 * time.Minute
+
+	// buildResultCancelled 通过接口取消的构建结果
+	buildResultCancelled = "CANCELLED"
+)
+
+var ErrBuilderNotFound = errors.New("builder not configured")
+
+// BuildRequest 一次构建的输入, Job 为空时使用构建后端的默认任务
+type BuildRequest struct {
+	ReleaseID string
+	ProjectID string
+	Job       string
+	Params    map[string]string
+	Env       map[string]string // 本地构建额外传入的环境变量
+}
+
+// HandleFunc 保存构建标识, 用于重启后继续跟踪同一个构建
+type HandleFunc func(handle *model.BuildHandle)
+
+type BuildState struct {
+	Finished bool
+	Success  bool
+	Result   string
+	URL      string
+}
+
+// BuildLogChunk 从 offset 开始的一段构建日志, Next 为下次读取的 offset
+type BuildLogChunk struct {
+	Text string
+	Next int64
+	More bool
+}
+
+// Builder 构建后端, Jenkins、GitLab CI 流水线和本地命令各有一个实现
+type Builder interface {
+	Name() string
+	Start(ctx context.Context, req *BuildRequest) (*model.BuildHandle, error)
+	Status(ctx context.Context, handle *model.BuildHandle) (*BuildState, error)
+	Logs(ctx context.Context, handle *model.BuildHandle, offset int64) (*BuildLogChunk, error)
+	Artifacts(ctx context.Context, handle *model.BuildHandle) ([]string, error)
+	Download(ctx context.Context, handle *model.BuildHandle, name string, dir string) (string, error)
+	Cancel(ctx context.Context, handle *model.BuildHandle) error
+}
+
+// RegisterBuilder 注册构建后端, 同名后端会被替换
+func (m *Manager) RegisterBuilder(builder Builder) {
+	m.builders[builder.Name()] = builder
+}
+
+func (m *Manager) SetProjectService(projects *ProjectService) {
+	m.projects = projects
+}
+
+func (m *Manager) SetBuildProfileService(profiles *BuildProfileService) {
+	m.profiles = profiles
+}
+
+func (m *Manager) SetArtifactStore(artifacts *ArtifactStore) {
+	m.artifacts = artifacts
+}
+
+func (m *Manager) SetBuildCache(cache *BuildCacheService) {
+	m.cache = cache
+}
+
+// builderFor 返回项目选择的构建后端, 未选择时使用 Jenkins
+func (m *Manager) builderFor(projectID string) (Builder, error) {
+	name := BuilderJenkins
+	if m.projects != nil && projectID != "" {
+		project, err := m.projects.Get(projectID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get project %s: %w", projectID, err)
+		}
+		if project.Builder != "" {
+			name = project.Builder
+		}
+	}
+
+	builder, ok := m.builders[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBuilderNotFound, name)
+	}
+	return builder, nil
+}
+
+// buildWaiters 等待中的构建, 收到构建后端的通知回调时唤醒对应的 waitBuild 立即查询状态
+type buildWaiters struct {
+	mu      sync.Mutex
+	waiters map[string]chan struct{}
+}
+
+func newBuildWaiters() *buildWaiters {
+	return &buildWaiters{waiters: make(map[string]chan struct{})}
+}
+
+func buildKey(builder, id string) string {
+	return builder + "/" + id
+}
+
+// watch 注册等待, 返回的 stop 用于注销
+func (w *buildWaiters) watch(builder, id string) (<-chan struct{}, func()) {
+	key := buildKey(builder, id)
+	wake := make(chan struct{}, 1)
+
+	w.mu.Lock()
+	w.waiters[key] = wake
+	w.mu.Unlock()
+
+	return wake, func() {
+		w.mu.Lock()
+		if w.waiters[key] == wake {
+			delete(w.waiters, key)
+		}
+		w.mu.Unlock()
+	}
+}
+
+// notify 唤醒等待该构建的 waitBuild, 构建不在本进程等待时返回 false
+func (w *buildWaiters) notify(builder, id string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wake, ok := w.waiters[buildKey(builder, id)]
+	if !ok {
+		return false
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// waitBuild 轮询构建状态直到结束或超时, handle 有变化 (如解析出构建号) 时调用 save 保存.
+// wake 为 nil 时按退避间隔轮询; 否则构建后端会发送通知回调, 收到 wake 时立即查询, 轮询降为 buildReconcileInterval 的兜底
+func waitBuild(ctx context.Context, builder Builder, handle *model.BuildHandle, save HandleFunc, wake <-chan struct{}) (*BuildState, error) {
+	ctx, cancel := context.WithTimeout(ctx, buildTimeout)
+	defer cancel()
+
+	interval := buildPollInterval
+	maxInterval := buildPollMaxInterval
+	if wake != nil {
+		interval = buildReconcileInterval
+		maxInterval = buildReconcileInterval
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("build %s/%s: %w", builder.Name(), handle.ID, ctx.Err())
+		case <-wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		before := *handle
+		state, err := builder.Status(ctx, handle)
+		if *handle != before {
+			save(handle)
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("builder", builder.Name()).Str("id", handle.ID).Msg("查询构建状态失败")
+		} else if state.Finished {
+			return state, nil
+		}
+
+		timer.Reset(interval)
+		interval *= 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// IsValidBuilder 校验项目配置的构建后端名称
+func IsValidBuilder(name string) bool {
+	switch name {
+	case "", BuilderJenkins, BuilderGitLabCI, BuilderLocal:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	cfg "github.com/felix-001/qnHackathon/internal/config"
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrNoTargetNodes = errors.New("no active nodes to deploy to")
+
+const (
+	NodeStatusInProgress = "in_progress"
+	NodeStatusSuccess    = "success"
+	NodeStatusFailed     = "failed"
+
+	deployCheckInterval = 30 * time.Second
+)
+
+// DeployService 根据 bin-proxy 上报的节点进度决定发布单何时完成:
+// 成功节点达到 quorum 后进入健康检查, 无法达到 quorum、失败比例过高或超时则失败
+type DeployService struct {
+	db         *db.MongoDB
+	releases   *ReleaseService
+	bins       *BinService
+	apps       *ApplicationService
+	projects   *ProjectService
+	artifacts  *ArtifactStore
+	conf       cfg.DeployConf
+	httpClient *http.Client
+
+	// healthChecks 本进程内正在进行健康检查的发布单
+	healthChecks sync.Map
+}
+
+func NewDeployService(db *db.MongoDB, releases *ReleaseService, bins *BinService, conf cfg.DeployConf) *DeployService {
+	if conf.SuccessQuorum <= 0 || conf.SuccessQuorum > 1 {
+		conf.SuccessQuorum = 1
+	}
+	if conf.TimeoutMinutes <= 0 {
+		conf.TimeoutMinutes = 30
+	}
+	if conf.NodeActiveMinutes <= 0 {
+		conf.NodeActiveMinutes = 5
+	}
+	if len(conf.CanarySteps) == 0 {
+		conf.CanarySteps = []int{10, 50, 100}
+	}
+	if conf.StepWaitSeconds <= 0 {
+		conf.StepWaitSeconds = 120
+	}
+	if conf.MaxUnavailable <= 0 {
+		conf.MaxUnavailable = 1
+	}
+	if conf.HealthCheckWindowSeconds <= 0 {
+		conf.HealthCheckWindowSeconds = 120
+	}
+	if conf.HealthCheckIntervalSeconds <= 0 {
+		conf.HealthCheckIntervalSeconds = 10
+	}
+	if conf.HealthCheckTimeoutSeconds <= 0 {
+		conf.HealthCheckTimeoutSeconds = 5
+	}
+	if conf.HealthCheckFailureThreshold <= 0 {
+		conf.HealthCheckFailureThreshold = 3
+	}
+	return &DeployService{
+		db:         db,
+		releases:   releases,
+		bins:       bins,
+		conf:       conf,
+		httpClient: &http.Client{Timeout: time.Duration(conf.HealthCheckTimeoutSeconds) * time.Second},
+	}
+}
+
+func (s *DeployService) SetArtifactStore(artifacts *ArtifactStore) {
+	s.artifacts = artifacts
+}
+
+func (s *DeployService) SetProjectService(projects *ProjectService) {
+	s.projects = projects
+}
+
+// Deploy 计算目标节点并将发布单置为部署中, 目标节点、超时时间和分批计划与状态流转在同一次更新中写入,
+// 金丝雀、滚动和蓝绿策略按批次推进
+func (s *DeployService) Deploy(id, operator string) error {
+	targets := s.targetNodes()
+	if len(targets) == 0 {
+		return ErrNoTargetNodes
+	}
+
+	release, err := s.releases.Get(id)
+	if err != nil {
+		return err
+	}
+	fields, err := s.deployment(release, targets)
+	if err != nil {
+		return err
+	}
+	for k, v := range s.rolloutPlan(release, targets) {
+		fields[k] = v
+	}
+	return s.releases.Deploy(id, operator, fields)
+}
+
+// Track 跟踪已处于部署中的发布单, 例如回滚生成的发布单, 无法跟踪时发布单置为失败
+func (s *DeployService) Track(id string) error {
+	err := s.track(id)
+	if err == nil {
+		return nil
+	}
+
+	reason := fmt.Sprintf("跟踪部署进度失败: %v", err)
+	if errors.Is(err, ErrNoTargetNodes) {
+		reason = "没有可部署的在线节点"
+	}
+	if err := s.releases.Fail(id, "system", reason); err != nil && !errors.Is(err, ErrInvalidTransition) {
+		log.Error().Err(err).Str("releaseId", id).Msg("更新发布单状态失败")
+	}
+	return err
+}
+
+func (s *DeployService) track(id string) error {
+	targets := s.targetNodes()
+	if len(targets) == 0 {
+		return ErrNoTargetNodes
+	}
+
+	release, err := s.releases.Get(id)
+	if err != nil {
+		return err
+	}
+	fields, err := s.deployment(release, targets)
+	if err != nil {
+		return err
+	}
+	return s.releases.UpdateDeployment(id, fields)
+}
+
+func (s *DeployService) targetNodes() []string {
+	nodes := s.bins.ActiveNodes(time.Duration(s.conf.NodeActiveMinutes) * time.Minute)
+	targets := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		targets = append(targets, nodeTarget(node))
+	}
+	return targets
+}
+
+// nodeTarget 节点在目标节点和分批中的标识, 取节点名, 没有时取节点 ID
+func nodeTarget(node *Node) string {
+	if node.NodeName != "" {
+		return node.NodeName
+	}
+	return node.NodeID
+}
+
+// deployment 清空上一次的节点进度, 返回本次部署需要写入发布单的目标节点、超时时间和产物 sha256
+func (s *DeployService) deployment(release *model.Release, targets []string) (bson.M, error) {
+	version, sum := releaseArtifact(release)
+	if version != "" || sum != "" {
+		var err error
+		_, sum, err = s.artifacts.Resolve(release.ProjectID, version, sum)
+		if err != nil {
+			log.Warn().Err(err).Str("releaseId", release.ID).Msg("计算产物 sha256 失败, 节点上报需携带 releaseId")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := s.db.Database.Collection("deploy_progress").DeleteMany(ctx, bson.M{"releaseId": release.ID}); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(time.Duration(s.conf.TimeoutMinutes) * time.Minute)
+	log.Info().Str("releaseId", release.ID).Strs("targets", targets).Time("deadline", deadline).Msg("开始跟踪部署进度")
+	return bson.M{
+		"targetNodes":    targets,
+		"deployDeadline": deadline,
+		"artifactSha256": sum,
+	}, nil
+}
+
+// RecordProgress 记录节点进度, releaseID 为空时按 targetHash 匹配部署中的发布单
+func (s *DeployService) RecordProgress(progress *model.NodeProgress) error {
+	release, err := s.resolveRelease(progress.ReleaseID, progress.TargetHash)
+	if err != nil || release == nil {
+		return err
+	}
+	progress.ReleaseID = release.ID
+	progress.UpdatedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"releaseId": progress.ReleaseID, "nodeName": progress.NodeName}
+	update := bson.M{"$set": bson.M{
+		"binName":        progress.BinName,
+		"targetHash":     progress.TargetHash,
+		"status":         progress.Status,
+		"processingTime": progress.ProcessingTime,
+		"updatedAt":      progress.UpdatedAt,
+	}}
+	opts := options.Update().SetUpsert(true)
+	if _, err := s.db.Database.Collection("deploy_progress").UpdateOne(ctx, filter, update, opts); err != nil {
+		return err
+	}
+	s.releases.Publish(StreamEventNode, progress.ReleaseID, progress)
+
+	if release.Status != model.ReleaseStatusDeploying {
+		return nil
+	}
+	return s.evaluate(release, false)
+}
+
+func (s *DeployService) resolveRelease(releaseID, targetHash string) (*model.Release, error) {
+	if releaseID != "" {
+		return s.releases.Get(releaseID)
+	}
+	if targetHash == "" {
+		return nil, nil
+	}
+
+	releases, err := s.releases.FindDeploying(targetHash)
+	if err != nil || len(releases) == 0 {
+		return nil, err
+	}
+	return releases[0], nil
+}
+
+func (s *DeployService) Summary(releaseID string) (*model.DeploySummary, error) {
+	release, err := s.releases.Get(releaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.db.Database.Collection("deploy_progress").Find(ctx, bson.M{"releaseId": releaseID},
+		options.Find().SetSort(bson.D{{Key: "nodeName", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	nodes := []*model.NodeProgress{}
+	if err = cursor.All(ctx, &nodes); err != nil {
+		return nil, err
+	}
+
+	summary := &model.DeploySummary{
+		ReleaseID: release.ID,
+		Status:    release.Status,
+		Targets:   len(release.TargetNodes),
+		Required:  s.required(len(release.TargetNodes)),
+		Deadline:  release.DeployDeadline,
+		Nodes:     nodes,
+	}
+
+	reported := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		reported[node.NodeName] = node.Status
+	}
+	for _, target := range release.TargetNodes {
+		switch reported[target] {
+		case NodeStatusSuccess:
+			summary.Success++
+		case NodeStatusFailed:
+			summary.Failed++
+		case NodeStatusInProgress:
+			summary.InProgress++
+		default:
+			summary.Pending++
+		}
+	}
+
+	return summary, nil
+}
+
+func (s *DeployService) required(targets int) int {
+	required := int(math.Ceil(s.conf.SuccessQuorum * float64(targets)))
+	if required < 1 {
+		required = 1
+	}
+	return required
+}
+
+// verdict 按节点进度判定发布结果: 达到 quorum 时 done 为 true, 应失败时返回失败原因, 都没有时继续等待
+func (s *DeployService) verdict(summary *model.DeploySummary, timedOut bool) (done bool, failure string) {
+	switch {
+	case summary.Success >= summary.Required:
+		return true, ""
+	case summary.Failed > summary.Targets-summary.Required:
+		return false, fmt.Sprintf("失败节点过多, 无法达到 quorum: 成功 %d, 失败 %d, 共 %d", summary.Success, summary.Failed, summary.Targets)
+	case s.conf.MaxFailureRatio > 0 && float64(summary.Failed)/float64(summary.Targets) > s.conf.MaxFailureRatio:
+		return false, fmt.Sprintf("失败节点比例超过 %.2f: 失败 %d, 共 %d", s.conf.MaxFailureRatio, summary.Failed, summary.Targets)
+	case timedOut:
+		return false, fmt.Sprintf("部署超时: 成功 %d, 需要 %d, 共 %d", summary.Success, summary.Required, summary.Targets)
+	}
+	return false, ""
+}
+
+// evaluate 根据目标节点的进度完成或失败发布单, timedOut 为 true 时未达到 quorum 即失败
+func (s *DeployService) evaluate(release *model.Release, timedOut bool) error {
+	// 已进入健康检查, 由健康检查决定发布结果
+	if release.HealthCheck != nil {
+		return nil
+	}
+	// 尚未写入目标节点, 还没有开始跟踪
+	if len(release.TargetNodes) == 0 {
+		return nil
+	}
+	if len(release.RolloutSteps) > 0 {
+		err := s.evaluateRollout(release, timedOut)
+		if errors.Is(err, ErrInvalidTransition) {
+			return nil
+		}
+		return err
+	}
+
+	summary, err := s.Summary(release.ID)
+	if err != nil {
+		return err
+	}
+
+	done, failure := s.verdict(summary, timedOut)
+	switch {
+	case done:
+		log.Info().Str("releaseId", release.ID).Int("success", summary.Success).Int("targets", summary.Targets).Msg("达到成功 quorum")
+		err = s.finish(release)
+	case failure != "":
+		err = s.releases.Fail(release.ID, "system", failure)
+	}
+
+	// 并发上报时可能已被其他请求流转
+	if errors.Is(err, ErrInvalidTransition) {
+		return nil
+	}
+	return err
+}
+
+// Start 定期检查部署超时的发布单, 推进处于观察期的批次, 继续重启前未完成的健康检查,
+// 并跟踪进程重启前尚未开始跟踪的发布单
+func (s *DeployService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(deployCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.reconcile()
+			}
+		}
+	}()
+}
+
+func (s *DeployService) reconcile() {
+	releases, err := s.releases.FindDeploying("")
+	if err != nil {
+		log.Error().Err(err).Msg("查询部署中的发布单失败")
+		return
+	}
+
+	now := time.Now()
+	for _, release := range releases {
+		if len(release.TargetNodes) == 0 {
+			if err := s.Track(release.ID); err != nil {
+				log.Error().Err(err).Str("releaseId", release.ID).Msg("跟踪部署进度失败")
+			}
+			continue
+		}
+		if release.HealthCheck != nil {
+			if release.HealthCheck.Status == model.HealthCheckInProgress {
+				s.resumeHealthCheck(release)
+			}
+			continue
+		}
+		timedOut := release.DeployDeadline != nil && !now.Before(*release.DeployDeadline)
+		if !timedOut && len(release.RolloutSteps) == 0 {
+			continue
+		}
+		if err := s.evaluate(release, timedOut); err != nil {
+			log.Error().Err(err).Str("releaseId", release.ID).Msg("检查部署进度失败")
+		}
+	}
+}
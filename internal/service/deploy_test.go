@@ -0,0 +1,124 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	cfg "github.com/felix-001/qnHackathon/internal/config"
+	"github.com/felix-001/qnHackathon/internal/model"
+)
+
+func TestDeployRequired(t *testing.T) {
+	tests := []struct {
+		quorum  float64
+		targets int
+		want    int
+	}{
+		{quorum: 1, targets: 3, want: 3},
+		{quorum: 0.8, targets: 10, want: 8},
+		{quorum: 0.8, targets: 3, want: 3},
+		{quorum: 0.5, targets: 3, want: 2},
+		{quorum: 0.1, targets: 1, want: 1},
+		{quorum: 1, targets: 0, want: 1},
+	}
+	for _, tt := range tests {
+		s := &DeployService{conf: cfg.DeployConf{SuccessQuorum: tt.quorum}}
+		if got := s.required(tt.targets); got != tt.want {
+			t.Errorf("required(%d) with quorum %.1f = %d, want %d", tt.targets, tt.quorum, got, tt.want)
+		}
+	}
+}
+
+func TestDeployVerdict(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxFailureRatio float64
+		summary         model.DeploySummary
+		timedOut        bool
+		wantDone        bool
+		wantFailure     string
+	}{
+		{
+			name:     "quorum reached",
+			summary:  model.DeploySummary{Targets: 10, Required: 8, Success: 8, Failed: 2},
+			wantDone: true,
+		},
+		{
+			name:    "still waiting",
+			summary: model.DeploySummary{Targets: 10, Required: 8, Success: 5, Failed: 1, InProgress: 4},
+		},
+		{
+			name:        "quorum no longer reachable",
+			summary:     model.DeploySummary{Targets: 10, Required: 8, Success: 5, Failed: 3, InProgress: 2},
+			wantFailure: "失败节点过多",
+		},
+		{
+			name:            "failure ratio exceeded",
+			maxFailureRatio: 0.1,
+			summary:         model.DeploySummary{Targets: 10, Required: 5, Success: 3, Failed: 2, InProgress: 5},
+			wantFailure:     "失败节点比例超过",
+		},
+		{
+			name:            "failure ratio not exceeded",
+			maxFailureRatio: 0.2,
+			summary:         model.DeploySummary{Targets: 10, Required: 5, Success: 3, Failed: 2, InProgress: 5},
+		},
+		{
+			name:        "timed out before quorum",
+			summary:     model.DeploySummary{Targets: 10, Required: 8, Success: 7, Pending: 3},
+			timedOut:    true,
+			wantFailure: "部署超时",
+		},
+		{
+			name:     "quorum reached at the deadline",
+			summary:  model.DeploySummary{Targets: 10, Required: 8, Success: 8, Pending: 2},
+			timedOut: true,
+			wantDone: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &DeployService{conf: cfg.DeployConf{MaxFailureRatio: tt.maxFailureRatio}}
+			done, failure := s.verdict(&tt.summary, tt.timedOut)
+			if done != tt.wantDone {
+				t.Fatalf("verdict() done = %v, want %v", done, tt.wantDone)
+			}
+			if tt.wantFailure == "" && failure != "" || !strings.Contains(failure, tt.wantFailure) {
+				t.Fatalf("verdict() failure = %q, want it to contain %q", failure, tt.wantFailure)
+			}
+		})
+	}
+}
+
+// TestRolledOutByNodeID 批次中记录的是节点名, 节点按 node_id 请求时需换算为节点名再匹配
+func TestRolledOutByNodeID(t *testing.T) {
+	bins := NewBinService()
+	bins.RegisterNode("a1b2c3", "x86_64", "Ubuntu 22.04", "edge-bj-01", "1.0")
+	bins.RegisterNode("d4e5f6", "x86_64", "Ubuntu 22.04", "edge-bj-02", "1.0")
+	bins.RegisterNode("g7h8i9", "x86_64", "Ubuntu 22.04", "", "1.0")
+
+	release := &model.Release{RolloutSteps: []model.RolloutStep{
+		{Index: 0, Nodes: []string{"edge-bj-01", "g7h8i9"}, Status: model.StageStatusCompleted},
+		{Index: 1, Nodes: []string{"edge-bj-02"}, Status: model.StageStatusPending},
+	}}
+	tests := []struct {
+		nodeID string
+		want   bool
+	}{
+		{nodeID: "a1b2c3", want: true},
+		{nodeID: "d4e5f6", want: false},
+		{nodeID: "g7h8i9", want: true},
+	}
+	for _, tt := range tests {
+		node, ok := bins.GetNode(tt.nodeID)
+		if !ok {
+			t.Fatalf("node %s not registered", tt.nodeID)
+		}
+		if got := rolledOut(release, nodeTarget(node)); got != tt.want {
+			t.Errorf("rolledOut(%s) = %v, want %v", tt.nodeID, got, tt.want)
+		}
+	}
+	if rolledOut(release, "a1b2c3") {
+		t.Error("a node id that differs from the node name should not match the rollout step")
+	}
+}
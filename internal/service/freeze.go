@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrFrozen        = errors.New("changes are frozen")
+	ErrInvalidFreeze = errors.New("invalid freeze window")
+)
+
+const (
+	FreezeActionReleaseCreate = "release.create"
+	FreezeActionReleaseDeploy = "release.deploy"
+	FreezeActionFullRelease   = "gray.full_release"
+	FreezeActionConfigChange  = "config.change"
+)
+
+// FreezeService 管理封版窗口, 封版期间的变更必须携带紧急原因, 并记录到 freeze_overrides
+type FreezeService struct {
+	windows   *mongo.Collection
+	overrides *mongo.Collection
+}
+
+func NewFreezeService(mongodb *db.MongoDB) *FreezeService {
+	return &FreezeService{
+		windows:   mongodb.Database.Collection("freeze_windows"),
+		overrides: mongodb.Database.Collection("freeze_overrides"),
+	}
+}
+
+// List activeOnly 为 true 时只返回尚未结束的窗口
+func (s *FreezeService) List(activeOnly bool) ([]*model.FreezeWindow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if activeOnly {
+		filter["endAt"] = bson.M{"$gt": time.Now()}
+	}
+
+	cursor, err := s.windows.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "startAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	windows := []*model.FreezeWindow{}
+	if err = cursor.All(ctx, &windows); err != nil {
+		return nil, err
+	}
+
+	return windows, nil
+}
+
+func (s *FreezeService) Get(id string) (*model.FreezeWindow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var window model.FreezeWindow
+	if err := s.windows.FindOne(ctx, bson.M{"_id": id}).Decode(&window); err != nil {
+		return nil, err
+	}
+
+	return &window, nil
+}
+
+func (s *FreezeService) Create(window *model.FreezeWindow) error {
+	if err := validateFreezeWindow(window); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	window.ID = primitive.NewObjectID().Hex()
+	window.CreatedAt = now
+	window.UpdatedAt = now
+
+	_, err := s.windows.InsertOne(ctx, window)
+	return err
+}
+
+func (s *FreezeService) Update(id string, window *model.FreezeWindow) error {
+	if err := validateFreezeWindow(window); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"name":        window.Name,
+		"projectId":   window.ProjectID,
+		"environment": window.Environment,
+		"startAt":     window.StartAt,
+		"endAt":       window.EndAt,
+		"reason":      window.Reason,
+		"updatedAt":   time.Now(),
+	}}
+	result, err := s.windows.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (s *FreezeService) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.windows.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func validateFreezeWindow(window *model.FreezeWindow) error {
+	if window.StartAt.IsZero() || window.EndAt.IsZero() {
+		return fmt.Errorf("%w: startAt and endAt are required", ErrInvalidFreeze)
+	}
+	if !window.EndAt.After(window.StartAt) {
+		return fmt.Errorf("%w: endAt must be after startAt", ErrInvalidFreeze)
+	}
+	return nil
+}
+
+// Active 返回 at 时刻对项目和环境生效的封版窗口, 多个窗口重叠时取结束最晚的
+func (s *FreezeService) Active(projectID, environment string, at time.Time) (*model.FreezeWindow, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"startAt":     bson.M{"$lte": at},
+		"endAt":       bson.M{"$gt": at},
+		"projectId":   bson.M{"$in": []string{"", projectID}},
+		"environment": bson.M{"$in": []string{"", environment}},
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "endAt", Value: -1}})
+
+	var window model.FreezeWindow
+	err := s.windows.FindOne(ctx, filter, opts).Decode(&window)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &window, nil
+}
+
+// Check 封版期间没有紧急原因时返回 ErrFrozen, 有紧急原因时放行并返回待记录的 override, 不在封版期间时返回 nil.
+// override 由调用方在变更成功后通过 RecordOverride 记录
+func (s *FreezeService) Check(projectID, environment, action, target, operator, overrideReason string) (*model.FreezeOverride, error) {
+	window, err := s.Active(projectID, environment, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if window == nil {
+		return nil, nil
+	}
+
+	if overrideReason == "" {
+		return nil, fmt.Errorf("%w by %q until %s: %s", ErrFrozen, window.Name, window.EndAt.Format(time.RFC3339), window.Reason)
+	}
+
+	return &model.FreezeOverride{
+		ID:          primitive.NewObjectID().Hex(),
+		FreezeID:    window.ID,
+		ProjectID:   projectID,
+		Environment: environment,
+		Action:      action,
+		Target:      target,
+		Operator:    operator,
+		Reason:      overrideReason,
+	}, nil
+}
+
+// RecordOverride 记录封版期间已完成的紧急变更
+func (s *FreezeService) RecordOverride(override *model.FreezeOverride) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	override.CreatedAt = time.Now()
+	if _, err := s.overrides.InsertOne(ctx, override); err != nil {
+		return err
+	}
+
+	log.Warn().Str("freezeId", override.FreezeID).Str("action", override.Action).Str("target", override.Target).
+		Str("operator", override.Operator).Str("reason", override.Reason).Msg("封版期间紧急变更")
+	return nil
+}
+
+func (s *FreezeService) ListOverrides(freezeID string) ([]*model.FreezeOverride, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if freezeID != "" {
+		filter["freezeId"] = freezeID
+	}
+
+	cursor, err := s.overrides.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	overrides := []*model.FreezeOverride{}
+	if err = cursor.All(ctx, &overrides); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
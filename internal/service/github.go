@@ -22,6 +22,8 @@ type GitMergeRequest struct {
 	CreateAt      *time.Time
 	MergeMessage  string // 本次合并的提交信息, 变更内容
 	ChangeModules string // 变更模块
+	WebURL        string
+	MergedAt      *time.Time
 }
 
 type GitHubMgr struct {
@@ -44,6 +46,10 @@ func NewGitHubClient(ctx context.Context, token string) *github.Client {
 }
 
 func NewGitHubMgr(conf cfg.GitHubConf) *GitHubMgr {
+	if conf.Owner == "" || conf.Repo == "" {
+		log.Warn().Msg("未配置 GitHub 仓库, 不启用 GitHub")
+		return nil
+	}
 	client := NewGitHubClient(context.Background(), conf.GitHubToken)
 	if client == nil {
 		log.Error().Msg("创建 GitHub 客户端失败")
@@ -132,3 +138,65 @@ func (s *GitHubMgr) GetGitHubPullRequest() map[string]*GitMergeRequest {
 	}
 	return mrMap
 }
+
+// MergedPullRequestsSince 返回 since 之后合并的 PR, since 为零值时只取最近 maxNotePages 页
+func (s *GitHubMgr) MergedPullRequestsSince(since time.Time) ([]*GitMergeRequest, error) {
+	opt := &github.PullRequestListOptions{
+		State:     "closed",
+		Sort:      "updated",
+		Direction: "desc",
+		ListOptions: github.ListOptions{
+			Page:    1,
+			PerPage: 100,
+		},
+	}
+
+	var merged []*GitMergeRequest
+	for page := 0; page < maxNotePages; page++ {
+		prs, resp, err := s.Client.PullRequests.List(context.Background(), s.Conf.Owner, s.Conf.Repo, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull requests: %w", err)
+		}
+
+		// 按更新时间倒序, 合并时间不晚于更新时间, 更新时间早于 since 即可停止
+		done := false
+		for _, pr := range prs {
+			if !since.IsZero() && pr.UpdatedAt != nil && pr.UpdatedAt.Before(since) {
+				done = true
+				break
+			}
+			if pr.MergedAt == nil || !pr.MergedAt.After(since) {
+				continue
+			}
+
+			giraId, changeModules, _ := ParseTitle(pr.GetTitle())
+			merged = append(merged, &GitMergeRequest{
+				GiraId:        giraId,
+				Pr:            pr,
+				GitId:         fmt.Sprint(pr.GetNumber()),
+				Title:         pr.GetTitle(),
+				Author:        pr.GetUser().GetLogin(),
+				CreateAt:      pr.CreatedAt,
+				MergeMessage:  pr.GetBody(),
+				ChangeModules: changeModules,
+				WebURL:        pr.GetHTMLURL(),
+				MergedAt:      pr.MergedAt,
+			})
+		}
+		if done || resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return merged, nil
+}
+
+// CommitSHA 返回仓库 ref (分支、标签或提交) 当前指向的提交
+func (s *GitHubMgr) CommitSHA(ctx context.Context, owner, repo, ref string) (string, error) {
+	sha, _, err := s.Client.Repositories.GetCommitSHA1(ctx, owner, repo, ref, "")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s of %s/%s: %w", ref, owner, repo, err)
+	}
+	return sha, nil
+}
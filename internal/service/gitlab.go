@@ -3,8 +3,10 @@ package service
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -203,7 +205,7 @@ func (s *GitLabMgr) GetFile(branch, filename string) {
 			Ref: &master,
 		})
 	if err != nil {
-		log.Logger.Err(err).Msgf("GetFile failed, branch: %s, %s, %s, %s", branch, filename)
+		log.Logger.Err(err).Msgf("GetFile failed, branch: %s, file: %s", branch, filename)
 		return
 	}
 
@@ -239,6 +241,83 @@ func (s *GitLabMgr) UpdateVersion(filename, newVersion string) {
 	s.CommitPush(branch, newVersion, newVersion)
 }
 
+// CommitVersion 新建分支并提交版本文件, 返回分支名
+func (s *GitLabMgr) CommitVersion(filename, newVersion string) (string, error) {
+	branch := s.CreateBranch("streamd")
+	if branch == "" {
+		return "", fmt.Errorf("failed to create branch")
+	}
+
+	updatedContent := fmt.Sprintf(`{"version": "%s"}`, newVersion)
+	_, _, err := s.Client.RepositoryFiles.UpdateFile(s.Conf.ProjectID,
+		filename,
+		&gitlab.UpdateFileOptions{
+			Branch:        &branch,
+			CommitMessage: &newVersion,
+			Content:       &updatedContent,
+		})
+	if err != nil {
+		log.Logger.Error().Msgf("Failed to update file: %v", err)
+		return "", err
+	}
+
+	return branch, nil
+}
+
+// GetVersion 读取 master 分支版本文件中的产物版本
+func (s *GitLabMgr) GetVersion(filename string) (string, error) {
+	master := "master"
+	file, resp, err := s.Client.RepositoryFiles.GetFile(
+		s.Conf.ProjectID,
+		filename,
+		&gitlab.GetFileOptions{
+			Ref: &master,
+		})
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", filename, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s from GitLab: %d", filename, resp.StatusCode)
+	}
+
+	// 文件内容为 base64 编码
+	decoded, err := base64.StdEncoding.DecodeString(file.Content)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s content: %w", filename, err)
+	}
+	log.Debug().Str("decoded", string(decoded)).Msgf("解析 %s 内容", filename)
+
+	var versionData struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(decoded, &versionData); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+
+	return versionData.Version, nil
+}
+
+// SetVersion 直接在 master 分支改写版本文件, 用于回滚等无需评审的场景
+func (s *GitLabMgr) SetVersion(filename, version, commitMessage string) error {
+	content := fmt.Sprintf(`{"version": "%s"}`, version)
+	return s.CreateOrUpdateFile(filename, content, "master", commitMessage)
+}
+
+// WebURL 将 GitLab 返回的链接替换为配置中的对外地址
+func (s *GitLabMgr) WebURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	base, err := url.Parse(s.Conf.GitLabURL)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	return u.String(), nil
+}
+
 func (s *GitLabMgr) GetMrUrl(expectedTitle string) string {
 	// 获取所有 MR 分类 map
 	mrMap := s.GetMergeRequest()
@@ -326,3 +405,65 @@ func (s *GitLabMgr) CreateMergeRequest(sourceBranch, targetBranch, title, descri
 	s.MrUrl = mr.WebURL
 	return mr.WebURL, nil
 }
+
+// MergedMergeRequestsSince 返回 since 之后合并的 MR, since 为零值时只取最近 maxNotePages 页
+func (s *GitLabMgr) MergedMergeRequestsSince(since time.Time) ([]*GitMergeRequest, error) {
+	opt := &gitlab.ListProjectMergeRequestsOptions{
+		State:   gitlab.Ptr("merged"),
+		OrderBy: gitlab.Ptr("updated_at"),
+		Sort:    gitlab.Ptr("desc"),
+		ListOptions: gitlab.ListOptions{
+			Page:    1,
+			PerPage: 100,
+		},
+	}
+	if !since.IsZero() {
+		opt.UpdatedAfter = &since
+	}
+
+	var merged []*GitMergeRequest
+	for page := 0; page < maxNotePages; page++ {
+		mrs, resp, err := s.Client.MergeRequests.ListProjectMergeRequests(s.Conf.ProjectID, opt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list merge requests: %w", err)
+		}
+
+		for _, mr := range mrs {
+			if mr.MergedAt == nil || !mr.MergedAt.After(since) {
+				continue
+			}
+
+			giraId, changeModules, _ := ParseTitle(mr.Title)
+			author := ""
+			if mr.Author != nil {
+				author = mr.Author.Username
+			}
+			merged = append(merged, &GitMergeRequest{
+				GiraId:        giraId,
+				GitId:         fmt.Sprint(mr.IID),
+				Title:         mr.Title,
+				Author:        author,
+				CreateAt:      mr.CreatedAt,
+				MergeMessage:  mr.Description,
+				ChangeModules: changeModules,
+				WebURL:        mr.WebURL,
+				MergedAt:      mr.MergedAt,
+			})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return merged, nil
+}
+
+// CommitSHA 返回项目 ref (分支、标签或提交) 当前指向的提交, project 为项目路径或 ID
+func (s *GitLabMgr) CommitSHA(ctx context.Context, project, ref string) (string, error) {
+	commit, _, err := s.Client.Commits.GetCommit(project, ref, nil, gitlab.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s of %s: %w", ref, project, err)
+	}
+	return commit.ID, nil
+}
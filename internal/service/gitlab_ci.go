@@ -0,0 +1,342 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+// defaultPipelineRef 构建参数中没有 BRANCH 时触发流水线的分支
+const defaultPipelineRef = "master"
+
+// GitLabCIBuilder 以 GitLab CI 流水线作为构建后端, 构建参数作为流水线变量传入,
+// 产物为流水线中各任务 artifacts 压缩包内的文件
+type GitLabCIBuilder struct {
+	client *gitlab.Client
+
+	mu   sync.Mutex
+	logs map[string]*pipelineLog
+}
+
+// pipelineLog 流水线日志的输出进度. 各任务的日志按任务 ID 顺序依次输出, 前一个任务结束后才输出
+// 下一个任务, 已输出的内容不再变化, 每次只需要拉取当前任务的日志
+type pipelineLog struct {
+	next    int64 // 已输出的字节数
+	job     int   // 当前任务在任务列表中的下标
+	started bool  // 是否已输出当前任务的任务头
+	written int   // 当前任务已输出的日志字节数
+}
+
+func NewGitLabCIBuilder(gitlabMgr *GitLabMgr) *GitLabCIBuilder {
+	return &GitLabCIBuilder{
+		client: gitlabMgr.Client,
+		logs:   make(map[string]*pipelineLog),
+	}
+}
+
+func (b *GitLabCIBuilder) Name() string {
+	return BuilderGitLabCI
+}
+
+// projectOf Job 为流水线所在的 GitLab 项目路径, 必须在构建配置中指定
+func projectOf(handle *model.BuildHandle) (string, error) {
+	if handle.Job == "" {
+		return "", fmt.Errorf("gitlab ci build requires the project path as job")
+	}
+	return handle.Job, nil
+}
+
+func pipelineID(handle *model.BuildHandle) (int, error) {
+	id, err := strconv.Atoi(handle.ID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid gitlab pipeline id %q", handle.ID)
+	}
+	return id, nil
+}
+
+func (b *GitLabCIBuilder) Start(ctx context.Context, req *BuildRequest) (*model.BuildHandle, error) {
+	handle := &model.BuildHandle{Builder: BuilderGitLabCI, Job: req.Job}
+	project, err := projectOf(handle)
+	if err != nil {
+		return nil, err
+	}
+	ref := req.Params["BRANCH"]
+	if ref == "" {
+		ref = defaultPipelineRef
+	}
+
+	variables := make([]*gitlab.PipelineVariableOptions, 0, len(req.Params))
+	for key, value := range req.Params {
+		variables = append(variables, &gitlab.PipelineVariableOptions{
+			Key:          gitlab.Ptr(key),
+			Value:        gitlab.Ptr(value),
+			VariableType: gitlab.Ptr(gitlab.EnvVariableType),
+		})
+	}
+
+	pipeline, _, err := b.client.Pipelines.CreatePipeline(project, &gitlab.CreatePipelineOptions{
+		Ref:       gitlab.Ptr(ref),
+		Variables: &variables,
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pipeline on %s: %w", ref, err)
+	}
+
+	handle.ID = strconv.Itoa(pipeline.ID)
+	handle.URL = pipeline.WebURL
+	return handle, nil
+}
+
+func (b *GitLabCIBuilder) Status(ctx context.Context, handle *model.BuildHandle) (*BuildState, error) {
+	project, err := projectOf(handle)
+	if err != nil {
+		return nil, err
+	}
+	id, err := pipelineID(handle)
+	if err != nil {
+		return nil, err
+	}
+	pipeline, _, err := b.client.Pipelines.GetPipeline(project, id, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	state := &BuildState{Result: pipeline.Status, URL: pipeline.WebURL}
+	switch pipeline.Status {
+	case "success":
+		state.Finished = true
+		state.Success = true
+	case "failed", "canceled", "skipped":
+		state.Finished = true
+	}
+	return state, nil
+}
+
+// jobs 返回流水线中的任务, 按任务 ID 排序
+func (b *GitLabCIBuilder) jobs(ctx context.Context, handle *model.BuildHandle) ([]*gitlab.Job, error) {
+	project, err := projectOf(handle)
+	if err != nil {
+		return nil, err
+	}
+	id, err := pipelineID(handle)
+	if err != nil {
+		return nil, err
+	}
+	jobs, _, err := b.client.Jobs.ListPipelineJobs(project, id, &gitlab.ListJobsOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+	}, gitlab.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, nil
+}
+
+// jobActive 任务是否还会产生日志
+func jobActive(status string) bool {
+	switch status {
+	case "created", "pending", "running", "waiting_for_resource", "preparing", "scheduled":
+		return true
+	}
+	return false
+}
+
+// jobStarted 任务是否已开始执行, 未开始的任务没有日志
+func jobStarted(status string) bool {
+	switch status {
+	case "created", "pending", "waiting_for_resource", "scheduled":
+		return false
+	}
+	return true
+}
+
+// Logs 按任务 ID 顺序输出各任务的日志, offset 为输出内容的字节偏移. 每个任务以 "==> 任务名" 开头,
+// 结束后输出 "==> 任务名 (状态)", 之后才输出下一个任务. 输出进度记录在 logs 中, 每次只拉取当前任务的日志;
+// offset 与记录的进度不一致时 (如 Manager 重启后) 从头重新生成并跳过 offset 之前的内容
+func (b *GitLabCIBuilder) Logs(ctx context.Context, handle *model.BuildHandle, offset int64) (*BuildLogChunk, error) {
+	project, err := projectOf(handle)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := b.jobs(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	key := project + "#" + handle.ID
+	b.mu.Lock()
+	state := b.logs[key]
+	b.mu.Unlock()
+	if state == nil || state.next != offset {
+		state = &pipelineLog{}
+	}
+
+	start := state.next
+	var text strings.Builder
+	for state.job < len(jobs) {
+		job := jobs[state.job]
+		if !state.started {
+			fmt.Fprintf(&text, "==> %s\n", job.Name)
+			state.started = true
+		}
+		if !jobStarted(job.Status) {
+			break
+		}
+
+		trace, _, err := b.client.Jobs.GetTraceFile(project, job.ID, gitlab.WithContext(ctx))
+		if err != nil {
+			break
+		}
+		data, err := io.ReadAll(trace)
+		if err != nil {
+			break
+		}
+		if len(data) > state.written {
+			text.Write(data[state.written:])
+			state.written = len(data)
+		}
+
+		if jobActive(job.Status) {
+			break
+		}
+		if state.written > 0 && data[len(data)-1] != '\n' {
+			text.WriteString("\n")
+		}
+		fmt.Fprintf(&text, "==> %s (%s)\n", job.Name, job.Status)
+		state.job++
+		state.started = false
+		state.written = 0
+	}
+	state.next += int64(text.Len())
+	more := state.job < len(jobs)
+
+	b.mu.Lock()
+	if more {
+		b.logs[key] = state
+	} else {
+		delete(b.logs, key)
+	}
+	b.mu.Unlock()
+
+	chunk := text.String()
+	if skip := offset - start; skip > 0 {
+		if skip > int64(len(chunk)) {
+			skip = int64(len(chunk))
+		}
+		chunk = chunk[skip:]
+	}
+	return &BuildLogChunk{
+		Text: chunk,
+		Next: state.next,
+		More: more,
+	}, nil
+}
+
+// artifactArchives 返回各任务的 artifacts 压缩包
+func (b *GitLabCIBuilder) artifactArchives(ctx context.Context, handle *model.BuildHandle) (map[string]*zip.Reader, error) {
+	project, err := projectOf(handle)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := b.jobs(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	archives := make(map[string]*zip.Reader)
+	for _, job := range jobs {
+		if job.ArtifactsFile.Filename == "" {
+			continue
+		}
+		reader, _, err := b.client.Jobs.GetJobArtifacts(project, job.ID, gitlab.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get artifacts of job %s: %w", job.Name, err)
+		}
+		archive, err := zip.NewReader(reader, reader.Size())
+		if err != nil {
+			return nil, fmt.Errorf("invalid artifacts archive of job %s: %w", job.Name, err)
+		}
+		archives[job.Name] = archive
+	}
+	return archives, nil
+}
+
+// Artifacts 产物名称为 任务名/压缩包内路径
+func (b *GitLabCIBuilder) Artifacts(ctx context.Context, handle *model.BuildHandle) ([]string, error) {
+	archives, err := b.artifactArchives(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for job, archive := range archives {
+		for _, file := range archive.File {
+			if !file.FileInfo().IsDir() {
+				names = append(names, job+"/"+file.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (b *GitLabCIBuilder) Download(ctx context.Context, handle *model.BuildHandle, name string, dir string) (string, error) {
+	archives, err := b.artifactArchives(ctx, handle)
+	if err != nil {
+		return "", err
+	}
+
+	job, file, _ := strings.Cut(name, "/")
+	archive, ok := archives[job]
+	if !ok {
+		return "", fmt.Errorf("artifact %s not found in pipeline %s", name, handle.ID)
+	}
+	for _, entry := range archive.File {
+		if entry.Name != file {
+			continue
+		}
+		src, err := entry.Open()
+		if err != nil {
+			return "", err
+		}
+		defer src.Close()
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", err
+		}
+		target := filepath.Join(dir, filepath.Base(file))
+		dst, err := os.Create(target)
+		if err != nil {
+			return "", err
+		}
+		defer dst.Close()
+		if _, err := io.Copy(dst, src); err != nil {
+			return "", err
+		}
+		return target, nil
+	}
+	return "", fmt.Errorf("artifact %s not found in pipeline %s", name, handle.ID)
+}
+
+func (b *GitLabCIBuilder) Cancel(ctx context.Context, handle *model.BuildHandle) error {
+	project, err := projectOf(handle)
+	if err != nil {
+		return err
+	}
+	id, err := pipelineID(handle)
+	if err != nil {
+		return err
+	}
+	_, _, err = b.client.Pipelines.CancelPipelineBuild(project, id, gitlab.WithContext(ctx))
+	return err
+}
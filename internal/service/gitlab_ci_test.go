@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+type fakeJob struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	trace  string
+}
+
+// fakePipeline 模拟流水线 1 的任务列表和任务日志, 记录每个任务日志的拉取次数
+type fakePipeline struct {
+	mu     sync.Mutex
+	jobs   []*fakeJob
+	traces map[int]int
+}
+
+func (p *fakePipeline) set(jobs ...*fakeJob) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.jobs = jobs
+}
+
+func (p *fakePipeline) traceRequests(jobID int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.traces[jobID]
+}
+
+func (p *fakePipeline) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if r.URL.Path == "/api/v4/projects/group/app/pipelines/1/jobs" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p.jobs)
+		return
+	}
+	for _, job := range p.jobs {
+		if strings.HasSuffix(r.URL.Path, fmt.Sprintf("/jobs/%d/trace", job.ID)) {
+			p.traces[job.ID]++
+			fmt.Fprint(w, job.trace)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func newFakeGitLabCIBuilder(t *testing.T) (*GitLabCIBuilder, *fakePipeline) {
+	t.Helper()
+	pipeline := &fakePipeline{traces: map[int]int{}}
+	server := httptest.NewServer(pipeline)
+	t.Cleanup(server.Close)
+
+	client, err := gitlab.NewClient("token", gitlab.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGitLabCIBuilder(&GitLabMgr{Client: client}), pipeline
+}
+
+func TestGitLabCIBuilderLogs(t *testing.T) {
+	builder, pipeline := newFakeGitLabCIBuilder(t)
+	handle := &model.BuildHandle{Builder: BuilderGitLabCI, Job: "group/app", ID: "1"}
+
+	steps := []struct {
+		name string
+		jobs []*fakeJob
+		text string
+		more bool
+	}{
+		{
+			name: "build running",
+			jobs: []*fakeJob{
+				{ID: 11, Name: "build", Status: "running", trace: "compile\n"},
+				{ID: 12, Name: "test", Status: "created"},
+			},
+			text: "==> build\ncompile\n",
+			more: true,
+		},
+		{
+			name: "build has more output",
+			jobs: []*fakeJob{
+				{ID: 11, Name: "build", Status: "running", trace: "compile\nlink\n"},
+				{ID: 12, Name: "test", Status: "pending"},
+			},
+			text: "link\n",
+			more: true,
+		},
+		{
+			name: "build finished without trailing newline and test started",
+			jobs: []*fakeJob{
+				{ID: 11, Name: "build", Status: "success", trace: "compile\nlink\ndone"},
+				{ID: 12, Name: "test", Status: "running", trace: "go test\n"},
+			},
+			text: "done\n==> build (success)\n==> test\ngo test\n",
+			more: true,
+		},
+		{
+			name: "test failed",
+			jobs: []*fakeJob{
+				{ID: 11, Name: "build", Status: "success", trace: "compile\nlink\ndone"},
+				{ID: 12, Name: "test", Status: "failed", trace: "go test\nFAIL\n"},
+			},
+			text: "FAIL\n==> test (failed)\n",
+			more: false,
+		},
+	}
+
+	var offset int64
+	var all strings.Builder
+	for _, step := range steps {
+		pipeline.set(step.jobs...)
+		chunk, err := builder.Logs(context.Background(), handle, offset)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if chunk.Text != step.text || chunk.More != step.more {
+			t.Fatalf("%s: Logs() = %q, more %v, want %q, more %v", step.name, chunk.Text, chunk.More, step.text, step.more)
+		}
+		all.WriteString(chunk.Text)
+		offset = chunk.Next
+	}
+	if offset != int64(all.Len()) {
+		t.Errorf("next offset = %d, want %d", offset, all.Len())
+	}
+	// build 结束后不再拉取它的日志
+	if build, test := pipeline.traceRequests(11), pipeline.traceRequests(12); build != 3 || test != 2 {
+		t.Errorf("trace requests: build %d, test %d, want 3 and 2", build, test)
+	}
+	if len(builder.logs) != 0 {
+		t.Errorf("log state of finished pipeline is kept: %v", builder.logs)
+	}
+
+	// Manager 重启后从归档文件大小继续, 只返回之后的内容
+	resumed, _ := newFakeGitLabCIBuilder(t)
+	resumed.client = builder.client
+	resume := int64(len("==> build\ncompile\n"))
+	chunk, err := resumed.Logs(context.Background(), handle, resume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := all.String()[resume:]; chunk.Text != want || chunk.Next != offset {
+		t.Errorf("resumed Logs() = %q, next %d, want %q, next %d", chunk.Text, chunk.Next, want, offset)
+	}
+}
+
+func TestGitLabCIBuilderRequiresProject(t *testing.T) {
+	builder, _ := newFakeGitLabCIBuilder(t)
+	_, err := builder.Start(context.Background(), &BuildRequest{Params: map[string]string{}})
+	if err == nil {
+		t.Fatal("Start() without a project path succeeded")
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxHealthEvidence 发布单上保留的失败探测条数
+const maxHealthEvidence = 20
+
+// healthTarget 一个健康检查地址, 地址中含 {node} 时按目标节点展开
+type healthTarget struct {
+	Node string
+	URL  string
+}
+
+func (s *DeployService) SetApplicationService(apps *ApplicationService) {
+	s.apps = apps
+}
+
+// healthTargets 发布单指定了应用时只检查该应用, 否则检查项目下所有配置了 HealthCheckURL 的应用
+func (s *DeployService) healthTargets(release *model.Release) []healthTarget {
+	if s.apps == nil {
+		return nil
+	}
+
+	var apps []*model.Application
+	if release.ApplicationID != "" {
+		app, err := s.apps.Get(release.ApplicationID)
+		if err != nil {
+			log.Warn().Err(err).Str("releaseId", release.ID).Str("applicationId", release.ApplicationID).Msg("查询应用失败, 跳过健康检查")
+			return nil
+		}
+		apps = append(apps, app)
+	} else {
+		list, err := s.apps.List(release.ProjectID)
+		if err != nil {
+			log.Warn().Err(err).Str("releaseId", release.ID).Msg("查询项目应用失败, 跳过健康检查")
+			return nil
+		}
+		apps = list
+	}
+
+	var targets []healthTarget
+	for _, app := range apps {
+		if app.HealthCheckURL == "" {
+			continue
+		}
+		if !strings.Contains(app.HealthCheckURL, "{node}") {
+			targets = append(targets, healthTarget{URL: app.HealthCheckURL})
+			continue
+		}
+		for _, node := range release.TargetNodes {
+			targets = append(targets, healthTarget{
+				Node: node,
+				URL:  strings.ReplaceAll(app.HealthCheckURL, "{node}", node),
+			})
+		}
+	}
+	return targets
+}
+
+// finish 部署达到完成条件后进入健康检查观察期, 没有可检查的地址时直接完成
+func (s *DeployService) finish(release *model.Release) error {
+	targets := s.healthTargets(release)
+	if len(targets) == 0 {
+		return s.releases.Complete(release.ID)
+	}
+
+	now := time.Now()
+	urls := make([]string, 0, len(targets))
+	for _, target := range targets {
+		urls = append(urls, target.URL)
+	}
+	result := &model.HealthCheckResult{
+		Status:    model.HealthCheckInProgress,
+		Targets:   urls,
+		StartedAt: now,
+		Until:     now.Add(time.Duration(s.conf.HealthCheckWindowSeconds) * time.Second),
+	}
+	ok, err := s.releases.StartHealthCheck(release.ID, result)
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := s.releases.UpdateStage(release.ID, model.StageDeploy, model.StageStatusCompleted); err != nil {
+		return err
+	}
+	if err := s.releases.UpdateStage(release.ID, model.StagePostCheck, model.StageStatusInProgress); err != nil {
+		return err
+	}
+
+	log.Info().Str("releaseId", release.ID).Strs("targets", urls).Time("until", result.Until).Msg("部署完成, 开始健康检查")
+	go s.runHealthCheck(release.ID, targets, result.Until)
+	return nil
+}
+
+// runHealthCheck 观察期内按间隔探测所有地址, 同一地址连续失败达到阈值即自动回滚,
+// 观察期结束仍未触发回滚则发布完成
+func (s *DeployService) runHealthCheck(releaseID string, targets []healthTarget, until time.Time) {
+	if _, running := s.healthChecks.LoadOrStore(releaseID, true); running {
+		return
+	}
+	defer s.healthChecks.Delete(releaseID)
+
+	ticker := time.NewTicker(time.Duration(s.conf.HealthCheckIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	consecutive := make(map[string]int, len(targets))
+	evidence := []model.HealthProbe{}
+	rounds, failures := 0, 0
+	for {
+		rounds++
+		for _, target := range targets {
+			probe := s.probe(target)
+			if probe.Healthy {
+				consecutive[target.URL] = 0
+				continue
+			}
+
+			failures++
+			consecutive[target.URL]++
+			evidence = append(evidence, probe)
+			if len(evidence) > maxHealthEvidence {
+				evidence = evidence[len(evidence)-maxHealthEvidence:]
+			}
+			log.Warn().Str("releaseId", releaseID).Str("url", probe.URL).Int("statusCode", probe.StatusCode).
+				Str("error", probe.Error).Int("consecutive", consecutive[target.URL]).Msg("健康检查探测失败")
+
+			if consecutive[target.URL] >= s.conf.HealthCheckFailureThreshold {
+				s.healthCheckFailed(releaseID, probe, consecutive[target.URL], rounds, failures, evidence)
+				return
+			}
+		}
+
+		ok, err := s.releases.UpdateHealthCheck(releaseID, bson.M{
+			"rounds":   rounds,
+			"failures": failures,
+			"evidence": evidence,
+		})
+		if err != nil {
+			log.Error().Err(err).Str("releaseId", releaseID).Msg("更新健康检查结果失败")
+		}
+		// 发布单已被人工回滚或失败, 停止检查
+		if err == nil && !ok {
+			return
+		}
+
+		if !time.Now().Before(until) {
+			s.healthCheckPassed(releaseID, rounds, failures)
+			return
+		}
+		<-ticker.C
+	}
+}
+
+func (s *DeployService) healthCheckPassed(releaseID string, rounds, failures int) {
+	ok, err := s.releases.UpdateHealthCheck(releaseID, bson.M{
+		"status":     model.HealthCheckPassed,
+		"finishedAt": time.Now(),
+		"rounds":     rounds,
+		"failures":   failures,
+	})
+	if err != nil || !ok {
+		if err != nil {
+			log.Error().Err(err).Str("releaseId", releaseID).Msg("更新健康检查结果失败")
+		}
+		return
+	}
+
+	log.Info().Str("releaseId", releaseID).Int("rounds", rounds).Msg("健康检查通过, 发布完成")
+	if err := s.releases.Complete(releaseID); err != nil {
+		log.Error().Err(err).Str("releaseId", releaseID).Msg("更新发布单状态失败")
+	}
+}
+
+// healthCheckFailed 记录失败证据后将发布单置为失败并回滚到上一个已完成发布
+func (s *DeployService) healthCheckFailed(releaseID string, last model.HealthProbe, consecutive, rounds, failures int, evidence []model.HealthProbe) {
+	ok, err := s.releases.UpdateHealthCheck(releaseID, bson.M{
+		"status":     model.HealthCheckFailed,
+		"finishedAt": time.Now(),
+		"rounds":     rounds,
+		"failures":   failures,
+		"evidence":   evidence,
+	})
+	if err != nil || !ok {
+		if err != nil {
+			log.Error().Err(err).Str("releaseId", releaseID).Msg("更新健康检查结果失败")
+		}
+		return
+	}
+
+	detail := last.Error
+	if detail == "" {
+		detail = fmt.Sprintf("HTTP %d", last.StatusCode)
+	}
+	reason := fmt.Sprintf("健康检查失败: %s 连续 %d 次探测失败, 最近一次 %s", last.URL, consecutive, detail)
+
+	rollback, err := s.releases.AutoRollback(releaseID, reason)
+	if err != nil {
+		log.Error().Err(err).Str("releaseId", releaseID).Msg("健康检查失败, 自动回滚失败")
+		return
+	}
+	log.Warn().Str("releaseId", releaseID).Str("rollbackId", rollback.ID).Str("reason", reason).Msg("健康检查失败, 已自动回滚")
+
+	if err := s.Track(rollback.ID); err != nil {
+		log.Error().Err(err).Str("releaseId", rollback.ID).Msg("跟踪回滚发布单失败")
+	}
+}
+
+// probe 2xx 和 3xx 视为健康
+func (s *DeployService) probe(target healthTarget) model.HealthProbe {
+	probe := model.HealthProbe{
+		Node:      target.Node,
+		URL:       target.URL,
+		CheckedAt: time.Now(),
+	}
+
+	resp, err := s.httpClient.Get(target.URL)
+	probe.LatencyMs = time.Since(probe.CheckedAt).Milliseconds()
+	if err != nil {
+		probe.Error = err.Error()
+		return probe
+	}
+	defer resp.Body.Close()
+
+	probe.StatusCode = resp.StatusCode
+	probe.Healthy = resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest
+	return probe
+}
+
+// resumeHealthCheck 进程重启后继续未结束的健康检查, 观察期已过时立即做最后一轮探测
+func (s *DeployService) resumeHealthCheck(release *model.Release) {
+	if _, running := s.healthChecks.Load(release.ID); running {
+		return
+	}
+
+	targets := s.healthTargets(release)
+	if len(targets) == 0 {
+		s.healthCheckPassed(release.ID, release.HealthCheck.Rounds, release.HealthCheck.Failures)
+		return
+	}
+	log.Info().Str("releaseId", release.ID).Time("until", release.HealthCheck.Until).Msg("继续未完成的健康检查")
+	go s.runHealthCheck(release.ID, targets, release.HealthCheck.Until)
+}
@@ -5,16 +5,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"path"
 	"strconv"
-	"strings"
-	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/bndr/gojenkins"
 	cfg "github.com/felix-001/qnHackathon/internal/config"
+	"github.com/felix-001/qnHackathon/internal/model"
 )
 
 type BuildResult struct {
@@ -118,23 +118,6 @@ func (s *JenkinsMgr) GetJenKinsBuilds() []*gojenkins.Build {
 	return successfulBuilds
 }
 
-func (s *JenkinsMgr) GetBuildParams(buildbin []string, goversion string) map[string][]string {
-	params := make(map[string][]string)
-	params["DESCRIPTION"] = []string{"自动发布线上服务"}
-	params["BRANCH"] = []string{"main"}
-	if goversion == "" {
-		goversion = "miku_go1.22.9"
-	}
-	params["GO_VERSION"] = []string{goversion}
-	params["BIN"] = buildbin
-	now := time.Now()
-	params["PACKAGE_NAME"] = []string{fmt.Sprintf("MIKUD_LIVE.%s.tar.gz", now.Format("2006-01-02-15-04-05"))}
-	params["REPORTED"] = []string{"false"}
-	params["TAG"] = []string{"origin/main"}
-
-	return params
-}
-
 func (s *JenkinsMgr) GetBuildQueryString() map[string]string {
 	querys := make(map[string]string)
 
@@ -146,24 +129,6 @@ func (s *JenkinsMgr) GetBuildQueryString() map[string]string {
 	return querys
 }
 
-func getGoVersion(buildbin []string) (version string) {
-	if len(buildbin) == 0 || len(buildbin) > 1 {
-		return ""
-	}
-	switch buildbin[0] {
-	case "streamd":
-		return "miku_go1.20.11"
-	case "collector":
-		return "miku_go1.23.4"
-	case "etlv2":
-		return "miku-ubuntu22.04_mvn"
-	case "sched", "netprobe-srv", "netprobe-cli", "agent", "lived":
-		return "miku_go1.22.9"
-	default:
-		return ""
-	}
-}
-
 func BuildJob(ctx context.Context, j *gojenkins.Job, params map[string][]string, querys map[string]string) (int64, error) {
 	endpoint := "/build?delay=0sec"
 	parameters, err := j.GetParameters(ctx)
@@ -206,240 +171,247 @@ func BuildJob(ctx context.Context, j *gojenkins.Job, params map[string][]string,
 	return number, nil
 }
 
-func (s *JenkinsMgr) BuildJenKinsBuildOne(buildbins []string) int64 {
-	goversion := getGoVersion(buildbins)
-	if goversion == "" {
-		return 0
-	}
-
-	// 需要单独构建的模块
-	params := s.GetBuildParams(buildbins, goversion)
-	// 执行构建
-	ctx := context.Background()
-	job, err := s.Client.GetJob(ctx, s.Conf.ProjectID)
-	if err != nil {
-		log.Logger.Error().Msgf("获取Job失败: %v", err)
-	}
-	buildid, err := BuildJob(ctx, job, params, s.GetBuildQueryString())
-	if buildid != 0 {
-		log.Logger.Info().Msgf("JenKins任务提交成功: %v, buildid: %d", params, buildid)
-	}
-
-	if buildid == 0 {
-		log.Logger.Error().Msgf("JenKins任务提交失败: %v, params: %+v, ", err, params)
-	}
-	return buildid
+func (s *JenkinsMgr) Name() string {
+	return BuilderJenkins
 }
 
-func (s *JenkinsMgr) BuildJenKinsBuild(module string) int64 {
-	buildid := s.BuildJenKinsBuildOne([]string{module})
-	if buildid != 0 {
-		log.Logger.Info().Msgf("Jenkins 任务提交成功: %s, buildid: %d", module, buildid)
-	} else {
-		log.Logger.Error().Msgf("Jenkins 任务提交失败: %s", module)
+func (s *JenkinsMgr) jobName(job string) string {
+	if job == "" {
+		return s.Conf.ProjectID
 	}
-	s.BuildidToModule = module
-	return buildid
+	return job
 }
 
-func (s *JenkinsMgr) GetBuildStatus(buildid int64) (isbuilding bool, buildmoreInfo *BuildResult) {
-	ctx := context.Background()
-	job, err := s.Client.GetJob(ctx, s.Conf.ProjectID)
+// Start 触发 Jenkins 任务, 返回的 ID 为队列项 ID
+func (s *JenkinsMgr) Start(ctx context.Context, req *BuildRequest) (*model.BuildHandle, error) {
+	name := s.jobName(req.Job)
+	job, err := s.Client.GetJob(ctx, name)
 	if err != nil {
-		log.Logger.Error().Msgf("获取Job失败: %v", err)
-		return false, nil
+		return nil, fmt.Errorf("failed to get jenkins job %s: %w", name, err)
 	}
 
-	buildidlst, err := job.GetAllBuildIds(ctx)
+	params := make(map[string][]string, len(req.Params))
+	for key, value := range req.Params {
+		params[key] = []string{value}
+	}
+	queueID, err := BuildJob(ctx, job, params, s.GetBuildQueryString())
 	if err != nil {
-		log.Logger.Error().Msgf("获取所有构建失败: %v", err)
-		return false, nil
+		return nil, fmt.Errorf("failed to build jenkins job %s: %w", name, err)
 	}
+	return &model.BuildHandle{
+		Builder: BuilderJenkins,
+		Job:     name,
+		ID:      strconv.FormatInt(queueID, 10),
+	}, nil
+}
 
-	for _, build := range buildidlst {
-		buildtask, err := job.GetBuild(ctx, build.Number)
-		if err != nil {
-			log.Logger.Error().Msgf("获取构建信息失败: %v, build: %d", err, build.Number)
-			continue
-		}
+// jenkinsQueueItem Jenkins 队列项, gojenkins 的 Task 没有 cancelled 字段
+type jenkinsQueueItem struct {
+	ID         int64  `json:"id"`
+	Cancelled  bool   `json:"cancelled"`
+	Why        string `json:"why"`
+	Executable *struct {
+		Number int64  `json:"number"`
+		URL    string `json:"url"`
+	} `json:"executable"`
+}
 
-		if buildtask.Raw.QueueID != buildid {
-			continue
-		}
+var errQueueItemCancelled = errors.New("jenkins queue item cancelled")
 
-		if buildtask.Raw.Building {
-			log.Logger.Info().Msgf("构建编号: %d, 正在构建中", buildtask.Raw.QueueID)
-			return true, nil
+// findBuild 第一次查询时通过队列项解析出构建号并记录到 handle 上, 之后直接按构建号查询.
+// 构建尚未开始时返回 nil
+func (s *JenkinsMgr) findBuild(ctx context.Context, handle *model.BuildHandle) (*gojenkins.Build, error) {
+	if handle.Number == 0 {
+		var item jenkinsQueueItem
+		resp, err := s.Client.Requester.GetJSON(ctx, "/queue/item/"+handle.ID, &item, nil)
+		if err != nil {
+			return nil, err
 		}
-
-		buildResult := &BuildResult{
-			BuildID:    buildtask.Raw.QueueID,
-			IsFinished: true,
-			BuildURL:   buildtask.GetUrl(),
-			Result:     buildtask.GetResult(),
-			Build:      buildtask,
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("jenkins queue item %s not found", handle.ID)
 		}
-
-		result := buildtask.GetResult()
-		if result != "SUCCESS" {
-			log.Logger.Error().Msgf("构建编号: %d, 构建失败, 结果: %s", buildtask.Raw.QueueID, result)
-			buildResult.BuildError = fmt.Errorf("构建编号: %d, 构建失败, 结果: %s", buildtask.Raw.QueueID, result)
-			return false, buildResult
+		if item.Cancelled {
+			return nil, errQueueItemCancelled
 		}
-
-		artifacts := buildtask.GetArtifacts()
-		if len(artifacts) == 0 {
-			log.Logger.Error().Msgf("构建编号: %d, 没有构建产物", buildtask.Raw.QueueID)
-			return false, buildResult
+		if item.Executable == nil || item.Executable.Number == 0 {
+			log.Logger.Debug().Str("queueId", handle.ID).Str("why", item.Why).Msg("Jenkins 构建排队中")
+			return nil, nil
 		}
+		handle.Number = item.Executable.Number
+		handle.URL = item.Executable.URL
+		log.Logger.Info().Str("queueId", handle.ID).Int64("number", handle.Number).Msg("Jenkins 队列项已开始构建")
+	}
 
-		buildResult.TarFileName = ""
-		buildResult.README = ""
-		for _, artifact := range artifacts {
-			log.Logger.Info().Msgf("构建编号: %d, 构建产物: %s", buildtask.Raw.QueueID, artifact.FileName)
-			if strings.HasSuffix(artifact.FileName, ".tar.gz") {
-				buildResult.TarFileName = artifact.FileName
-			}
-			if strings.HasSuffix(artifact.FileName, "README") {
-				readme, err := artifact.GetData(ctx)
-				if err != nil {
-					log.Logger.Error().Msgf("获取 README.md 内容失败: %v", err)
-				} else {
-					buildResult.README = string(readme)
-				}
-			}
-		}
-		buildResult.IsSuccess = true
+	return s.Client.GetBuild(ctx, s.jobName(handle.Job), handle.Number)
+}
 
-		log.Logger.Info().Msgf("Jenkins 构建 ID: %d, URL: %s, 状态: %t, 结果: %s, Building: %t, tar: %s, readme: %s",
-			buildtask.GetBuildNumber(), buildtask.GetUrl(), buildtask.IsGood(ctx), result,
-			buildtask.Raw.Building, buildResult.TarFileName, buildResult.README)
-		return buildtask.Raw.Building, buildResult
+func (s *JenkinsMgr) Status(ctx context.Context, handle *model.BuildHandle) (*BuildState, error) {
+	build, err := s.findBuild(ctx, handle)
+	if err == errQueueItemCancelled {
+		return &BuildState{Finished: true, Result: buildResultCancelled}, nil
+	}
+	if err != nil || build == nil {
+		return &BuildState{}, err
 	}
+	handle.URL = build.GetUrl()
 
-	return true, nil
+	if build.Raw.Building {
+		return &BuildState{URL: handle.URL}, nil
+	}
+	result := build.GetResult()
+	return &BuildState{
+		Finished: true,
+		Success:  result == "SUCCESS",
+		Result:   result,
+		URL:      handle.URL,
+	}, nil
 }
 
-func (s *JenkinsMgr) JenkBuild(module string) bool {
-	buildid := s.BuildJenKinsBuild(module)
-	start_time := time.Now()
-	jenTicker := time.NewTicker(1 * time.Minute) // 每分钟检查一次
-	defer func() {
-		log.Logger.Info().Msgf("停止Jenkins构建状态检查, time cost: %d ms", time.Since(start_time).Milliseconds())
-
-	}()
-	defer jenTicker.Stop()
-
-	for range jenTicker.C {
-		log.Logger.Info().Msgf("Checking buildids: %v, module: %s", buildid, module)
-		isrunning, buildret := s.GetBuildStatus(buildid)
-		if !isrunning && buildret != nil && buildret.IsSuccess {
-			s.Build = buildret
-			return true
-		}
-		if !isrunning {
-			log.Logger.Error().Msgf("build end, %d, module: %s", buildid, module)
-			if buildret != nil {
-				s.Build = buildret
-			}
-			return false
-		}
+func (s *JenkinsMgr) Logs(ctx context.Context, handle *model.BuildHandle, offset int64) (*BuildLogChunk, error) {
+	build, err := s.findBuild(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	if build == nil {
+		return &BuildLogChunk{Next: offset, More: true}, nil
+	}
 
-		log.Logger.Info().Msgf("Build %d for %s is still running.", buildid, module)
-		if time.Since(start_time) > 3*time.Hour {
-			// 发送告警
-			log.Logger.Error().Msgf("Builds for GitHub are still running after 3 hours, stopping checks.")
-			s.Build = &BuildResult{
-				BuildID:    buildid,
-				IsFinished: false,
-				Result:     "time too long",
-			}
-			break
-		}
+	console, err := build.GetConsoleOutputFromIndex(ctx, offset)
+	if err != nil {
+		return nil, err
 	}
-	return false
+	return &BuildLogChunk{
+		Text: console.Content,
+		Next: console.Offset,
+		More: console.HasMoreText,
+	}, nil
 }
 
-func (s *JenkinsMgr) StartJob() {
-	_, err := s.Client.BuildJob(context.Background(), "streamd", nil)
+func (s *JenkinsMgr) Artifacts(ctx context.Context, handle *model.BuildHandle) ([]string, error) {
+	build, err := s.findBuild(ctx, handle)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("BuildJob")
-		return
+		return nil, err
+	}
+	if build == nil {
+		return nil, fmt.Errorf("jenkins build for queue item %s not found", handle.ID)
 	}
+
+	var names []string
+	for _, artifact := range build.GetArtifacts() {
+		names = append(names, artifact.FileName)
+	}
+	return names, nil
 }
 
-func (s *JenkinsMgr) WaitForJobCompletion() *BuildResult {
-	ctx := context.Background()
-	job, err := s.Client.GetJob(ctx, s.Conf.ProjectID)
+func (s *JenkinsMgr) Download(ctx context.Context, handle *model.BuildHandle, name string, dir string) (string, error) {
+	build, err := s.findBuild(ctx, handle)
 	if err != nil {
-		log.Logger.Error().Err(err).Msg("Failed to get job")
-		return nil
+		return "", err
+	}
+	if build == nil {
+		return "", fmt.Errorf("jenkins build for queue item %s not found", handle.ID)
 	}
 
-	startTime := time.Now()
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		lastBuild, err := job.GetLastBuild(ctx)
-		if err != nil {
-			log.Logger.Error().Err(err).Msg("Failed to get last build")
+	for _, artifact := range build.GetArtifacts() {
+		if artifact.FileName != name {
 			continue
 		}
-
-		if lastBuild.IsRunning(ctx) {
-			log.Logger.Info().Msgf("Build %d is still running...", lastBuild.GetBuildNumber())
-		} else {
-			isBuilding, buildResult := s.GetBuildStatus(lastBuild.Raw.QueueID)
-			if !isBuilding && buildResult != nil && buildResult.IsFinished {
-				if buildResult.IsSuccess {
-					log.Logger.Info().Msgf("Build completed successfully: %d", buildResult.BuildID)
-					return buildResult
-				}
-				log.Logger.Error().Msgf("Build failed: %v", buildResult.BuildError)
-				return buildResult
-			} else {
-				log.Logger.Info().Bool("isBuilding", isBuilding).Any("buildResult", buildResult).Msg("WaitForJobCompletion")
-			}
+		success, err := artifact.SaveToDir(ctx, dir)
+		if err != nil {
+			return "", fmt.Errorf("failed to save artifact: %w", err)
 		}
-
-		if time.Since(startTime) > 3*time.Hour {
-			log.Logger.Error().Msg("Build timeout after 3 hours")
-			return &BuildResult{
-				IsFinished: true,
-				IsSuccess:  false,
-				Result:     "timeout",
-			}
+		if !success {
+			return "", fmt.Errorf("failed to save artifact: unknown error")
 		}
+		return path.Join(dir, artifact.FileName), nil
+	}
+	return "", fmt.Errorf("artifact %s not found in jenkins build %s", name, build.GetUrl())
+}
+
+// Cancel 构建已开始时停止构建, 仍在队列中时取消队列项
+func (s *JenkinsMgr) Cancel(ctx context.Context, handle *model.BuildHandle) error {
+	build, err := s.findBuild(ctx, handle)
+	if err == errQueueItemCancelled {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if build != nil {
+		_, err := build.Stop(ctx)
+		return err
+	}
+
+	queueID, _ := strconv.ParseInt(handle.ID, 10, 64)
+	task, err := s.Client.GetQueueItem(ctx, queueID)
+	if err != nil {
+		return err
 	}
+	_, err = task.Cancel(ctx)
+	return err
+}
+
+// JenkinsNotification Jenkins Notification 插件的回调内容 (JSON 格式)
+type JenkinsNotification struct {
+	Name  string                   `json:"name"`
+	URL   string                   `json:"url"`
+	Build JenkinsNotificationBuild `json:"build"`
+}
 
-	return nil
+type JenkinsNotificationBuild struct {
+	FullURL string `json:"full_url"`
+	Number  int64  `json:"number"`
+	QueueID int64  `json:"queue_id"`
+	Phase   string `json:"phase"` // QUEUED, STARTED, COMPLETED, FINALIZED
+	Status  string `json:"status"`
 }
 
-func (s *JenkinsMgr) DownloadBin(buildResult *BuildResult, filename string) (string, error) {
-	if buildResult == nil || buildResult.Build == nil {
-		return "", fmt.Errorf("invalid build result")
+// HandleJenkinsNotification 将 Jenkins 的构建通知匹配到未结束的发布单构建, 优先按队列项 ID 匹配, 其次按任务名和构建号.
+// 匹配到时保存构建号并唤醒等待该构建的协程立即查询状态, 没有匹配时返回 nil
+func (m *Manager) HandleJenkinsNotification(releases *ReleaseService, n *JenkinsNotification) (*model.Release, error) {
+	queueID := ""
+	if n.Build.QueueID != 0 {
+		queueID = strconv.FormatInt(n.Build.QueueID, 10)
+	}
+	candidates, err := releases.FindPendingBuilds(BuilderJenkins, queueID, n.Build.Number)
+	if err != nil {
+		return nil, err
 	}
 
-	ctx := context.Background()
-	artifacts := buildResult.Build.GetArtifacts()
-
-	for _, artifact := range artifacts {
-		if strings.Contains(artifact.FileName, filename) {
-			downloadDir := "./downloads"
-			success, err := artifact.SaveToDir(ctx, downloadDir)
-			if err != nil {
-				return "", fmt.Errorf("failed to save artifact: %w", err)
-			}
-			if !success {
-				return "", fmt.Errorf("failed to save artifact: unknown error")
-			}
+	var release *model.Release
+	for _, candidate := range candidates {
+		handle := candidate.Build
+		if queueID != "" && handle.ID == queueID {
+			release = candidate
+			break
+		}
+		if n.Build.Number != 0 && handle.Number == n.Build.Number && path.Base(handle.Job) == n.Name {
+			release = candidate
+		}
+	}
+	if release == nil {
+		log.Logger.Debug().Str("job", n.Name).Int64("number", n.Build.Number).Str("phase", n.Build.Phase).Msg("Jenkins 通知没有匹配的发布单构建")
+		return nil, nil
+	}
 
-			downloadPath := fmt.Sprintf("%s/%s", downloadDir, artifact.FileName)
-			log.Logger.Info().Msgf("Successfully downloaded streamd to: %s", downloadPath)
-			return downloadPath, nil
+	handle := release.Build
+	if handle.Number == 0 && n.Build.Number != 0 {
+		handle.Number = n.Build.Number
+		handle.URL = n.Build.FullURL
+		if err := releases.UpdateBuild(release.ID, handle); err != nil {
+			return nil, err
 		}
 	}
 
-	return "", fmt.Errorf("streamd artifact not found in build")
+	line := fmt.Sprintf("Jenkins 通知: %s #%d %s", n.Name, n.Build.Number, n.Build.Phase)
+	if n.Build.Status != "" {
+		line += " " + n.Build.Status
+	}
+	releases.Publish(StreamEventBuildLog, release.ID, map[string]string{"line": line})
+
+	if !m.waiters.notify(BuilderJenkins, handle.ID) {
+		log.Logger.Info().Str("releaseId", release.ID).Str("queueId", handle.ID).Msg("构建不在本实例等待, 由兜底轮询更新状态")
+	}
+	log.Logger.Info().Str("releaseId", release.ID).Int64("number", n.Build.Number).Str("phase", n.Build.Phase).Msg("收到 Jenkins 构建通知")
+	return release, nil
 }
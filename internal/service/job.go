@@ -0,0 +1,435 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultJobMaxAttempts = 3
+	jobVisibilityTimeout  = time.Minute
+	jobPollInterval       = 2 * time.Second
+	jobBaseBackoff        = 30 * time.Second
+	jobMaxBackoff         = 10 * time.Minute
+	jobMaxConcurrency     = 4
+)
+
+// JobRunFunc 执行任务, 返回的 map 会保存为任务结果
+type JobRunFunc func(ctx context.Context, job *model.Job) (map[string]string, error)
+
+// JobFailedFunc 任务重试耗尽后回调
+type JobFailedFunc func(job *model.Job)
+
+type jobHandler struct {
+	run      JobRunFunc
+	onFailed JobFailedFunc
+}
+
+// JobService 基于 MongoDB 的任务队列:
+// 任务被领取后持有 jobVisibilityTimeout 的租约, 执行期间定期续约;
+// 进程退出后租约过期, 任务会被重新领取, 因此重启后未完成的任务会自动恢复
+type JobService struct {
+	collection *mongo.Collection
+	handlers   map[string]jobHandler
+	workerID   string
+	sem        chan struct{}
+	mu         sync.RWMutex
+
+	runningMu sync.Mutex
+	running   map[string]context.CancelFunc
+}
+
+func NewJobService(mongodb *db.MongoDB) *JobService {
+	hostname, _ := os.Hostname()
+	return &JobService{
+		collection: mongodb.Database.Collection("jobs"),
+		handlers:   make(map[string]jobHandler),
+		workerID:   fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), primitive.NewObjectID().Hex()),
+		sem:        make(chan struct{}, jobMaxConcurrency),
+		running:    make(map[string]context.CancelFunc),
+	}
+}
+
+func (s *JobService) Register(jobType string, run JobRunFunc, onFailed JobFailedFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[jobType] = jobHandler{run: run, onFailed: onFailed}
+}
+
+// Enqueue 任务入队, 调用方指定的任务 ID 已存在时视为已入队, 用于下游任务去重
+func (s *JobService) Enqueue(job *model.Job) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	if job.ID == "" {
+		job.ID = primitive.NewObjectID().Hex()
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = defaultJobMaxAttempts
+	}
+	job.Status = model.JobStatusPending
+	job.Attempts = 0
+	job.NextRunAt = now
+	job.LockedUntil = now
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	_, err := s.collection.InsertOne(ctx, job)
+	if mongo.IsDuplicateKeyError(err) {
+		log.Info().Str("jobId", job.ID).Str("type", job.Type).Str("releaseId", job.ReleaseID).Msg("任务已存在, 跳过入队")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("jobId", job.ID).Str("type", job.Type).Str("releaseId", job.ReleaseID).Msg("任务已入队")
+	return nil
+}
+
+// downstreamJobID 下游任务的 ID 由上游任务 ID 和任务类型确定,
+// 上游任务入队下游后、标记成功前进程退出时, 重新执行不会重复入队
+func downstreamJobID(parent *model.Job, jobType string) string {
+	return parent.ID + "-" + jobType
+}
+
+func (s *JobService) Get(id string) (*model.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var job model.Job
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (s *JobService) ListByRelease(releaseID string) ([]*model.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"releaseId": releaseID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	jobs := []*model.Job{}
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// Cancel 取消发布单指定类型的未完成任务, 返回取消的任务数.
+// 本进程执行中的任务立即取消其 ctx, 其他进程执行中的任务在下次续约失败时取消
+func (s *JobService) Cancel(releaseID, jobType string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"releaseId": releaseID,
+		"type":      jobType,
+		"status":    bson.M{"$in": []string{model.JobStatusPending, model.JobStatusRunning}},
+	}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var jobs []*model.Job
+	if err = cursor.All(ctx, &jobs); err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	now := time.Now()
+	for _, job := range jobs {
+		filter["_id"] = job.ID
+		result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+			"status":     model.JobStatusCancelled,
+			"lastError":  "cancelled",
+			"finishedAt": now,
+			"updatedAt":  now,
+		}})
+		if err != nil {
+			return cancelled, err
+		}
+		if result.MatchedCount == 0 {
+			continue
+		}
+		cancelled++
+
+		s.runningMu.Lock()
+		if cancelRun, ok := s.running[job.ID]; ok {
+			cancelRun()
+		}
+		s.runningMu.Unlock()
+		log.Info().Str("jobId", job.ID).Str("type", jobType).Str("releaseId", releaseID).Msg("任务已取消")
+	}
+	return cancelled, nil
+}
+
+// Start 启动任务轮询, ctx 取消后停止领取新任务
+func (s *JobService) Start(ctx context.Context) {
+	s.logUnfinished()
+
+	go func() {
+		ticker := time.NewTicker(jobPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.dispatch(ctx)
+			}
+		}
+	}()
+}
+
+func (s *JobService) logUnfinished() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := s.collection.CountDocuments(ctx, bson.M{
+		"status": bson.M{"$in": []string{model.JobStatusPending, model.JobStatusRunning}},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("统计未完成任务失败")
+		return
+	}
+	if count > 0 {
+		log.Info().Int64("count", count).Msg("发现未完成任务, 租约过期后将恢复执行")
+	}
+}
+
+func (s *JobService) dispatch(ctx context.Context) {
+	for {
+		select {
+		case s.sem <- struct{}{}:
+		default:
+			return
+		}
+
+		job, err := s.claim()
+		if err != nil || job == nil {
+			<-s.sem
+			if err != nil {
+				log.Error().Err(err).Msg("领取任务失败")
+			}
+			return
+		}
+
+		go func() {
+			defer func() { <-s.sem }()
+			s.execute(ctx, job)
+		}()
+	}
+}
+
+func (s *JobService) jobTypes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	types := make([]string, 0, len(s.handlers))
+	for t := range s.handlers {
+		types = append(types, t)
+	}
+	return types
+}
+
+func (s *JobService) handler(jobType string) (jobHandler, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.handlers[jobType]
+	return h, ok
+}
+
+// claim 领取一个到期的待执行任务或租约已过期的运行中任务
+func (s *JobService) claim() (*model.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"type": bson.M{"$in": s.jobTypes()},
+		"$or": []bson.M{
+			{"status": model.JobStatusPending, "nextRunAt": bson.M{"$lte": now}},
+			{"status": model.JobStatusRunning, "lockedUntil": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"status":      model.JobStatusRunning,
+			"workerId":    s.workerID,
+			"lockedUntil": now.Add(jobVisibilityTimeout),
+			"updatedAt":   now,
+		},
+		"$inc": bson.M{"attempts": 1},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextRunAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var job model.Job
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (s *JobService) execute(ctx context.Context, job *model.Job) {
+	h, ok := s.handler(job.Type)
+	if !ok {
+		return
+	}
+
+	if job.Attempts > job.MaxAttempts {
+		s.fail(job, h, fmt.Errorf("exceeded max attempts %d", job.MaxAttempts))
+		return
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.heartbeat(runCtx, cancel, job.ID)
+
+	s.runningMu.Lock()
+	s.running[job.ID] = cancel
+	s.runningMu.Unlock()
+	defer func() {
+		s.runningMu.Lock()
+		delete(s.running, job.ID)
+		s.runningMu.Unlock()
+	}()
+
+	log.Info().Str("jobId", job.ID).Str("type", job.Type).Int("attempt", job.Attempts).Msg("开始执行任务")
+	result, err := h.run(runCtx, job)
+	if err != nil {
+		log.Error().Err(err).Str("jobId", job.ID).Str("type", job.Type).Int("attempt", job.Attempts).Msg("任务执行失败")
+		if job.Attempts >= job.MaxAttempts {
+			s.fail(job, h, err)
+			return
+		}
+		s.retry(job, err)
+		return
+	}
+
+	s.succeed(job, result)
+}
+
+// heartbeat 定期续约, 续约失败说明任务已被其他 worker 领取或已被取消, 取消当前执行
+func (s *JobService) heartbeat(ctx context.Context, cancel context.CancelFunc, jobID string) {
+	ticker := time.NewTicker(jobVisibilityTimeout / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			updateCtx, updateCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			result, err := s.collection.UpdateOne(updateCtx,
+				bson.M{"_id": jobID, "workerId": s.workerID, "status": model.JobStatusRunning},
+				bson.M{"$set": bson.M{"lockedUntil": time.Now().Add(jobVisibilityTimeout)}})
+			updateCancel()
+			if err != nil {
+				log.Error().Err(err).Str("jobId", jobID).Msg("任务续约失败")
+				continue
+			}
+			if result.MatchedCount == 0 {
+				log.Warn().Str("jobId", jobID).Msg("任务租约已丢失, 停止执行")
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+func (s *JobService) finish(jobID string, set bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set["updatedAt"] = time.Now()
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": jobID, "workerId": s.workerID, "status": model.JobStatusRunning},
+		bson.M{"$set": set})
+	return err
+}
+
+func (s *JobService) succeed(job *model.Job, result map[string]string) {
+	now := time.Now()
+	err := s.finish(job.ID, bson.M{
+		"status":     model.JobStatusSucceeded,
+		"result":     result,
+		"lastError":  "",
+		"finishedAt": now,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("jobId", job.ID).Msg("更新任务状态失败")
+		return
+	}
+	log.Info().Str("jobId", job.ID).Str("type", job.Type).Msg("任务执行成功")
+}
+
+func (s *JobService) retry(job *model.Job, cause error) {
+	err := s.finish(job.ID, bson.M{
+		"status":    model.JobStatusPending,
+		"lastError": cause.Error(),
+		"nextRunAt": time.Now().Add(jobBackoff(job.Attempts)),
+	})
+	if err != nil {
+		log.Error().Err(err).Str("jobId", job.ID).Msg("更新任务状态失败")
+	}
+}
+
+func (s *JobService) fail(job *model.Job, h jobHandler, cause error) {
+	now := time.Now()
+	err := s.finish(job.ID, bson.M{
+		"status":     model.JobStatusFailed,
+		"lastError":  cause.Error(),
+		"finishedAt": now,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("jobId", job.ID).Msg("更新任务状态失败")
+		return
+	}
+
+	job.Status = model.JobStatusFailed
+	job.LastError = cause.Error()
+	if h.onFailed != nil {
+		h.onFailed(job)
+	}
+}
+
+// jobBackoff 指数退避: 30s, 60s, 120s ... 最长 10 分钟
+func jobBackoff(attempts int) time.Duration {
+	backoff := jobBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= jobMaxBackoff {
+			return jobMaxBackoff
+		}
+	}
+	return backoff
+}
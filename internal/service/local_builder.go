@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	cfg "github.com/felix-001/qnHackathon/internal/config"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	localBuildLog    = "build.log"
+	localBuildResult = "result"
+	localArtifactDir = "artifacts"
+)
+
+// LocalBuilder 在 Manager 所在机器上执行构建命令, 每次构建有独立目录:
+// build.log 为命令输出, artifacts/ 为产物, result 为结束后的构建结果
+type LocalBuilder struct {
+	conf cfg.LocalBuildConf
+
+	mu      sync.Mutex
+	running map[string]*exec.Cmd
+}
+
+func NewLocalBuilder(conf cfg.LocalBuildConf) *LocalBuilder {
+	if conf.Dir == "" {
+		conf.Dir = "builds"
+	}
+	return &LocalBuilder{
+		conf:    conf,
+		running: make(map[string]*exec.Cmd),
+	}
+}
+
+func (b *LocalBuilder) Name() string {
+	return BuilderLocal
+}
+
+func (b *LocalBuilder) buildDir(handle *model.BuildHandle) string {
+	return filepath.Join(b.conf.Dir, filepath.Base(handle.ID))
+}
+
+// localBuildEnv 本地构建以环境变量传入的构建变量, 命令行中不代入变量
+func localBuildEnv(variables map[string]string) map[string]string {
+	return map[string]string{
+		"VERSION":   variables["version"],
+		"BRANCH":    variables["branch"],
+		"COMMIT":    variables["commit"],
+		"MODULE":    variables["module"],
+		"TOOLCHAIN": variables["toolchain"],
+	}
+}
+
+// ValidateLocalBuildJob 构建配置的本地命令按空白拆分为参数直接执行, 不经过 shell, 也不能使用模板变量
+func ValidateLocalBuildJob(job string) error {
+	if match := buildVariablePattern.FindString(job); match != "" {
+		return fmt.Errorf("%w: local build job must not use %s, read $VERSION $BRANCH $COMMIT $MODULE $TOOLCHAIN from the environment",
+			ErrInvalidBuildProfile, match)
+	}
+	return nil
+}
+
+// localCommand Job 为构建配置中的命令, 按空白拆分后直接执行; 为空时以 sh -c 执行 Manager 配置的命令
+func (b *LocalBuilder) localCommand(job string) (*exec.Cmd, error) {
+	if job == "" {
+		if b.conf.Command == "" {
+			return nil, fmt.Errorf("local build command is not configured")
+		}
+		return exec.Command("sh", "-c", b.conf.Command), nil
+	}
+	if err := ValidateLocalBuildJob(job); err != nil {
+		return nil, err
+	}
+	args := strings.Fields(job)
+	return exec.Command(args[0], args[1:]...), nil
+}
+
+// Start 执行 Job 指定的命令, 为空时执行配置的命令, 构建变量和参数以环境变量传入
+func (b *LocalBuilder) Start(ctx context.Context, req *BuildRequest) (*model.BuildHandle, error) {
+	// 构建进程不跟随任务的 ctx, 由 Cancel 结束
+	cmd, err := b.localCommand(strings.TrimSpace(req.Job))
+	if err != nil {
+		return nil, err
+	}
+	handle := &model.BuildHandle{
+		Builder: BuilderLocal,
+		Job:     req.Job,
+		ID:      fmt.Sprintf("%s-%d", req.ReleaseID, time.Now().UnixNano()),
+	}
+
+	dir, err := filepath.Abs(b.buildDir(handle))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, localArtifactDir), 0755); err != nil {
+		return nil, err
+	}
+	logFile, err := os.Create(filepath.Join(dir, localBuildLog))
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Dir = b.conf.WorkDir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Env = append(os.Environ(),
+		"RELEASE_ID="+req.ReleaseID,
+		"PROJECT_ID="+req.ProjectID,
+		"ARTIFACT_DIR="+filepath.Join(dir, localArtifactDir),
+	)
+	for key, value := range req.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	for key, value := range req.Params {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, fmt.Errorf("failed to start build command: %w", err)
+	}
+
+	b.mu.Lock()
+	b.running[handle.ID] = cmd
+	b.mu.Unlock()
+
+	go func() {
+		err := cmd.Wait()
+		logFile.Close()
+
+		result := "SUCCESS"
+		if err != nil {
+			result = "FAILURE"
+			if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				result = "ABORTED"
+			}
+		}
+		if err := os.WriteFile(filepath.Join(dir, localBuildResult), []byte(result), 0644); err != nil {
+			log.Error().Err(err).Str("build", handle.ID).Msg("保存本地构建结果失败")
+		}
+
+		b.mu.Lock()
+		delete(b.running, handle.ID)
+		b.mu.Unlock()
+		log.Info().Str("build", handle.ID).Str("result", result).Msg("本地构建结束")
+	}()
+
+	return handle, nil
+}
+
+func (b *LocalBuilder) Status(ctx context.Context, handle *model.BuildHandle) (*BuildState, error) {
+	b.mu.Lock()
+	_, running := b.running[handle.ID]
+	b.mu.Unlock()
+	if running {
+		return &BuildState{}, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.buildDir(handle), localBuildResult))
+	if os.IsNotExist(err) {
+		// 没有结果也不在运行, 说明构建期间 Manager 重启过
+		return &BuildState{Finished: true, Result: "LOST"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := strings.TrimSpace(string(data))
+	return &BuildState{
+		Finished: true,
+		Success:  result == "SUCCESS",
+		Result:   result,
+	}, nil
+}
+
+func (b *LocalBuilder) Logs(ctx context.Context, handle *model.BuildHandle, offset int64) (*BuildLogChunk, error) {
+	file, err := os.Open(filepath.Join(b.buildDir(handle), localBuildLog))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := b.Status(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	return &BuildLogChunk{
+		Text: string(data),
+		Next: offset + int64(len(data)),
+		More: !state.Finished,
+	}, nil
+}
+
+// Artifacts 返回 artifacts 目录下的文件, 名称为相对路径
+func (b *LocalBuilder) Artifacts(ctx context.Context, handle *model.BuildHandle) ([]string, error) {
+	root := filepath.Join(b.buildDir(handle), localArtifactDir)
+	var names []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (b *LocalBuilder) Download(ctx context.Context, handle *model.BuildHandle, name string, dir string) (string, error) {
+	root := filepath.Join(b.buildDir(handle), localArtifactDir)
+	src, err := os.Open(filepath.Join(root, filepath.Clean("/"+name)))
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, filepath.Base(name))
+	dst, err := os.Create(target)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// Cancel 结束构建命令及其子进程
+func (b *LocalBuilder) Cancel(ctx context.Context, handle *model.BuildHandle) error {
+	b.mu.Lock()
+	cmd, ok := b.running[handle.ID]
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
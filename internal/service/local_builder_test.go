@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/felix-001/qnHackathon/internal/config"
+	"github.com/felix-001/qnHackathon/internal/model"
+)
+
+func TestRenderBuildProfileVariables(t *testing.T) {
+	m := &Manager{}
+	profile := &model.BuildProfile{
+		Job:              "make release",
+		Params:           map[string]string{"VERSION": "{version}"},
+		ArtifactPatterns: []string{"app-{version}"},
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		version string
+		branch  string
+		wantErr bool
+	}{
+		{name: "plain version", version: "v1.2.3", wantErr: false},
+		{name: "version with build metadata", version: "1.2.3-rc.1+build_7", wantErr: false},
+		{name: "branch with slash", version: "v1.2.3", branch: "release/1.2", wantErr: false},
+		{name: "shell command substitution", version: "v1$(id)", wantErr: true},
+		{name: "command separator", version: "v1;rm -rf /", wantErr: true},
+		{name: "backtick", version: "v1`id`", wantErr: true},
+		{name: "whitespace", version: "v1 2", wantErr: true},
+		{name: "leading dash", version: "--help", wantErr: true},
+		{name: "branch with quote", version: "v1", branch: "main'", wantErr: true},
+		{name: "branch with newline", version: "v1", branch: "main\nid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile.Branch = tt.branch
+			release := &model.Release{ID: "r1", Version: tt.version}
+			_, err := m.renderBuildProfile(profile, release, BuilderJenkins, "", now)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("renderBuildProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidBuildVariable) {
+				t.Errorf("error %v is not ErrInvalidBuildVariable", err)
+			}
+		})
+	}
+}
+
+func TestRenderBuildProfileLocal(t *testing.T) {
+	m := &Manager{}
+	profile := &model.BuildProfile{
+		Job:              "make release",
+		Module:           "streamd",
+		ArtifactPatterns: []string{"streamd-{version}"},
+	}
+	release := &model.Release{ID: "r1", Version: "v1.2.3"}
+
+	rendered, err := m.renderBuildProfile(profile, release, BuilderLocal, "abc123", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Job != "make release" {
+		t.Errorf("Job = %q, want the command as configured", rendered.Job)
+	}
+	for key, want := range map[string]string{"VERSION": "v1.2.3", "BRANCH": defaultBuildBranch, "COMMIT": "abc123", "MODULE": "streamd"} {
+		if rendered.Env[key] != want {
+			t.Errorf("Env[%s] = %q, want %q", key, rendered.Env[key], want)
+		}
+	}
+}
+
+func TestValidateLocalBuildJob(t *testing.T) {
+	tests := []struct {
+		job     string
+		wantErr bool
+	}{
+		{job: "", wantErr: false},
+		{job: "make release", wantErr: false},
+		{job: "./build.sh --arch amd64", wantErr: false},
+		{job: "make VERSION={version}", wantErr: true},
+		{job: "git checkout {branch}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.job, func(t *testing.T) {
+			if err := ValidateLocalBuildJob(tt.job); tt.wantErr != (err != nil) {
+				t.Errorf("ValidateLocalBuildJob(%q) error = %v, wantErr %v", tt.job, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestLocalBuilderNoShell 构建配置的命令不经过 shell, 元字符按普通参数传给命令
+func TestLocalBuilderNoShell(t *testing.T) {
+	dir := t.TempDir()
+	builder := NewLocalBuilder(cfg.LocalBuildConf{Dir: dir, WorkDir: dir})
+
+	tests := []struct {
+		name string
+		job  string
+		env  map[string]string
+		want string
+	}{
+		{name: "separator is an argument", job: "echo hello;touch pwned", want: "hello;touch pwned\n"},
+		{name: "substitution is an argument", job: "echo $(touch pwned)", want: "$(touch pwned)\n"},
+		{name: "variables come from the environment", job: "printenv VERSION", env: map[string]string{"VERSION": "v1.2.3"}, want: "v1.2.3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handle, err := builder.Start(context.Background(), &BuildRequest{ReleaseID: "r1", Job: tt.job, Env: tt.env})
+			if err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				state, err := builder.Status(context.Background(), handle)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if state.Finished {
+					if !state.Success {
+						t.Fatalf("build finished with %s", state.Result)
+					}
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("build did not finish")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			chunk, err := builder.Logs(context.Background(), handle, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chunk.Text != tt.want {
+				t.Errorf("build log = %q, want %q", chunk.Text, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+				t.Error("job was run by a shell")
+			}
+		})
+	}
+}
+
+func TestLocalBuilderRejectsTemplateJob(t *testing.T) {
+	builder := NewLocalBuilder(cfg.LocalBuildConf{Dir: t.TempDir()})
+	_, err := builder.Start(context.Background(), &BuildRequest{ReleaseID: "r1", Job: "make VERSION={version}"})
+	if err == nil || !strings.Contains(err.Error(), "{version}") {
+		t.Errorf("Start() error = %v, want a template variable error", err)
+	}
+}
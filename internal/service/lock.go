@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrReleaseLocked = errors.New("another release is in progress")
+
+// LockService 基于 MongoDB 租约的项目环境发布锁: 锁文档以 projectId:environment 为主键,
+// 持有者在租约内独占, 进行中的发布单由 Start 定期续约, 进程退出后未续约的锁到期自动失效.
+// 持有超过 maxAge 的锁不再续约, 避免卡住的发布单一直占用环境
+type LockService struct {
+	collection *mongo.Collection
+	lease      time.Duration
+	maxAge     time.Duration
+}
+
+func NewLockService(mongodb *db.MongoDB, leaseMinutes, maxHours int) *LockService {
+	if leaseMinutes <= 0 {
+		leaseMinutes = 10
+	}
+	if maxHours <= 0 {
+		maxHours = 24
+	}
+	return &LockService{
+		collection: mongodb.Database.Collection("release_locks"),
+		lease:      time.Duration(leaseMinutes) * time.Minute,
+		maxAge:     time.Duration(maxHours) * time.Hour,
+	}
+}
+
+// heldByOther 锁是否在 now 时刻由 releaseID 以外的发布单持有, 与 Acquire 的条件一致
+func heldByOther(lock *model.ReleaseLock, releaseID string, now time.Time) bool {
+	return lock != nil && lock.ReleaseID != releaseID && lock.ExpiresAt.After(now)
+}
+
+func lockKey(projectID, environment string) string {
+	return projectID + ":" + environment
+}
+
+// Acquire 锁空闲、已过期或已由 releaseID 持有时获取成功, 否则返回 ErrReleaseLocked
+func (s *LockService) Acquire(projectID, environment, releaseID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	key := lockKey(projectID, environment)
+	filter := bson.M{
+		"_id": key,
+		"$or": []bson.M{
+			{"releaseId": releaseID},
+			{"expiresAt": bson.M{"$lte": now}},
+		},
+	}
+	update := s.lockUpdate(projectID, environment, releaseID, now)
+
+	// 锁被其他发布单持有时 filter 不匹配, upsert 插入同一主键会冲突
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		holder, getErr := s.Get(key)
+		if getErr != nil {
+			return fmt.Errorf("%w for project %s in %s", ErrReleaseLocked, projectID, environment)
+		}
+		// 并发获取时锁可能刚被释放或到期, 重试一次
+		if !heldByOther(holder, releaseID, time.Now()) {
+			_, err = s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+			if !mongo.IsDuplicateKeyError(err) {
+				return err
+			}
+		}
+		return fmt.Errorf("%w: project %s in %s is locked by release %s until %s",
+			ErrReleaseLocked, projectID, environment, holder.ReleaseID, holder.ExpiresAt.Format(time.RFC3339))
+	}
+	return err
+}
+
+// lockUpdate 将锁交给 releaseID 并延长租约. acquiredAt 只在插入或持有者变化时更新,
+// 同一发布单重复获取时保持不变, 否则续约的持有时间上限会被重置
+func (s *LockService) lockUpdate(projectID, environment, releaseID string, now time.Time) mongo.Pipeline {
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"projectId":   bson.M{"$literal": projectID},
+		"environment": bson.M{"$literal": environment},
+		"acquiredAt": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$releaseId", bson.M{"$literal": releaseID}}},
+			bson.M{"$ifNull": bson.A{"$acquiredAt", now}},
+			now,
+		}},
+		"releaseId": bson.M{"$literal": releaseID},
+		"expiresAt": now.Add(s.lease),
+	}}}}
+}
+
+// Takeover 强制将锁转给 releaseID, 用于回滚等不能等待的操作
+func (s *LockService) Takeover(projectID, environment, releaseID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	key := lockKey(projectID, environment)
+	var previous model.ReleaseLock
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, s.lockUpdate(projectID, environment, releaseID, now),
+		options.FindOneAndUpdate().SetUpsert(true)).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	if heldByOther(&previous, releaseID, now) {
+		log.Warn().Str("lock", key).Str("from", previous.ReleaseID).Str("to", releaseID).Msg("发布锁被强制接管")
+	}
+	return nil
+}
+
+// Renew 延长 releaseID 持有的锁, 返回是否仍持有
+func (s *LockService) Renew(releaseID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := s.collection.UpdateMany(ctx, bson.M{"releaseId": releaseID},
+		bson.M{"$set": bson.M{"expiresAt": time.Now().Add(s.lease)}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// Release 释放 releaseID 持有的锁, 锁已被其他发布单获取时不受影响
+func (s *LockService) Release(releaseID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.DeleteMany(ctx, bson.M{"releaseId": releaseID})
+	return err
+}
+
+func (s *LockService) Get(id string) (*model.ReleaseLock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var lock model.ReleaseLock
+	if err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&lock); err != nil {
+		return nil, err
+	}
+
+	return &lock, nil
+}
+
+// List 返回所有未过期的锁
+func (s *LockService) List() ([]*model.ReleaseLock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{"expiresAt": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "acquiredAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	locks := []*model.ReleaseLock{}
+	if err = cursor.All(ctx, &locks); err != nil {
+		return nil, err
+	}
+
+	return locks, nil
+}
+
+// Delete 人工释放锁
+func (s *LockService) Delete(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Start 定期为进行中的发布单续约, 发布单已结束或已删除时释放锁
+func (s *LockService) Start(ctx context.Context, releases *ReleaseService) {
+	go func() {
+		ticker := time.NewTicker(s.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.renewAll(releases)
+			}
+		}
+	}()
+}
+
+func (s *LockService) renewAll(releases *ReleaseService) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.collection.Find(ctx, bson.M{})
+	if err != nil {
+		log.Error().Err(err).Msg("查询发布锁失败")
+		return
+	}
+	locks := []*model.ReleaseLock{}
+	if err := cursor.All(ctx, &locks); err != nil {
+		log.Error().Err(err).Msg("查询发布锁失败")
+		return
+	}
+
+	now := time.Now()
+	for _, lock := range locks {
+		release, err := releases.Get(lock.ReleaseID)
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Error().Err(err).Str("releaseId", lock.ReleaseID).Msg("查询发布单失败")
+			continue
+		}
+		switch renewAction(lock, release, now, s.maxAge) {
+		case lockRelease:
+			if err := s.Release(lock.ReleaseID); err != nil {
+				log.Error().Err(err).Str("lock", lock.ID).Msg("释放发布锁失败")
+			}
+		case lockRenew:
+			if _, err := s.Renew(lock.ReleaseID); err != nil {
+				log.Error().Err(err).Str("lock", lock.ID).Msg("续约发布锁失败")
+			}
+		case lockKeep:
+			// 租约到期后锁自动失效, 不再重复告警
+			if lock.ExpiresAt.After(now) {
+				log.Warn().Str("lock", lock.ID).Str("releaseId", lock.ReleaseID).Time("acquiredAt", lock.AcquiredAt).
+					Msg("发布锁持有时间超过上限, 不再续约")
+			}
+		}
+	}
+}
+
+const (
+	lockRenew = iota
+	lockRelease
+	lockKeep
+)
+
+// renewAction 决定续约时如何处理锁: 发布单已结束或已删除时释放, 持有超过 maxAge 时不再续约,
+// 等租约到期, 否则续约
+func renewAction(lock *model.ReleaseLock, release *model.Release, now time.Time, maxAge time.Duration) int {
+	if release == nil || isTerminalStatus(release.Status) {
+		return lockRelease
+	}
+	if now.Sub(lock.AcquiredAt) >= maxAge {
+		return lockKeep
+	}
+	return lockRenew
+}
+
+func isTerminalStatus(status string) bool {
+	switch status {
+	case model.ReleaseStatusCompleted, model.ReleaseStatusFailed, model.ReleaseStatusRolledBack:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+)
+
+func TestHeldByOther(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		lock      *model.ReleaseLock
+		releaseID string
+		want      bool
+	}{
+		{
+			name:      "no lock",
+			releaseID: "r1",
+			want:      false,
+		},
+		{
+			name:      "held by the same release",
+			lock:      &model.ReleaseLock{ReleaseID: "r1", ExpiresAt: now.Add(time.Minute)},
+			releaseID: "r1",
+			want:      false,
+		},
+		{
+			name:      "held by another release",
+			lock:      &model.ReleaseLock{ReleaseID: "r2", ExpiresAt: now.Add(time.Minute)},
+			releaseID: "r1",
+			want:      true,
+		},
+		{
+			name:      "expired lock of another release",
+			lock:      &model.ReleaseLock{ReleaseID: "r2", ExpiresAt: now.Add(-time.Minute)},
+			releaseID: "r1",
+			want:      false,
+		},
+		{
+			name:      "lock expiring right now",
+			lock:      &model.ReleaseLock{ReleaseID: "r2", ExpiresAt: now},
+			releaseID: "r1",
+			want:      false,
+		},
+		{
+			// Takeover 时锁文档不存在, previous 为零值
+			name:      "empty previous lock",
+			lock:      &model.ReleaseLock{},
+			releaseID: "r1",
+			want:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := heldByOther(tt.lock, tt.releaseID, now); got != tt.want {
+				t.Errorf("heldByOther() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenewAction(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	maxAge := 24 * time.Hour
+
+	tests := []struct {
+		name     string
+		acquired time.Time
+		release  *model.Release
+		want     int
+	}{
+		{
+			name:     "release deleted",
+			acquired: now.Add(-time.Hour),
+			want:     lockRelease,
+		},
+		{
+			name:     "release completed",
+			acquired: now.Add(-time.Hour),
+			release:  &model.Release{Status: model.ReleaseStatusCompleted},
+			want:     lockRelease,
+		},
+		{
+			name:     "release failed",
+			acquired: now.Add(-time.Hour),
+			release:  &model.Release{Status: model.ReleaseStatusFailed},
+			want:     lockRelease,
+		},
+		{
+			name:     "release rolled back",
+			acquired: now.Add(-time.Hour),
+			release:  &model.Release{Status: model.ReleaseStatusRolledBack},
+			want:     lockRelease,
+		},
+		{
+			name:     "release deploying",
+			acquired: now.Add(-time.Hour),
+			release:  &model.Release{Status: model.ReleaseStatusDeploying},
+			want:     lockRenew,
+		},
+		{
+			name:     "held past max age",
+			acquired: now.Add(-maxAge),
+			release:  &model.Release{Status: model.ReleaseStatusDeploying},
+			want:     lockKeep,
+		},
+		{
+			name:     "terminal release past max age",
+			acquired: now.Add(-2 * maxAge),
+			release:  &model.Release{Status: model.ReleaseStatusCompleted},
+			want:     lockRelease,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := &model.ReleaseLock{ReleaseID: "r1", AcquiredAt: tt.acquired, ExpiresAt: now.Add(time.Minute)}
+			if got := renewAction(lock, tt.release, now, maxAge); got != tt.want {
+				t.Errorf("renewAction() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,63 +1,324 @@
 package service
 
 import (
-	"strings"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
 
 	cfg "github.com/felix-001/qnHackathon/internal/config"
+	"github.com/felix-001/qnHackathon/internal/model"
 	"github.com/rs/zerolog/log"
 )
 
+// buildArtifactName 项目没有构建配置时下载的二进制名称
+const buildArtifactName = "streamd"
+
 type Manager struct {
-	githubMgr  *GitHubMgr
-	jenkinsMgr *JenkinsMgr
-	gitlabMgr  *GitLabMgr
+	githubMgr *GitHubMgr
+	gitlabMgr *GitLabMgr
+	builders  map[string]Builder
+	projects  *ProjectService
+	profiles  *BuildProfileService
+	artifacts *ArtifactStore
+	cache     *BuildCacheService
+
+	// webhooks 有通知回调的构建后端, 这些后端的构建状态轮询只作为兜底
+	webhooks map[string]bool
+	waiters  *buildWaiters
 }
 
 func NewManager(conf *cfg.Config) *Manager {
-	return &Manager{
-		githubMgr:  NewGitHubMgr(conf.GitHubConf),
-		jenkinsMgr: NewJenkinsMgr(conf.JenkinsConf),
-		gitlabMgr:  NewGitLabMgr(conf.GitlabConf),
+	m := &Manager{
+		githubMgr: NewGitHubMgr(conf.GitHubConf),
+		gitlabMgr: NewGitLabMgr(conf.GitlabConf),
+		builders:  make(map[string]Builder),
+		webhooks:  make(map[string]bool),
+		waiters:   newBuildWaiters(),
+	}
+
+	// 构建后端初始化失败时不注册, 选择该后端的项目构建时报错
+	if jenkinsMgr := NewJenkinsMgr(conf.JenkinsConf); jenkinsMgr != nil {
+		m.RegisterBuilder(jenkinsMgr)
+		m.webhooks[BuilderJenkins] = conf.JenkinsConf.WebhookToken != ""
+	}
+	if m.gitlabMgr != nil {
+		m.RegisterBuilder(NewGitLabCIBuilder(m.gitlabMgr))
+	}
+	if conf.LocalBuildConf.Command != "" {
+		m.RegisterBuilder(NewLocalBuilder(conf.LocalBuildConf))
 	}
+	return m
 }
 
 type BuildInfo struct {
-	GitlabPRURL string
+	Version     string
 	TarFileName string
+	Digest      string
+	Artifacts   []model.ArtifactVariant // 配置了多平台时每个平台的产物, 第一个为主产物
+	Cache       *model.BuildCache       // 解析到源码提交时的构建缓存信息
 }
 
-func (m *Manager) Build() *BuildInfo {
-	m.jenkinsMgr.StartJob()
+// StageFunc 上报发布流水线阶段状态
+type StageFunc func(stage, status string)
+
+// LogFunc 上报构建日志
+type LogFunc func(line string)
+
+// Build 使用项目选择的构建后端构建, 并下载构建产物. 发布单上有未结束的构建时继续跟踪该构建,
+// 构建标识通过 save 保存到发布单. 构建配置使用了 {commit} 时, 同一提交以相同参数构建过则复用缓存的产物, 不触发构建, 发布单设置了 forceRebuild 时除外
+func (m *Manager) Build(ctx context.Context, release *model.Release, report StageFunc, logf LogFunc, save HandleFunc) (*BuildInfo, error) {
+	report(model.StageBuild, model.StageStatusInProgress)
+	builder, err := m.builderFor(release.ProjectID)
+	if err != nil {
+		report(model.StageBuild, model.StageStatusFailed)
+		return nil, err
+	}
+	profile, err := m.buildProfile(release)
+	if err != nil {
+		report(model.StageBuild, model.StageStatusFailed)
+		return nil, err
+	}
+	now := time.Now()
+	rendered, err := m.renderBuildProfile(profile, release, builder.Name(), "", now)
+	if err != nil {
+		report(model.StageBuild, model.StageStatusFailed)
+		return nil, err
+	}
+
+	handle := release.Build
+	resume := handle != nil && handle.Builder == builder.Name() && handle.Result == ""
+	var cache *model.BuildCache
+	if repository := buildRepository(builder, profile, rendered); repository != "" && !resume {
+		commit, err := m.resolveCommit(ctx, repository, rendered.Branch)
+		if err != nil {
+			log.Warn().Err(err).Str("releaseId", release.ID).Str("repository", repository).Msg("解析构建提交失败, 不使用构建缓存")
+			logf(fmt.Sprintf("解析构建提交失败, 不使用构建缓存: %v", err))
+		} else {
+			if rendered, err = m.renderBuildProfile(profile, release, builder.Name(), commit, now); err != nil {
+				report(model.StageBuild, model.StageStatusFailed)
+				return nil, err
+			}
+			cache = &model.BuildCache{
+				Key:        buildCacheKey(builder.Name(), repository, commit, rendered),
+				Repository: repository,
+				Commit:     commit,
+			}
+			switch {
+			case !buildPinsCommit(profile):
+				// 构建按分支拉取代码, 分支在解析提交之后有新提交时产物与缓存的提交不一致
+				cache = nil
+				logf("构建配置的 job 和 params 未使用 {commit}, 不使用构建缓存")
+			case release.ForceRebuild:
+				logf(fmt.Sprintf("强制重新构建 %s@%s, 跳过构建缓存", repository, commit))
+			default:
+				if info := m.cachedBuild(release, cache, logf); info != nil {
+					report(model.StageBuild, model.StageStatusSkipped)
+					report(model.StageArtifactDownload, model.StageStatusSkipped)
+					return info, nil
+				}
+			}
+		}
+	}
 
-	buildResult := m.jenkinsMgr.WaitForJobCompletion()
-	if buildResult == nil || !buildResult.IsSuccess {
-		log.Error().Msg("Jenkins 构建失败或超时")
-		return nil
+	if resume {
+		logf(fmt.Sprintf("继续跟踪 %s 构建 %s", builder.Name(), handle.ID))
+	} else {
+		logf(fmt.Sprintf("触发 %s 构建", builder.Name()))
+		handle, err = builder.Start(ctx, &BuildRequest{
+			ReleaseID: release.ID,
+			ProjectID: release.ProjectID,
+			Job:       rendered.Job,
+			Params:    rendered.Params,
+			Env:       rendered.Env,
+		})
+		if err != nil {
+			log.Error().Err(err).Str("builder", builder.Name()).Msg("触发构建失败")
+			logf(fmt.Sprintf("触发构建失败: %v", err))
+			report(model.StageBuild, model.StageStatusFailed)
+			return nil, err
+		}
+		save(handle)
+		log.Info().Str("releaseId", release.ID).Str("builder", handle.Builder).Str("id", handle.ID).Msg("已触发构建")
 	}
 
-	streamdPath, err := m.jenkinsMgr.DownloadBin(buildResult, "streamd")
+	state, err := m.waitBuildWithLogs(ctx, builder, release.ID, handle, resume, logf, save)
+	if state != nil {
+		handle.Result = state.Result
+		save(handle)
+	}
+	if err == nil && !state.Success {
+		summary, serr := summarizeBuildLog(release.ID, state.Result)
+		if serr != nil {
+			log.Warn().Err(serr).Str("releaseId", release.ID).Msg("提取构建失败摘要失败")
+		}
+		err = &BuildFailedError{Builder: builder.Name(), ID: handle.ID, Summary: summary}
+	}
 	if err != nil {
-		log.Error().Err(err).Msg("下载 streamd 失败")
-		return nil
+		log.Error().Err(err).Msg("构建失败或超时")
+		logf(fmt.Sprintf("构建失败: %v", err))
+		report(model.StageBuild, model.StageStatusFailed)
+		return nil, err
 	}
-	log.Info().Str("path", streamdPath).Msg("下载 streamd 成功")
+	logf(fmt.Sprintf("构建成功: %s", state.URL))
+	report(model.StageBuild, model.StageStatusCompleted)
 
-	parts := strings.Split(streamdPath, "/")
-	if len(parts) != 3 {
-		log.Error().Str("path", streamdPath).Msg("解析 streamdPath 失败")
-		return nil
+	report(model.StageArtifactDownload, model.StageStatusInProgress)
+	info, err := m.downloadArtifacts(ctx, builder, release, handle, rendered)
+	if err != nil {
+		log.Error().Err(err).Msg("下载构建产物失败")
+		logf(fmt.Sprintf("下载构建产物失败: %v", err))
+		report(model.StageArtifactDownload, model.StageStatusFailed)
+		return nil, err
 	}
+	logf(fmt.Sprintf("下载构建产物成功: %s", info.Version))
+	report(model.StageArtifactDownload, model.StageStatusCompleted)
+
+	info.Cache = cache
+	m.saveBuildCache(release, builder, rendered, info)
+
+	return info, nil
+}
 
-	m.gitlabMgr.UpdateVersion("streamd.json", parts[2])
-	mrUrl := m.gitlabMgr.GetMrUrl(parts[2])
-	if mrUrl == "" {
-		log.Error().Msg("无法获取 MergeRequest URL")
-		return nil
+// waitBuildWithLogs 等待构建结束, 期间拉取构建日志归档并按行通过 logf 推送
+func (m *Manager) waitBuildWithLogs(ctx context.Context, builder Builder, releaseID string, handle *model.BuildHandle, resume bool, logf LogFunc, save HandleFunc) (*BuildState, error) {
+	archive, err := openBuildLog(releaseID, resume, logf)
+	if err != nil {
+		log.Warn().Err(err).Str("releaseId", releaseID).Msg("打开构建日志归档失败, 不记录构建日志")
+		return m.waitBuild(ctx, builder, handle, save)
+	}
+	defer archive.Close()
+
+	// 拉取日志使用 handle 的副本, 避免和状态轮询同时修改 handle
+	logHandle := *handle
+	logCtx, stopLogs := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		archive.follow(logCtx, builder, &logHandle)
+	}()
+
+	state, err := m.waitBuild(ctx, builder, handle, save)
+	stopLogs()
+	<-done
+	if state != nil {
+		archive.drain(ctx, builder, handle)
+	}
+	return state, err
+}
+
+// waitBuild 构建后端有通知回调时注册等待, 由回调唤醒
+func (m *Manager) waitBuild(ctx context.Context, builder Builder, handle *model.BuildHandle, save HandleFunc) (*BuildState, error) {
+	if !m.webhooks[builder.Name()] {
+		return waitBuild(ctx, builder, handle, save, nil)
+	}
+	wake, stop := m.waiters.watch(builder.Name(), handle.ID)
+	defer stop()
+	return waitBuild(ctx, builder, handle, save, wake)
+}
+
+// downloadArtifacts 按构建配置的匹配规则下载产物, 产物文件名即版本号. 配置了产物仓库时下载后入库.
+// 构建配置了多平台时每个平台下载一个产物, 第一个平台的产物为主产物, 其余以主产物版本分组
+func (m *Manager) downloadArtifacts(ctx context.Context, builder Builder, release *model.Release, handle *model.BuildHandle, profile *renderedBuildProfile) (*BuildInfo, error) {
+	artifacts, err := builder.Artifacts(ctx, handle)
+	if err != nil {
+		return nil, err
 	}
-	log.Info().Str("url", mrUrl).Msg("获取 MR URL 成功")
 
-	return &BuildInfo{
-		GitlabPRURL: mrUrl,
-		TarFileName: buildResult.TarFileName,
+	info := &BuildInfo{}
+	for _, name := range artifacts {
+		if ok, _ := path.Match(profile.PackagePattern, path.Base(name)); ok {
+			info.TarFileName = path.Base(name)
+			break
+		}
+	}
+
+	platforms := profile.Platforms
+	if len(platforms) == 0 {
+		platforms = []model.BuildPlatform{{
+			OS:               profile.Params["GOOS"],
+			Arch:             profile.Params["GOARCH"],
+			ArtifactPatterns: profile.ArtifactPatterns,
+		}}
+	}
+	binaries := make([]string, len(platforms))
+	for i, platform := range platforms {
+		binaries[i] = matchArtifact(artifacts, platform.ArtifactPatterns)
+		if binaries[i] == "" {
+			if len(profile.Platforms) == 0 {
+				return nil, fmt.Errorf("no artifact matches %v in build %s", platform.ArtifactPatterns, handle.ID)
+			}
+			return nil, fmt.Errorf("no artifact for platform %s matches %v in build %s",
+				platformName(platform.OS, platform.Arch, platform.OSRelease), platform.ArtifactPatterns, handle.ID)
+		}
+		for j := 0; j < i; j++ {
+			if path.Base(binaries[j]) == path.Base(binaries[i]) {
+				return nil, fmt.Errorf("platforms %s and %s match the same artifact name %s, artifact names must be unique",
+					platformName(platforms[j].OS, platforms[j].Arch, platforms[j].OSRelease),
+					platformName(platform.OS, platform.Arch, platform.OSRelease), path.Base(binaries[i]))
+			}
+		}
+	}
+
+	dir := m.artifacts.TempDir(release.ID)
+	if m.artifacts != nil {
+		defer os.RemoveAll(dir)
+	}
+	for i, platform := range platforms {
+		downloaded, err := builder.Download(ctx, handle, binaries[i], dir)
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("path", downloaded).Msg("下载构建产物成功")
+
+		variant := model.ArtifactVariant{
+			OS:        platform.OS,
+			Arch:      platform.Arch,
+			OSRelease: platform.OSRelease,
+			Version:   filepath.Base(downloaded),
+		}
+		if i == 0 {
+			info.Version = variant.Version
+		}
+		if m.artifacts != nil {
+			group := ""
+			if len(profile.Platforms) > 0 {
+				group = info.Version
+			}
+			artifact, err := m.artifacts.Put(downloaded, &model.Artifact{
+				ProjectID: release.ProjectID,
+				Version:   variant.Version,
+				OS:        platform.OS,
+				Arch:      platform.Arch,
+				OSRelease: platform.OSRelease,
+				Group:     group,
+				BuildID:   handle.Builder + "/" + handle.ID,
+			}, release.ID)
+			if err != nil {
+				return nil, err
+			}
+			variant.Digest = artifact.Digest
+		}
+		if i == 0 {
+			info.Digest = variant.Digest
+		}
+		if len(profile.Platforms) > 0 {
+			info.Artifacts = append(info.Artifacts, variant)
+		}
+	}
+	return info, nil
+}
+
+// matchArtifact 按规则顺序返回第一个文件名匹配的产物
+func matchArtifact(artifacts []string, patterns []string) string {
+	for _, pattern := range patterns {
+		for _, name := range artifacts {
+			if ok, _ := path.Match(pattern, path.Base(name)); ok {
+				return name
+			}
+		}
 	}
+	return ""
 }
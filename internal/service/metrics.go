@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	week = 7 * 24 * time.Hour
+	// defaultMetricsWeeks 未指定时间范围时统计最近的周数
+	defaultMetricsWeeks = 12
+)
+
+// MetricsService 从发布单计算 DORA 交付指标, 按周 (北京时间周一 00:00 起) 分桶:
+//   - 部署频率: 完成的发布单数, 不含回滚发布单
+//   - 变更前置时间: 发布说明中每个 MR/PR 合并到发布完成的时长中位数, 没有发布说明时从创建发布单算起
+//   - 变更失败率: 开始部署的发布单中最终失败或被回滚的比例, 不含回滚发布单
+//   - 恢复时间: 失败到同项目同环境下一次完成发布 (通常为回滚) 的时长中位数
+type MetricsService struct {
+	collection *mongo.Collection
+}
+
+func NewMetricsService(mongodb *db.MongoDB) *MetricsService {
+	return &MetricsService{
+		collection: mongodb.Database.Collection("releases"),
+	}
+}
+
+// weekStart 返回 t 所在周的周一 00:00 (北京时间)
+func weekStart(t time.Time) time.Time {
+	t = t.In(time.FixedZone("CST", 8*3600))
+	days := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, t.Location())
+}
+
+type metricsBucket struct {
+	metrics  *model.DeliveryMetrics
+	leads    []time.Duration
+	restores []time.Duration
+}
+
+// Delivery 统计 [from, to) 内的交付指标, projectID 和 environment 为空时不过滤
+func (s *MetricsService) Delivery(projectID, environment string, from, to time.Time) (*model.DeliveryMetricsReport, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultMetricsWeeks * week)
+	}
+	from = weekStart(from)
+
+	releases, err := s.deployed(projectID, environment, from)
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []*metricsBucket
+	for start := from; start.Before(to); start = start.Add(week) {
+		buckets = append(buckets, &metricsBucket{
+			metrics: &model.DeliveryMetrics{Start: start, End: start.Add(week)},
+		})
+	}
+	summary := &metricsBucket{metrics: &model.DeliveryMetrics{Start: from, End: to}}
+	bucketOf := func(t time.Time) *metricsBucket {
+		if t.Before(from) || !t.Before(to) {
+			return nil
+		}
+		return buckets[int(t.Sub(from)/week)]
+	}
+
+	byID := make(map[string]*model.Release, len(releases))
+	for _, release := range releases {
+		byID[release.ID] = release
+	}
+
+	for _, release := range releases {
+		if release.RollbackOf != "" {
+			continue
+		}
+
+		if release.Status == model.ReleaseStatusCompleted && release.CompletedAt != nil {
+			if b := bucketOf(*release.CompletedAt); b != nil {
+				leads := leadTimes(release)
+				for _, bucket := range []*metricsBucket{b, summary} {
+					bucket.metrics.Deployments++
+					bucket.leads = append(bucket.leads, leads...)
+				}
+			}
+		}
+
+		if !isTerminalStatus(release.Status) {
+			continue
+		}
+		b := bucketOf(*release.StartedAt)
+		if b == nil {
+			continue
+		}
+		failed := release.Status == model.ReleaseStatusFailed || release.Status == model.ReleaseStatusRolledBack
+		for _, bucket := range []*metricsBucket{b, summary} {
+			bucket.metrics.Changes++
+			if failed {
+				bucket.metrics.FailedChanges++
+			}
+		}
+		if !failed {
+			continue
+		}
+
+		failedAt := failureTime(release, byID)
+		restored := restoreTime(release, failedAt, releases)
+		for _, bucket := range []*metricsBucket{b, summary} {
+			if restored == nil {
+				bucket.metrics.Unrestored++
+				continue
+			}
+			bucket.metrics.Restores++
+			bucket.restores = append(bucket.restores, restored.Sub(failedAt))
+		}
+	}
+
+	report := &model.DeliveryMetricsReport{
+		ProjectID:   projectID,
+		Environment: environment,
+		Weeks:       make([]*model.DeliveryMetrics, 0, len(buckets)),
+	}
+	for _, b := range buckets {
+		report.Weeks = append(report.Weeks, b.finish())
+	}
+	report.Summary = *summary.finish()
+
+	return report, nil
+}
+
+// deployed 返回 from 之后开始部署的发布单, 按开始部署时间排序
+func (s *MetricsService) deployed(projectID, environment string, from time.Time) ([]*model.Release, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"startedAt": bson.M{"$gte": from}}
+	if projectID != "" {
+		filter["projectId"] = projectID
+	}
+	if environment != "" {
+		filter["environment"] = environment
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "startedAt", Value: 1}}).
+		SetProjection(bson.M{"stages": 0, "rolloutSteps": 0, "healthCheck": 0, "releaseNotes.markdown": 0})
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	releases := []*model.Release{}
+	if err = cursor.All(ctx, &releases); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+// leadTimes 返回发布说明中每个变更从合并到发布完成的时长
+func leadTimes(release *model.Release) []time.Duration {
+	var leads []time.Duration
+	if release.ReleaseNotes != nil {
+		for _, module := range release.ReleaseNotes.Modules {
+			for _, issue := range module.Issues {
+				for _, item := range issue.Items {
+					if item.MergedAt != nil && item.MergedAt.Before(*release.CompletedAt) {
+						leads = append(leads, release.CompletedAt.Sub(*item.MergedAt))
+					}
+				}
+			}
+		}
+	}
+	if len(leads) == 0 {
+		leads = append(leads, release.CompletedAt.Sub(release.CreatedAt))
+	}
+	return leads
+}
+
+// failureTime 被回滚的发布单以回滚发起时间为失败时间, 其他以结束时间为准
+func failureTime(release *model.Release, byID map[string]*model.Release) time.Time {
+	if rollback, ok := byID[release.RolledBackBy]; ok && release.Status == model.ReleaseStatusRolledBack {
+		return rollback.CreatedAt
+	}
+	if release.CompletedAt != nil {
+		return *release.CompletedAt
+	}
+	return *release.StartedAt
+}
+
+// restoreTime 返回失败之后同项目同环境第一次完成发布的时间, 尚未恢复时返回 nil
+func restoreTime(failed *model.Release, failedAt time.Time, releases []*model.Release) *time.Time {
+	var restored *time.Time
+	for _, release := range releases {
+		if release.ID == failed.ID || release.Status != model.ReleaseStatusCompleted || release.CompletedAt == nil {
+			continue
+		}
+		if release.ProjectID != failed.ProjectID || release.Environment != failed.Environment {
+			continue
+		}
+		if release.CompletedAt.After(failedAt) && (restored == nil || release.CompletedAt.Before(*restored)) {
+			restored = release.CompletedAt
+		}
+	}
+	return restored
+}
+
+func (b *metricsBucket) finish() *model.DeliveryMetrics {
+	m := b.metrics
+	m.DeploymentsPerWeek = round2(float64(m.Deployments) / (m.End.Sub(m.Start).Hours() / week.Hours()))
+	m.LeadTimeHours = medianHours(b.leads)
+	m.TimeToRestoreHours = medianHours(b.restores)
+	if m.Changes > 0 {
+		rate := round2(float64(m.FailedChanges) / float64(m.Changes))
+		m.ChangeFailureRate = &rate
+	}
+	return m
+}
+
+func medianHours(durations []time.Duration) *float64 {
+	if len(durations) == 0 {
+		return nil
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	mid := len(durations) / 2
+	median := durations[mid]
+	if len(durations)%2 == 0 {
+		median = (durations[mid-1] + durations[mid]) / 2
+	}
+	hours := round2(median.Hours())
+	return &hours
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
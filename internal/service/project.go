@@ -38,6 +38,18 @@ func (s *ProjectService) List() []model.Project {
 	return projects
 }
 
+func (s *ProjectService) Get(id string) (*model.Project, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var project model.Project
+	if err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&project); err != nil {
+		return nil, err
+	}
+
+	return &project, nil
+}
+
 func (s *ProjectService) Create(project *model.Project) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrEnvironmentOrder = errors.New("environment promotion order violated")
+
+// defaultEnvironmentChain 项目未配置 environments 时的环境晋级顺序
+var defaultEnvironmentChain = []string{"dev", "test", "staging", "production"}
+
+// PromotionService 按项目的环境顺序晋级发布: 只有第一个环境可以直接创建发布单并构建,
+// 之后的环境必须由上一个环境已完成的发布单晋级, 复用同一个产物. 紧急情况下可以给出原因
+// 直接创建之后环境的发布单, 记录到 promotion_overrides
+type PromotionService struct {
+	releases  *ReleaseService
+	projects  *ProjectService
+	jobs      *JobService
+	artifacts *ArtifactStore
+	overrides *mongo.Collection
+}
+
+func NewPromotionService(mongodb *db.MongoDB, releases *ReleaseService, projects *ProjectService, jobs *JobService) *PromotionService {
+	return &PromotionService{
+		releases:  releases,
+		projects:  projects,
+		jobs:      jobs,
+		overrides: mongodb.Database.Collection("promotion_overrides"),
+	}
+}
+
+func (s *PromotionService) SetArtifactStore(artifacts *ArtifactStore) {
+	s.artifacts = artifacts
+}
+
+// Chain 返回项目的环境晋级顺序
+func (s *PromotionService) Chain(projectID string) ([]string, error) {
+	project, err := s.projects.Get(projectID)
+	if err == mongo.ErrNoDocuments {
+		return defaultEnvironmentChain, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(project.Environments) == 0 {
+		return defaultEnvironmentChain, nil
+	}
+	return project.Environments, nil
+}
+
+// CheckCreate 直接创建的发布单只能进入环境顺序中的第一个环境. 之后的环境没有跳过原因时返回
+// ErrEnvironmentOrder, 有原因时放行并返回待记录的 override, 由调用方在发布单创建成功后通过 RecordOverride 记录
+func (s *PromotionService) CheckCreate(projectID, environment, operator, overrideReason string) (*model.PromotionOverride, error) {
+	chain, err := s.Chain(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	index := indexOf(chain, environment)
+	switch {
+	case index < 0:
+		return nil, fmt.Errorf("%w: environment %q is not in %v", ErrEnvironmentOrder, environment, chain)
+	case index == 0:
+		return nil, nil
+	case overrideReason == "":
+		return nil, fmt.Errorf("%w: releases to %s must be promoted from %s", ErrEnvironmentOrder, environment, chain[index-1])
+	}
+
+	return &model.PromotionOverride{
+		ID:          primitive.NewObjectID().Hex(),
+		ProjectID:   projectID,
+		Environment: environment,
+		Skipped:     append([]string(nil), chain[:index]...),
+		Operator:    operator,
+		Reason:      overrideReason,
+	}, nil
+}
+
+// RecordOverride 记录跳过晋级顺序创建的发布单
+func (s *PromotionService) RecordOverride(override *model.PromotionOverride) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	override.CreatedAt = time.Now()
+	if _, err := s.overrides.InsertOne(ctx, override); err != nil {
+		return err
+	}
+
+	log.Warn().Str("releaseId", override.ReleaseID).Str("environment", override.Environment).Strs("skipped", override.Skipped).
+		Str("operator", override.Operator).Str("reason", override.Reason).Msg("跳过环境晋级顺序创建发布单")
+	return nil
+}
+
+func (s *PromotionService) ListOverrides(projectID string) ([]*model.PromotionOverride, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if projectID != "" {
+		filter["projectId"] = projectID
+	}
+
+	cursor, err := s.overrides.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	overrides := []*model.PromotionOverride{}
+	if err = cursor.All(ctx, &overrides); err != nil {
+		return nil, err
+	}
+
+	return overrides, nil
+}
+
+// NextEnvironment 返回发布单在环境顺序中的下一个环境
+func (s *PromotionService) NextEnvironment(release *model.Release) (string, error) {
+	chain, err := s.Chain(release.ProjectID)
+	if err != nil {
+		return "", err
+	}
+	index := indexOf(chain, release.Environment)
+	if index < 0 {
+		return "", fmt.Errorf("%w: environment %q is not in %v", ErrEnvironmentOrder, release.Environment, chain)
+	}
+	if index == len(chain)-1 {
+		return "", fmt.Errorf("%w: %s is the last environment", ErrEnvironmentOrder, release.Environment)
+	}
+	return chain[index+1], nil
+}
+
+// Promote 将已完成的发布单晋级到下一个环境: 复用 TarFileName 和产物 sha256, 跳过构建,
+// 新发布单从版本号 MR 开始, 之后按目标环境的审批策略审批
+func (s *PromotionService) Promote(id string, operator string) (*model.Release, error) {
+	source, err := s.releases.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if source.Status != model.ReleaseStatusCompleted {
+		return nil, fmt.Errorf("%w: release %s is %q, only completed releases can be promoted", ErrInvalidTransition, id, source.Status)
+	}
+
+	next, err := s.NextEnvironment(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if source.ArtifactVersion == "" {
+		return nil, fmt.Errorf("release %s has no artifact to promote", id)
+	}
+	_, digest := releaseArtifact(source)
+	_, sum, err := s.artifacts.Resolve(source.ProjectID, source.ArtifactVersion, digest)
+	if err != nil {
+		return nil, fmt.Errorf("artifact %s of release %s is not available: %w", source.ArtifactVersion, id, err)
+	}
+
+	// 晋级的操作人即晋级发布单的发起人, 审批时不能审批自己晋级的发布单
+	createdBy := operator
+	if operator == "" {
+		operator = source.Scheduler
+	}
+	promoted := &model.Release{
+		ID:              primitive.NewObjectID().Hex(),
+		ProjectID:       source.ProjectID,
+		ProjectName:     source.ProjectName,
+		ApplicationID:   source.ApplicationID,
+		Version:         source.Version,
+		Environment:     next,
+		Strategy:        source.Strategy,
+		Description:     fmt.Sprintf("由 %s 环境晋级: %s", source.Environment, source.Description),
+		Scheduler:       operator,
+		CreatedBy:       createdBy,
+		TarFileName:     source.TarFileName,
+		ArtifactVersion: source.ArtifactVersion,
+		ArtifactSHA256:  sum,
+		Artifacts:       source.Artifacts,
+		PromotedFrom:    source.ID,
+		ReleaseNotes:    source.ReleaseNotes,
+	}
+	if err := s.releases.CreatePromoted(promoted); err != nil {
+		return nil, err
+	}
+	if err := s.artifacts.Reference(promoted.ProjectID, promoted.ArtifactVersion, sum, promoted.ID); err != nil {
+		log.Warn().Err(err).Str("releaseId", promoted.ID).Msg("记录产物引用失败")
+	}
+
+	err = s.jobs.Enqueue(&model.Job{
+		ReleaseID: promoted.ID,
+		Type:      model.JobTypeVersionBump,
+		Payload:   map[string]string{"version": promoted.ArtifactVersion},
+	})
+	if err != nil {
+		if err := s.releases.Fail(promoted.ID, "system", "版本号任务入队失败"); err != nil {
+			log.Error().Err(err).Str("releaseId", promoted.ID).Msg("更新发布单状态失败")
+		}
+		return nil, err
+	}
+
+	log.Info().Str("releaseId", promoted.ID).Str("from", source.ID).Str("environment", next).
+		Str("artifact", promoted.ArtifactVersion).Msg("发布单已晋级到下一个环境")
+	return promoted, nil
+}
+
+// CreatePromoted 创建晋级发布单, 构建和产物下载阶段直接跳过
+func (s *ReleaseService) CreatePromoted(release *model.Release) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	release.CreatedAt = time.Now()
+	release.Status = model.ReleaseStatusBuilding
+	release.Stages = newReleaseStages()
+	for i := range release.Stages {
+		switch release.Stages[i].Name {
+		case model.StageBuild, model.StageArtifactDownload:
+			release.Stages[i].Status = model.StageStatusSkipped
+		}
+	}
+
+	if err := s.acquireLock(release); err != nil {
+		return err
+	}
+	if _, err := s.collection.InsertOne(ctx, release); err != nil {
+		s.releaseLock(release.ID)
+		return err
+	}
+
+	return s.recordEvent(ctx, release.ID, "", release.Status, release.Scheduler, release.Description)
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -2,22 +2,86 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/felix-001/qnHackathon/internal/db"
 	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+var ErrInvalidTransition = errors.New("invalid release status transition")
+
+// 发布单状态机: key 为当前状态, value 为允许流转到的状态
+var releaseTransitions = map[string][]string{
+	model.ReleaseStatusBuilding:        {model.ReleaseStatusPendingApproval, model.ReleaseStatusFailed},
+	model.ReleaseStatusPendingApproval: {model.ReleaseStatusApproved, model.ReleaseStatusFailed},
+	model.ReleaseStatusApproved:        {model.ReleaseStatusDeploying, model.ReleaseStatusFailed},
+	model.ReleaseStatusDeploying:       {model.ReleaseStatusCompleted, model.ReleaseStatusFailed, model.ReleaseStatusRolledBack},
+	model.ReleaseStatusCompleted:       {model.ReleaseStatusRolledBack},
+	model.ReleaseStatusFailed:          {model.ReleaseStatusRolledBack, model.ReleaseStatusBuilding},
+}
+
+func CanTransition(from, to string) bool {
+	for _, next := range releaseTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
 type ReleaseService struct {
 	collection *mongo.Collection
+	events     *mongo.Collection
+	gitlabMgr  *GitLabMgr
+	locks      *LockService
+	bus        *EventBus
+	artifacts  *ArtifactStore
 }
 
 func NewReleaseService(mongodb *db.MongoDB) *ReleaseService {
 	return &ReleaseService{
 		collection: mongodb.Database.Collection("releases"),
+		events:     mongodb.Database.Collection("release_events"),
+	}
+}
+
+func (s *ReleaseService) SetGitLabMgr(gitlabMgr *GitLabMgr) {
+	s.gitlabMgr = gitlabMgr
+}
+
+func (s *ReleaseService) SetLockService(locks *LockService) {
+	s.locks = locks
+}
+
+func (s *ReleaseService) SetArtifactStore(artifacts *ArtifactStore) {
+	s.artifacts = artifacts
+}
+
+func (s *ReleaseService) SetEventBus(bus *EventBus) {
+	s.bus = bus
+	bus.SetProjectResolver(func(releaseID string) string {
+		release, err := s.Get(releaseID)
+		if err != nil {
+			return ""
+		}
+		return release.ProjectID
+	})
+}
+
+// Publish 向订阅者推送发布单事件, 未配置事件总线时忽略
+func (s *ReleaseService) Publish(eventType, releaseID string, data interface{}) {
+	if s.bus == nil {
+		return
 	}
+	s.bus.Publish(eventType, releaseID, data)
 }
 
 func (s *ReleaseService) List() []model.Release {
@@ -42,11 +106,23 @@ func (s *ReleaseService) Create(release *model.Release) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if release.ID == "" {
+		release.ID = primitive.NewObjectID().Hex()
+	}
 	release.CreatedAt = time.Now()
-	release.Status = "pending_approval"
+	release.Status = model.ReleaseStatusBuilding
+	release.Stages = newReleaseStages()
 
+	if err := s.acquireLock(release); err != nil {
+		return err
+	}
 	_, err := s.collection.InsertOne(ctx, release)
-	return err
+	if err != nil {
+		s.releaseLock(release.ID)
+		return err
+	}
+
+	return s.recordEvent(ctx, release.ID, "", release.Status, release.Scheduler, "创建发布单")
 }
 
 func (s *ReleaseService) Get(id string) (*model.Release, error) {
@@ -60,20 +136,153 @@ func (s *ReleaseService) Get(id string) (*model.Release, error) {
 		return nil, err
 	}
 
+	fillStageProgress(&release)
 	return &release, nil
 }
 
-func (s *ReleaseService) Rollback(id string, targetVersion string, reason string) error {
+func newReleaseStages() []model.ReleaseStage {
+	stages := make([]model.ReleaseStage, 0, len(model.ReleaseStageNames))
+	for _, name := range model.ReleaseStageNames {
+		stages = append(stages, model.ReleaseStage{
+			Name:   name,
+			Status: model.StageStatusPending,
+		})
+	}
+	return stages
+}
+
+// fillStageProgress 计算当前所处阶段和整体进度, 供前端绘制流水线
+func fillStageProgress(release *model.Release) {
+	if len(release.Stages) == 0 {
+		return
+	}
+
+	done := 0
+	for _, stage := range release.Stages {
+		switch stage.Status {
+		case model.StageStatusCompleted, model.StageStatusSkipped:
+			done++
+		case model.StageStatusInProgress, model.StageStatusFailed:
+			if release.CurrentStage == "" {
+				release.CurrentStage = stage.Name
+			}
+		}
+	}
+	release.Progress = done * 100 / len(release.Stages)
+}
+
+// UpdateStage 更新指定阶段的状态, 进入 in_progress 时记录开始时间, 结束时记录结束时间
+func (s *ReleaseService) UpdateStage(id, name, status string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{"status": "rolled_back"}}
+	now := time.Now()
+	set := bson.M{"stages.$.status": status}
+	switch status {
+	case model.StageStatusInProgress:
+		set["stages.$.startTime"] = now
+		set["stages.$.endTime"] = nil
+	case model.StageStatusCompleted, model.StageStatusFailed, model.StageStatusSkipped:
+		set["stages.$.endTime"] = now
+	}
 
-	_, err := s.collection.UpdateOne(ctx, filter, update)
+	filter := bson.M{"_id": id, "stages.name": name}
+	if _, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": set}); err != nil {
+		return err
+	}
+
+	s.Publish(StreamEventStage, id, map[string]string{"stage": name, "status": status})
+	return nil
+}
+
+// failRunningStages 将所有进行中的阶段标记为失败
+func (s *ReleaseService) failRunningStages(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"stages.$[s].status":  model.StageStatusFailed,
+		"stages.$[s].endTime": time.Now(),
+	}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"s.status": model.StageStatusInProgress}},
+	})
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, update, opts)
 	return err
 }
 
+// Transition 按状态机校验并变更发布单状态, fields 为需要一并更新的字段
+func (s *ReleaseService) Transition(id, to, operator, reason string, fields bson.M) error {
+	release, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if !CanTransition(release.Status, to) {
+		return fmt.Errorf("%w: release %s cannot go from %q to %q", ErrInvalidTransition, id, release.Status, to)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set := bson.M{"status": to}
+	for k, v := range fields {
+		set[k] = v
+	}
+
+	// 以当前状态作为过滤条件, 防止并发请求同时流转
+	filter := bson.M{"_id": id, "status": release.Status}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: release %s status changed concurrently, expected %q", ErrInvalidTransition, id, release.Status)
+	}
+	if isTerminalStatus(to) {
+		s.releaseLock(id)
+	}
+
+	return s.recordEvent(ctx, id, release.Status, to, operator, reason)
+}
+
+func (s *ReleaseService) recordEvent(ctx context.Context, releaseID, from, to, operator, reason string) error {
+	event := &model.ReleaseEvent{
+		ReleaseID:  releaseID,
+		FromStatus: from,
+		ToStatus:   to,
+		Operator:   operator,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	}
+
+	if _, err := s.events.InsertOne(ctx, event); err != nil {
+		return err
+	}
+
+	s.Publish(StreamEventStatus, releaseID, event)
+	return nil
+}
+
+func (s *ReleaseService) ListEvents(releaseID string) ([]*model.ReleaseEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.events.Find(ctx, bson.M{"releaseId": releaseID}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*model.ReleaseEvent{}
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
 func (s *ReleaseService) UpdateGitlabPR(id string, gitlabPrUrl string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -85,58 +294,428 @@ func (s *ReleaseService) UpdateGitlabPR(id string, gitlabPrUrl string) error {
 	return err
 }
 
-func (s *ReleaseService) UpdateTarFileName(id string, tarFileName string) error {
+// UpdateArtifact 记录构建产物, artifactVersion 为写入版本文件的产物名 (多平台时为主产物), digest 为其 sha256,
+// variants 为空时清除上一次构建的多平台产物
+func (s *ReleaseService) UpdateArtifact(id string, tarFileName string, artifactVersion string, digest string, variants []model.ArtifactVariant) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{"tarFileName": tarFileName}}
+	set := bson.M{
+		"tarFileName":     tarFileName,
+		"artifactVersion": artifactVersion,
+		"artifactSha256":  digest,
+	}
+	update := bson.M{"$set": set}
+	if len(variants) > 0 {
+		set["artifacts"] = variants
+	} else {
+		update["$unset"] = bson.M{"artifacts": ""}
+	}
 
 	_, err := s.collection.UpdateOne(ctx, filter, update)
 	return err
 }
 
-func (s *ReleaseService) Approve(id string) error {
+// UpdateBuild 保存发布单当前构建的标识和结果
+func (s *ReleaseService) UpdateBuild(id string, handle *model.BuildHandle) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{"status": "approved"}}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"build": handle}})
+	return err
+}
 
-	_, err := s.collection.UpdateOne(ctx, filter, update)
+// UpdateBuildSummary 保存构建失败摘要, summary 为 nil 时清除
+func (s *ReleaseService) UpdateBuildSummary(id string, summary *model.BuildSummary) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"buildSummary": summary}}
+	if summary == nil {
+		update = bson.M{"$unset": bson.M{"buildSummary": ""}}
+	}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
 	return err
 }
 
-func (s *ReleaseService) Deploy(id string) error {
+// ClearForceRebuild 强制重新构建成功后清除 forceRebuild, 之后的重新构建重新使用构建缓存
+func (s *ReleaseService) ClearForceRebuild(id string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	now := time.Now()
-	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{
-		"status":    "deploying",
-		"startedAt": now,
-	}}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{"forceRebuild": ""}})
+	return err
+}
 
-	_, err := s.collection.UpdateOne(ctx, filter, update)
+// UpdateBuildCache 保存构建缓存信息, cache 为 nil 时清除上一次构建的缓存信息
+func (s *ReleaseService) UpdateBuildCache(id string, cache *model.BuildCache) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"buildCache": cache}}
+	if cache == nil {
+		update = bson.M{"$unset": bson.M{"buildCache": ""}}
+	}
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
 	return err
 }
 
-func (s *ReleaseService) Complete(id string) error {
+// FindPendingBuilds 返回指定构建后端中构建 ID 为 id 或构建号为 number 且尚未结束的发布单
+func (s *ReleaseService) FindPendingBuilds(builder, id string, number int64) ([]*model.Release, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	now := time.Now()
-	filter := bson.M{"_id": id}
-	update := bson.M{"$set": bson.M{
-		"status":      "completed",
-		"completedAt": now,
-	}}
+	var or []bson.M
+	if id != "" {
+		or = append(or, bson.M{"build.id": id})
+	}
+	if number != 0 {
+		or = append(or, bson.M{"build.number": number})
+	}
+	if len(or) == 0 {
+		return nil, nil
+	}
+	filter := bson.M{
+		"build.builder": builder,
+		"build.result":  bson.M{"$in": []interface{}{nil, ""}},
+		"$or":           or,
+	}
 
-	_, err := s.collection.UpdateOne(ctx, filter, update)
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var releases []*model.Release
+	if err = cursor.All(ctx, &releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// ArchiveBuild 将已结束的当前构建连同失败摘要和构建日志归档为一次历史构建, 为重新构建腾出位置
+func (s *ReleaseService) ArchiveBuild(id string) error {
+	release, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if release.Build == nil {
+		return nil
+	}
+
+	attempt := model.BuildAttempt{
+		Attempt:    len(release.BuildAttempts) + 1,
+		Build:      *release.Build,
+		Summary:    release.BuildSummary,
+		ArchivedAt: time.Now(),
+	}
+	// 没有结果的构建 (如等待超时) 不再跟踪
+	if attempt.Build.Result == "" {
+		attempt.Build.Result = buildResultAbandoned
+	}
+	if err := os.Rename(BuildLogPath(id), BuildAttemptLogPath(id, attempt.Attempt)); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Str("releaseId", id).Msg("归档构建日志失败")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "build.id": release.Build.ID}
+	update := bson.M{
+		"$push":  bson.M{"buildAttempts": attempt},
+		"$unset": bson.M{"build": "", "buildSummary": ""},
+	}
+	_, err = s.collection.UpdateOne(ctx, filter, update)
 	return err
 }
 
+// Rebuild 构建失败 (含取消、超时) 的发布单重新进入构建, 已开始部署的发布单不能重新构建.
+// 上一次构建无论是否有结果都先归档, 重新构建总是触发新的构建
+func (s *ReleaseService) Rebuild(id, operator string, force bool) error {
+	release, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if release.Status != model.ReleaseStatusFailed || release.StartedAt != nil || release.RollbackOf != "" {
+		return fmt.Errorf("%w: release %s did not fail in build", ErrInvalidTransition, id)
+	}
+	if err := s.acquireLock(release); err != nil {
+		return err
+	}
+	if err := s.ArchiveBuild(id); err != nil {
+		s.releaseLock(id)
+		return err
+	}
+
+	set := bson.M{
+		"stages":      newReleaseStages(),
+		"completedAt": nil,
+	}
+	if force {
+		set["forceRebuild"] = true
+	}
+	err = s.Transition(id, model.ReleaseStatusBuilding, operator, "重新构建", set)
+	if err != nil {
+		s.releaseLock(id)
+		return err
+	}
+	return nil
+}
+
+// BuildLog 返回发布单构建日志中 offset 之后的部分, 构建未结束时 More 为 true.
+// attempt 大于 0 时返回对应历史构建的日志
+func (s *ReleaseService) BuildLog(id string, attempt int, offset int64) (*model.BuildLog, error) {
+	release, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	path := BuildLogPath(id)
+	more := release.Build != nil && release.Build.Result == ""
+	if attempt > 0 {
+		if attempt > len(release.BuildAttempts) {
+			return nil, fmt.Errorf("build attempt %d of release %s not found", attempt, id)
+		}
+		path = BuildAttemptLogPath(id, attempt)
+		more = false
+	}
+
+	text, next, err := ReadBuildLog(path, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &model.BuildLog{
+		Text: text,
+		Next: next,
+		More: more,
+	}, nil
+}
+
+// UpdateDeployment 为部署中的发布单记录目标节点、超时时间等部署信息
+func (s *ReleaseService) UpdateDeployment(id string, fields bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "status": model.ReleaseStatusDeploying}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("%w: release %s is not deploying", ErrInvalidTransition, id)
+	}
+	return nil
+}
+
+// UpdateRolloutStep 仅当批次处于 from 中的状态时更新, 返回是否更新成功, 防止并发上报重复推进批次.
+// set 的 key 为批次内字段名, release 为发布单级别需要一并更新的字段
+func (s *ReleaseService) UpdateRolloutStep(id string, index int, from []string, set bson.M, release bson.M) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	prefix := fmt.Sprintf("rolloutSteps.%d.", index)
+	filter := bson.M{
+		"_id":             id,
+		"status":          model.ReleaseStatusDeploying,
+		prefix + "status": bson.M{"$in": from},
+	}
+	fields := bson.M{}
+	for k, v := range set {
+		fields[prefix+k] = v
+	}
+	for k, v := range release {
+		fields[k] = v
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// StartHealthCheck 仅当发布单仍在部署中且尚未开始健康检查时记录, 返回是否记录成功
+func (s *ReleaseService) StartHealthCheck(id string, result *model.HealthCheckResult) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":         id,
+		"status":      model.ReleaseStatusDeploying,
+		"healthCheck": bson.M{"$exists": false},
+	}
+	updated, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"healthCheck": result}})
+	if err != nil {
+		return false, err
+	}
+	return updated.MatchedCount > 0, nil
+}
+
+// UpdateHealthCheck 更新部署中发布单的健康检查结果, set 的 key 为健康检查内字段名,
+// 发布单已不在部署中时返回 false
+func (s *ReleaseService) UpdateHealthCheck(id string, set bson.M) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fields := bson.M{}
+	for k, v := range set {
+		fields["healthCheck."+k] = v
+	}
+
+	filter := bson.M{"_id": id, "status": model.ReleaseStatusDeploying}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// FindByArtifact 按创建时间倒序返回产物为 artifactVersion 且已审批通过的发布单
+func (s *ReleaseService) FindByArtifact(artifactVersion string) ([]*model.Release, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"artifactVersion": artifactVersion,
+		"status":          bson.M{"$in": []string{model.ReleaseStatusApproved, model.ReleaseStatusDeploying, model.ReleaseStatusCompleted}},
+	}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var releases []*model.Release
+	if err = cursor.All(ctx, &releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// FindServing 按开始部署时间倒序查询最近 limit 个部署中或已完成的发布单, 即节点当前应使用的产物的来源
+func (s *ReleaseService) FindServing(limit int64) ([]*model.Release, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"status":    bson.M{"$in": []string{model.ReleaseStatusDeploying, model.ReleaseStatusCompleted}},
+		"startedAt": bson.M{"$ne": nil},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(limit)
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var releases []*model.Release
+	if err = cursor.All(ctx, &releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// FindDeploying 查询部署中的发布单, hash 不为空时按产物 sha256 (含多平台产物) 过滤
+func (s *ReleaseService) FindDeploying(artifactSHA256 string) ([]*model.Release, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"status": model.ReleaseStatusDeploying}
+	if artifactSHA256 != "" {
+		filter["$or"] = []bson.M{{"artifactSha256": artifactSHA256}, {"artifacts.digest": artifactSHA256}}
+	}
+
+	cursor, err := s.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var releases []*model.Release
+	if err = cursor.All(ctx, &releases); err != nil {
+		return nil, err
+	}
+
+	return releases, nil
+}
+
+func (s *ReleaseService) BuildSucceeded(id string) error {
+	if err := s.Transition(id, model.ReleaseStatusPendingApproval, "system", "构建完成", nil); err != nil {
+		return err
+	}
+	return s.UpdateStage(id, model.StageApproval, model.StageStatusInProgress)
+}
+
+func (s *ReleaseService) Approve(id string, operator string, comment string) error {
+	if err := s.Transition(id, model.ReleaseStatusApproved, operator, comment, nil); err != nil {
+		return err
+	}
+	return s.UpdateStage(id, model.StageApproval, model.StageStatusCompleted)
+}
+
+// Deploy 部署前确认仍持有项目环境的发布锁, 锁已过期且被其他发布单获取时拒绝部署.
+// fields 为与状态流转一起写入的部署信息
+func (s *ReleaseService) Deploy(id string, operator string, fields bson.M) error {
+	release, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.acquireLock(release); err != nil {
+		return err
+	}
+
+	set := bson.M{"startedAt": time.Now()}
+	for k, v := range fields {
+		set[k] = v
+	}
+	err = s.Transition(id, model.ReleaseStatusDeploying, operator, "开始部署", set)
+	if err != nil {
+		return err
+	}
+	return s.UpdateStage(id, model.StageDeploy, model.StageStatusInProgress)
+}
+
+func (s *ReleaseService) Complete(id string) error {
+	err := s.Transition(id, model.ReleaseStatusCompleted, "system", "部署完成", bson.M{
+		"completedAt": time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.UpdateStage(id, model.StageDeploy, model.StageStatusCompleted); err != nil {
+		return err
+	}
+	return s.UpdateStage(id, model.StagePostCheck, model.StageStatusCompleted)
+}
+
+func (s *ReleaseService) Fail(id string, operator string, reason string) error {
+	err := s.Transition(id, model.ReleaseStatusFailed, operator, reason, bson.M{
+		"completedAt": time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return s.failRunningStages(id)
+}
+
+func (s *ReleaseService) acquireLock(release *model.Release) error {
+	if s.locks == nil {
+		return nil
+	}
+	return s.locks.Acquire(release.ProjectID, release.Environment, release.ID)
+}
+
+func (s *ReleaseService) releaseLock(id string) {
+	if s.locks == nil {
+		return
+	}
+	if err := s.locks.Release(id); err != nil {
+		log.Error().Err(err).Str("releaseId", id).Msg("释放发布锁失败")
+	}
+}
+
 func (s *ReleaseService) BatchDelete(ids []string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
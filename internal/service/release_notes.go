@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxNotePages 没有上一次发布时最多拉取的 MR/PR 页数
+	maxNotePages  = 5
+	jiraBrowseURL = "https://jira.qiniu.io/browse/"
+	jiraKeyPrefix = "MIKU-"
+	otherModule   = "其他"
+)
+
+// GenerateReleaseNotes 收集项目上一次已完成发布以来合并的 MR/PR, 按模块和 Jira 单分组后保存到发布单
+func (m *Manager) GenerateReleaseNotes(releases *ReleaseService, releaseID string) (*model.ReleaseNotes, error) {
+	release, err := releases.Get(releaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := &model.ReleaseNotes{GeneratedAt: time.Now()}
+	var since time.Time
+	previous, err := releases.previousCompleted(release)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		since = previous.CreatedAt
+		notes.PreviousReleaseID = previous.ID
+		notes.Since = &since
+	}
+
+	// 某个代码托管平台未配置或拉取失败时只记录告警, 用其余平台的变更生成发布说明
+	var items []*GitMergeRequest
+	if m.githubMgr != nil {
+		prs, err := m.githubMgr.MergedPullRequestsSince(since)
+		if err != nil {
+			log.Warn().Err(err).Str("releaseId", releaseID).Msg("拉取 GitHub PR 失败, 发布说明不包含 GitHub 变更")
+		}
+		items = append(items, prs...)
+	} else {
+		log.Warn().Str("releaseId", releaseID).Msg("未配置 GitHub, 发布说明不包含 GitHub 变更")
+	}
+	if m.gitlabMgr != nil {
+		mrs, err := m.gitlabMgr.MergedMergeRequestsSince(since)
+		if err != nil {
+			log.Warn().Err(err).Str("releaseId", releaseID).Msg("拉取 GitLab MR 失败, 发布说明不包含 GitLab 变更")
+		}
+		items = append(items, mrs...)
+	} else {
+		log.Warn().Str("releaseId", releaseID).Msg("未配置 GitLab, 发布说明不包含 GitLab 变更")
+	}
+
+	notes.Modules = groupReleaseNotes(items)
+	notes.Total = len(items)
+	notes.Markdown = renderReleaseNotes(release, notes)
+
+	if err := releases.UpdateReleaseNotes(releaseID, notes); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("releaseId", releaseID).Str("previous", notes.PreviousReleaseID).Int("total", notes.Total).Msg("已生成发布说明")
+	return notes, nil
+}
+
+// groupReleaseNotes 按变更模块和 Jira 单分组, 标题中 [a,b] 的多个模块各记一次
+func groupReleaseNotes(items []*GitMergeRequest) []model.ReleaseNoteModule {
+	grouped := map[string]map[string][]model.ReleaseNoteItem{}
+	for _, mr := range items {
+		source := "gitlab"
+		if mr.Pr != nil {
+			source = "github"
+		}
+		item := model.ReleaseNoteItem{
+			Source:   source,
+			ID:       mr.GitId,
+			Title:    mr.Title,
+			URL:      mr.WebURL,
+			Author:   mr.Author,
+			MergedAt: mr.MergedAt,
+		}
+		jiraID := ""
+		if mr.GiraId != "" && mr.GiraId != "0" {
+			jiraID = jiraKeyPrefix + mr.GiraId
+		}
+
+		modules := strings.Split(mr.ChangeModules, ",")
+		for _, module := range modules {
+			module = strings.TrimSpace(module)
+			if module == "" {
+				module = otherModule
+			}
+			if grouped[module] == nil {
+				grouped[module] = map[string][]model.ReleaseNoteItem{}
+			}
+			grouped[module][jiraID] = append(grouped[module][jiraID], item)
+		}
+	}
+
+	result := make([]model.ReleaseNoteModule, 0, len(grouped))
+	for module, issues := range grouped {
+		group := model.ReleaseNoteModule{Module: module}
+		for jiraID, items := range issues {
+			sort.Slice(items, func(i, j int) bool {
+				if items[i].MergedAt == nil || items[j].MergedAt == nil {
+					return items[j].MergedAt == nil && items[i].MergedAt != nil
+				}
+				return items[i].MergedAt.Before(*items[j].MergedAt)
+			})
+			issue := model.ReleaseNoteIssue{JiraID: jiraID, Items: items}
+			if jiraID != "" {
+				issue.JiraURL = jiraBrowseURL + jiraID
+			}
+			group.Issues = append(group.Issues, issue)
+		}
+		// 没有 Jira 单的变更排在最后
+		sort.Slice(group.Issues, func(i, j int) bool {
+			if group.Issues[i].JiraID == "" || group.Issues[j].JiraID == "" {
+				return group.Issues[j].JiraID == ""
+			}
+			return group.Issues[i].JiraID < group.Issues[j].JiraID
+		})
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Module == otherModule || result[j].Module == otherModule {
+			return result[j].Module == otherModule && result[i].Module != otherModule
+		}
+		return result[i].Module < result[j].Module
+	})
+
+	return result
+}
+
+func renderReleaseNotes(release *model.Release, notes *model.ReleaseNotes) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## 发布说明 %s\n\n", release.Version)
+	if notes.Since != nil {
+		fmt.Fprintf(&b, "自上一次发布 (%s) 以来合并的变更, 共 %d 个.\n", TimeToBeijing(*notes.Since), notes.Total)
+	} else {
+		fmt.Fprintf(&b, "最近合并的变更, 共 %d 个.\n", notes.Total)
+	}
+
+	for _, module := range notes.Modules {
+		fmt.Fprintf(&b, "\n### %s\n\n", module.Module)
+		for _, issue := range module.Issues {
+			if issue.JiraID != "" {
+				fmt.Fprintf(&b, "- [%s](%s)\n", issue.JiraID, issue.JiraURL)
+			} else {
+				b.WriteString("- 无 Jira 单\n")
+			}
+			for _, item := range issue.Items {
+				line := item.Title
+				if item.URL != "" {
+					line = fmt.Sprintf("[%s](%s)", item.Title, item.URL)
+				}
+				if item.Author != "" {
+					line += " @" + item.Author
+				}
+				fmt.Fprintf(&b, "  - %s\n", line)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// previousCompleted 返回同项目在 current 之前创建的最近一次已完成发布, 没有时返回 nil
+func (s *ReleaseService) previousCompleted(current *model.Release) (*model.Release, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":       bson.M{"$ne": current.ID},
+		"projectId": current.ProjectID,
+		"status":    model.ReleaseStatusCompleted,
+		"createdAt": bson.M{"$lt": current.CreatedAt},
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+
+	var previous model.Release
+	err := s.collection.FindOne(ctx, filter, opts).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &previous, nil
+}
+
+func (s *ReleaseService) UpdateReleaseNotes(id string, notes *model.ReleaseNotes) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"releaseNotes": notes}})
+	return err
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from string
+		to   string
+		want bool
+	}{
+		{from: model.ReleaseStatusBuilding, to: model.ReleaseStatusPendingApproval, want: true},
+		{from: model.ReleaseStatusBuilding, to: model.ReleaseStatusFailed, want: true},
+		{from: model.ReleaseStatusBuilding, to: model.ReleaseStatusApproved, want: false},
+		{from: model.ReleaseStatusPendingApproval, to: model.ReleaseStatusApproved, want: true},
+		{from: model.ReleaseStatusPendingApproval, to: model.ReleaseStatusDeploying, want: false},
+		{from: model.ReleaseStatusApproved, to: model.ReleaseStatusDeploying, want: true},
+		{from: model.ReleaseStatusApproved, to: model.ReleaseStatusCompleted, want: false},
+		{from: model.ReleaseStatusDeploying, to: model.ReleaseStatusCompleted, want: true},
+		{from: model.ReleaseStatusDeploying, to: model.ReleaseStatusRolledBack, want: true},
+		{from: model.ReleaseStatusDeploying, to: model.ReleaseStatusBuilding, want: false},
+		{from: model.ReleaseStatusCompleted, to: model.ReleaseStatusRolledBack, want: true},
+		{from: model.ReleaseStatusCompleted, to: model.ReleaseStatusFailed, want: false},
+		{from: model.ReleaseStatusFailed, to: model.ReleaseStatusBuilding, want: true},
+		{from: model.ReleaseStatusFailed, to: model.ReleaseStatusRolledBack, want: true},
+		{from: model.ReleaseStatusFailed, to: model.ReleaseStatusDeploying, want: false},
+		{from: model.ReleaseStatusRolledBack, to: model.ReleaseStatusBuilding, want: false},
+		{from: model.ReleaseStatusCompleted, to: model.ReleaseStatusCompleted, want: false},
+		{from: "", to: model.ReleaseStatusBuilding, want: false},
+		{from: "unknown", to: model.ReleaseStatusFailed, want: false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
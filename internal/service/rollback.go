@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Rollback 将发布单回滚到同项目同环境的上一个已完成发布, 或 targetVersion 指定的版本.
+// 先流转原发布单, 流转成功后才改写 GitLab 中的版本文件并生成关联原发布单的回滚发布单
+func (s *ReleaseService) Rollback(id string, targetVersion string, reason string, operator string) (*model.Release, error) {
+	current, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransition(current.Status, model.ReleaseStatusRolledBack) {
+		return nil, fmt.Errorf("%w: release %s cannot be rolled back from %q", ErrInvalidTransition, id, current.Status)
+	}
+
+	plan, err := s.planRollback(current, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	rollbackID := primitive.NewObjectID().Hex()
+
+	err = s.Transition(id, model.ReleaseStatusRolledBack, operator, reason, bson.M{
+		"rolledBackBy": rollbackID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.applyRollback(rollbackID, current, plan, reason, operator)
+}
+
+// AutoRollback 部署后健康检查失败时调用: 发布单置为失败, 再回滚到上一个已完成发布.
+// 原发布单保持 failed 状态, 通过 rolledBackBy 关联回滚发布单
+func (s *ReleaseService) AutoRollback(id string, reason string) (*model.Release, error) {
+	if err := s.Fail(id, "system", reason); err != nil {
+		return nil, err
+	}
+
+	current, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := s.planRollback(current, "previous")
+	if err != nil {
+		return nil, err
+	}
+	rollbackID := primitive.NewObjectID().Hex()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 以 failed 状态且未关联回滚发布单作为条件, 防止重复回滚
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": model.ReleaseStatusFailed, "rolledBackBy": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"rolledBackBy": rollbackID}})
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("%w: release %s has already been rolled back or changed concurrently", ErrInvalidTransition, id)
+	}
+
+	return s.applyRollback(rollbackID, current, plan, reason, "system")
+}
+
+// rollbackPlan 回滚目标发布单及其产物
+type rollbackPlan struct {
+	target   *model.Release
+	artifact string
+	digest   string
+}
+
+// planRollback 查找回滚目标并确认其产物仍在仓库中, 不做任何修改
+func (s *ReleaseService) planRollback(current *model.Release, targetVersion string) (*rollbackPlan, error) {
+	target, err := s.findRollbackTarget(current, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	artifact, digest := releaseArtifact(target)
+	if artifact == "" {
+		return nil, fmt.Errorf("release %s has no artifact to roll back to", target.ID)
+	}
+	_, digest, err = s.artifacts.Resolve(target.ProjectID, artifact, digest)
+	if err != nil {
+		return nil, fmt.Errorf("artifact %s of release %s is not available: %w", artifact, target.ID, err)
+	}
+	if s.gitlabMgr == nil {
+		return nil, fmt.Errorf("GitLab manager not initialized")
+	}
+
+	return &rollbackPlan{target: target, artifact: artifact, digest: digest}, nil
+}
+
+// applyRollback 原发布单流转后执行: 先生成回滚发布单, 再改写版本文件,
+// 改写失败时回滚发布单置为失败, 可以对其再次发起回滚
+func (s *ReleaseService) applyRollback(rollbackID string, current *model.Release, plan *rollbackPlan, reason, operator string) (*model.Release, error) {
+	rollback, err := s.createRollbackRelease(rollbackID, current, plan, reason, operator)
+	if err != nil {
+		log.Error().Err(err).Str("releaseId", current.ID).Str("rollbackId", rollbackID).Msg("原发布单已流转, 创建回滚发布单失败")
+		return nil, err
+	}
+
+	message := fmt.Sprintf("rollback %s to %s", current.Version, plan.target.Version)
+	if err := s.gitlabMgr.SetVersion(versionFileName, plan.artifact, message); err != nil {
+		if err := s.Fail(rollback.ID, "system", fmt.Sprintf("改写版本文件失败: %v", err)); err != nil {
+			log.Error().Err(err).Str("releaseId", rollback.ID).Msg("更新发布单状态失败")
+		}
+		return nil, err
+	}
+	log.Info().Str("releaseId", current.ID).Str("target", plan.target.ID).Str("artifact", plan.artifact).Msg("版本文件已回滚")
+
+	if err := s.artifacts.Reference(plan.target.ProjectID, plan.artifact, plan.digest, rollback.ID); err != nil {
+		log.Warn().Err(err).Str("releaseId", rollback.ID).Msg("记录产物引用失败")
+	}
+	return rollback, nil
+}
+
+// findRollbackTarget targetVersion 为空或 previous 时取当前发布之前最近一次已完成的发布
+func (s *ReleaseService) findRollbackTarget(current *model.Release, targetVersion string) (*model.Release, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":         bson.M{"$ne": current.ID},
+		"projectId":   current.ProjectID,
+		"environment": current.Environment,
+		"status":      model.ReleaseStatusCompleted,
+	}
+	if targetVersion == "" || targetVersion == "previous" {
+		filter["createdAt"] = bson.M{"$lt": current.CreatedAt}
+	} else {
+		filter["$or"] = []bson.M{
+			{"version": targetVersion},
+			{"artifactVersion": targetVersion},
+			{"tarFileName": targetVersion},
+		}
+	}
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	var target model.Release
+	err := s.collection.FindOne(ctx, filter, opts).Decode(&target)
+	if err != nil {
+		return nil, fmt.Errorf("no completed release to roll back to for project %s in %s: %w", current.ProjectID, current.Environment, err)
+	}
+
+	return &target, nil
+}
+
+// createRollbackRelease 回滚发布单跳过构建和审批, 直接进入部署阶段
+func (s *ReleaseService) createRollbackRelease(id string, current *model.Release, plan *rollbackPlan, reason, operator string) (*model.Release, error) {
+	target := plan.target
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	stages := newReleaseStages()
+	for i := range stages {
+		switch stages[i].Name {
+		case model.StageDeploy:
+			stages[i].Status = model.StageStatusInProgress
+			stages[i].StartTime = &now
+		case model.StagePostCheck:
+		default:
+			stages[i].Status = model.StageStatusSkipped
+		}
+	}
+
+	rollback := &model.Release{
+		ID:              id,
+		ProjectID:       current.ProjectID,
+		ProjectName:     current.ProjectName,
+		ApplicationID:   current.ApplicationID,
+		Version:         target.Version,
+		Environment:     current.Environment,
+		Strategy:        current.Strategy,
+		Status:          model.ReleaseStatusDeploying,
+		Description:     fmt.Sprintf("回滚 %s 到 %s: %s", current.Version, target.Version, reason),
+		Scheduler:       current.Scheduler,
+		TriggeredBy:     operator,
+		GitlabPRURL:     target.GitlabPRURL,
+		TarFileName:     target.TarFileName,
+		ArtifactVersion: target.ArtifactVersion,
+		ArtifactSHA256:  plan.digest,
+		Artifacts:       target.Artifacts,
+		RollbackOf:      current.ID,
+		Stages:          stages,
+		StartedAt:       &now,
+		CreatedAt:       now,
+	}
+
+	// 回滚不等待, 直接接管项目环境的发布锁
+	if s.locks != nil {
+		if err := s.locks.Takeover(rollback.ProjectID, rollback.Environment, rollback.ID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.collection.InsertOne(ctx, rollback); err != nil {
+		s.releaseLock(rollback.ID)
+		return nil, err
+	}
+	if err := s.recordEvent(ctx, rollback.ID, "", rollback.Status, operator, rollback.Description); err != nil {
+		return nil, err
+	}
+
+	return rollback, nil
+}
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// isRolloutStrategy 金丝雀、滚动和蓝绿按批次推进, 其余策略一次性部署所有节点
+func isRolloutStrategy(strategy string) bool {
+	switch strategy {
+	case model.StrategyCanary, model.StrategyRolling, "rolling", model.StrategyBlueGreen:
+		return true
+	}
+	return false
+}
+
+// planRollout 按发布策略将目标节点拆分为批次:
+// 金丝雀按 CanarySteps 的累计百分比, 滚动更新每批 MaxUnavailable 个节点, 蓝绿一次切换全部节点
+func (s *DeployService) planRollout(strategy string, targets []string) []model.RolloutStep {
+	nodes := append([]string(nil), targets...)
+	sort.Strings(nodes)
+	total := len(nodes)
+
+	var steps []model.RolloutStep
+	addStep := func(batch []string, percent int) {
+		steps = append(steps, model.RolloutStep{
+			Index:   len(steps),
+			Percent: percent,
+			Nodes:   batch,
+			Status:  model.StageStatusPending,
+		})
+	}
+
+	switch strategy {
+	case model.StrategyCanary:
+		done := 0
+		for _, percent := range s.conf.CanarySteps {
+			n := int(math.Ceil(float64(total) * float64(percent) / 100))
+			if n > total {
+				n = total
+			}
+			if n <= done {
+				continue
+			}
+			addStep(nodes[done:n], percent)
+			done = n
+		}
+		if done < total {
+			addStep(nodes[done:], 100)
+		}
+	case model.StrategyRolling, "rolling":
+		for start := 0; start < total; start += s.conf.MaxUnavailable {
+			end := start + s.conf.MaxUnavailable
+			if end > total {
+				end = total
+			}
+			addStep(nodes[start:end], end*100/total)
+		}
+	default:
+		addStep(nodes, 100)
+	}
+
+	return steps
+}
+
+// rolloutPlan 拆分批次并开始第一批, 批次外的节点继续使用上一次已完成发布的产物, 非分批策略返回 nil
+func (s *DeployService) rolloutPlan(release *model.Release, targets []string) bson.M {
+	if !isRolloutStrategy(release.Strategy) {
+		return nil
+	}
+
+	previous, previousRelease := "", ""
+	if target, err := s.releases.findRollbackTarget(release, "previous"); err == nil {
+		previous, _ = releaseArtifact(target)
+		previousRelease = target.ID
+	}
+	if previous == "" {
+		log.Warn().Str("releaseId", release.ID).Msg("没有上一次已完成发布的产物, 批次外节点将使用版本文件中的版本")
+	}
+
+	now := time.Now()
+	steps := s.planRollout(release.Strategy, targets)
+	steps[0].Status = model.StageStatusInProgress
+	steps[0].StartedAt = &now
+
+	log.Info().Str("releaseId", release.ID).Str("strategy", release.Strategy).Int("steps", len(steps)).Str("previous", previous).Msg("按发布策略分批部署")
+	return bson.M{
+		"previousArtifact": previous,
+		"previousRelease":  previousRelease,
+		"rolloutSteps":     steps,
+	}
+}
+
+// ArtifactRef 节点应使用的产物, 按项目和 sha256 在仓库中查找; 只有 Version 时只能从 downloads 目录查找
+type ArtifactRef struct {
+	ProjectID string
+	Version   string
+	Digest    string
+	Variants  []model.ArtifactVariant
+}
+
+func releaseArtifactRef(release *model.Release) *ArtifactRef {
+	version, digest := releaseArtifact(release)
+	return &ArtifactRef{
+		ProjectID: release.ProjectID,
+		Version:   version,
+		Digest:    digest,
+		Variants:  release.Artifacts,
+	}
+}
+
+// ServedArtifact 返回分批部署期间节点上 binName 应使用的产物, 没有该 bin 进行中的分批部署时 ok 为 false.
+// 批次中记录的是节点名, nodeID 先换算为同一标识再比较
+func (s *DeployService) ServedArtifact(binName, nodeID string) (*ArtifactRef, bool) {
+	releases, err := s.releases.FindDeploying("")
+	if err != nil {
+		log.Error().Err(err).Msg("查询部署中的发布单失败")
+		return nil, false
+	}
+
+	target := nodeID
+	if node, ok := s.bins.GetNode(nodeID); ok {
+		target = nodeTarget(node)
+	}
+	for _, release := range releases {
+		if len(release.RolloutSteps) == 0 || !s.servesBin(release, binName) {
+			continue
+		}
+		if rolledOut(release, target) {
+			return releaseArtifactRef(release), true
+		}
+		if release.PreviousRelease != "" {
+			previous, err := s.releases.Get(release.PreviousRelease)
+			if err == nil {
+				return releaseArtifactRef(previous), true
+			}
+			log.Warn().Err(err).Str("releaseId", release.ID).Str("previous", release.PreviousRelease).Msg("查询上一次发布单失败")
+		}
+		if release.PreviousArtifact != "" {
+			return &ArtifactRef{ProjectID: release.ProjectID, Version: release.PreviousArtifact}, true
+		}
+	}
+	return nil, false
+}
+
+// rolledOut 节点是否在已开始的批次中
+func rolledOut(release *model.Release, target string) bool {
+	for _, step := range release.RolloutSteps {
+		if step.Status == model.StageStatusPending {
+			continue
+		}
+		for _, node := range step.Nodes {
+			if node == target {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// servingLookupLimit 查找 bin 当前产物时最多检查的最近发布单数
+const servingLookupLimit = 50
+
+// CurrentArtifact 返回服务 binName 的最近开始部署的发布单 (部署中或已完成) 的产物,
+// 与版本文件中的版本一致, 不需要读取 GitLab; 没有记录产物的发布单时 ok 为 false
+func (s *DeployService) CurrentArtifact(binName string) (*ArtifactRef, bool) {
+	releases, err := s.releases.FindServing(servingLookupLimit)
+	if err != nil {
+		log.Error().Err(err).Msg("查询已部署的发布单失败")
+		return nil, false
+	}
+	for _, release := range releases {
+		if version, digest := releaseArtifact(release); version == "" && digest == "" {
+			continue
+		}
+		if s.servesBin(release, binName) {
+			return releaseArtifactRef(release), true
+		}
+	}
+	return nil, false
+}
+
+// VersionArtifact 返回版本文件中的版本对应的产物: 取服务该 bin 的发布单中产物为 version 的最新一个,
+// 版本名在项目之间可能重复, 没有匹配的发布单时 ok 为 false
+func (s *DeployService) VersionArtifact(binName, version string) (*ArtifactRef, bool) {
+	releases, err := s.releases.FindByArtifact(version)
+	if err != nil {
+		log.Error().Err(err).Str("version", version).Msg("查询产物对应的发布单失败")
+		return nil, false
+	}
+	for _, release := range releases {
+		if s.servesBin(release, binName) {
+			return releaseArtifactRef(release), true
+		}
+	}
+	return nil, false
+}
+
+// servesBin 发布单指定了应用时匹配应用 code, 否则匹配项目 code 或项目下任一应用的 code
+func (s *DeployService) servesBin(release *model.Release, binName string) bool {
+	if binName == "" {
+		return false
+	}
+	if release.ApplicationID != "" {
+		if s.apps == nil {
+			return false
+		}
+		app, err := s.apps.Get(release.ApplicationID)
+		return err == nil && app.Code == binName
+	}
+
+	if s.projects != nil {
+		if project, err := s.projects.Get(release.ProjectID); err == nil && project.Code == binName {
+			return true
+		}
+	}
+	if s.apps != nil {
+		apps, err := s.apps.List(release.ProjectID)
+		if err != nil {
+			log.Warn().Err(err).Str("releaseId", release.ID).Msg("查询项目应用失败")
+			return false
+		}
+		for _, app := range apps {
+			if app.Code == binName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// evaluateRollout 推进当前批次: 失败比例超限或超时则失败,
+// 批次成功后金丝雀进入观察期, 观察期结束或其他策略直接进入下一批, 最后一批完成后进入健康检查
+func (s *DeployService) evaluateRollout(release *model.Release, timedOut bool) error {
+	index := -1
+	for i, step := range release.RolloutSteps {
+		if step.Status != model.StageStatusCompleted {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return s.finish(release)
+	}
+	step := release.RolloutSteps[index]
+
+	summary, err := s.Summary(release.ID)
+	if err != nil {
+		return err
+	}
+	reported := make(map[string]string, len(summary.Nodes))
+	for _, node := range summary.Nodes {
+		reported[node.NodeName] = node.Status
+	}
+	success, failed := 0, 0
+	for _, node := range step.Nodes {
+		switch reported[node] {
+		case NodeStatusSuccess:
+			success++
+		case NodeStatusFailed:
+			failed++
+		}
+	}
+
+	total := len(step.Nodes)
+	required := s.required(total)
+	now := time.Now()
+	switch {
+	case failed > total-required:
+		return s.failRollout(release, index, fmt.Sprintf("第 %d 批失败节点过多: 成功 %d, 失败 %d, 共 %d", index+1, success, failed, total))
+	case s.conf.MaxFailureRatio > 0 && float64(failed)/float64(total) > s.conf.MaxFailureRatio:
+		return s.failRollout(release, index, fmt.Sprintf("第 %d 批失败节点比例超过 %.2f: 失败 %d, 共 %d", index+1, s.conf.MaxFailureRatio, failed, total))
+	case step.Status == model.StageStatusInProgress && success >= required:
+		if release.Strategy == model.StrategyCanary && index < len(release.RolloutSteps)-1 {
+			verifyUntil := now.Add(time.Duration(s.conf.StepWaitSeconds) * time.Second)
+			_, err := s.releases.UpdateRolloutStep(release.ID, index, []string{model.StageStatusInProgress}, bson.M{
+				"status":      model.StepStatusVerifying,
+				"verifyUntil": verifyUntil,
+			}, nil)
+			log.Info().Str("releaseId", release.ID).Int("step", index+1).Time("verifyUntil", verifyUntil).Msg("批次升级完成, 进入观察期")
+			return err
+		}
+		return s.advanceRollout(release, index)
+	case step.Status == model.StepStatusVerifying && step.VerifyUntil != nil && !now.Before(*step.VerifyUntil):
+		// 观察期结束后批次节点健康才进入下一批, 超时仍不健康则失败
+		if reason := s.stepUnhealthy(release, step); reason != "" {
+			if timedOut {
+				return s.failRollout(release, index, fmt.Sprintf("第 %d 批观察期结束后节点仍不健康: %s", index+1, reason))
+			}
+			log.Warn().Str("releaseId", release.ID).Int("step", index+1).Str("reason", reason).Msg("批次节点不健康, 暂不进入下一批")
+			return nil
+		}
+		return s.advanceRollout(release, index)
+	case timedOut:
+		return s.failRollout(release, index, fmt.Sprintf("第 %d 批部署超时: 成功 %d, 需要 %d, 共 %d", index+1, success, required, total))
+	}
+	return nil
+}
+
+// stepUnhealthy 检查批次节点的健康上报: 节点需在 NodeActiveMinutes 内上报过 keepalive,
+// 应用配置了健康检查地址时批次节点的地址需探测成功. 返回不健康的原因, 健康时返回空
+func (s *DeployService) stepUnhealthy(release *model.Release, step model.RolloutStep) string {
+	active := make(map[string]bool)
+	for _, node := range s.bins.ActiveNodes(time.Duration(s.conf.NodeActiveMinutes) * time.Minute) {
+		active[node.NodeName] = true
+		active[node.NodeID] = true
+	}
+	inStep := make(map[string]bool, len(step.Nodes))
+	for _, node := range step.Nodes {
+		inStep[node] = true
+		if !active[node] {
+			return fmt.Sprintf("节点 %s 未上报 keepalive", node)
+		}
+	}
+
+	for _, target := range s.healthTargets(release) {
+		if target.Node != "" && !inStep[target.Node] {
+			continue
+		}
+		if probe := s.probe(target); !probe.Healthy {
+			detail := probe.Error
+			if detail == "" {
+				detail = fmt.Sprintf("HTTP %d", probe.StatusCode)
+			}
+			return fmt.Sprintf("%s 探测失败: %s", target.URL, detail)
+		}
+	}
+	return ""
+}
+
+func (s *DeployService) advanceRollout(release *model.Release, index int) error {
+	last := index == len(release.RolloutSteps)-1
+	// 最后一批完成前先将版本文件指向新产物, 发布完成后所有节点都使用新产物
+	if last {
+		if err := s.setServedVersion(release.ArtifactVersion, fmt.Sprintf("release %s rollout completed", release.Version)); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	ok, err := s.releases.UpdateRolloutStep(release.ID, index,
+		[]string{model.StageStatusInProgress, model.StepStatusVerifying},
+		bson.M{"status": model.StageStatusCompleted, "endedAt": now}, nil)
+	if err != nil || !ok {
+		return err
+	}
+	log.Info().Str("releaseId", release.ID).Int("step", index+1).Int("steps", len(release.RolloutSteps)).Msg("批次完成")
+
+	if last {
+		return s.finish(release)
+	}
+
+	_, err = s.releases.UpdateRolloutStep(release.ID, index+1, []string{model.StageStatusPending},
+		bson.M{"status": model.StageStatusInProgress, "startedAt": now},
+		bson.M{"deployDeadline": now.Add(time.Duration(s.conf.TimeoutMinutes) * time.Minute)})
+	return err
+}
+
+// failRollout 批次失败时发布单失败, 并将版本文件恢复为旧产物, 所有节点切回旧版本
+func (s *DeployService) failRollout(release *model.Release, index int, reason string) error {
+	ok, err := s.releases.UpdateRolloutStep(release.ID, index,
+		[]string{model.StageStatusInProgress, model.StepStatusVerifying},
+		bson.M{"status": model.StageStatusFailed, "message": reason, "endedAt": time.Now()}, nil)
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := s.releases.Fail(release.ID, "system", reason); err != nil {
+		return err
+	}
+
+	if release.PreviousArtifact != "" {
+		if err := s.setServedVersion(release.PreviousArtifact, fmt.Sprintf("release %s rollout failed", release.Version)); err != nil {
+			log.Error().Err(err).Str("releaseId", release.ID).Msg("恢复版本文件失败")
+			return err
+		}
+	}
+	return nil
+}
+
+// setServedVersion 版本文件已是目标产物时不重复提交
+func (s *DeployService) setServedVersion(artifact string, message string) error {
+	gitlabMgr := s.releases.gitlabMgr
+	if gitlabMgr == nil || artifact == "" {
+		return nil
+	}
+
+	current, err := gitlabMgr.GetVersion(versionFileName)
+	if err == nil && current == artifact {
+		return nil
+	}
+	return gitlabMgr.SetVersion(versionFileName, artifact, message)
+}
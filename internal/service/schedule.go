@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/db"
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrScheduleNotPending = errors.New("schedule is not pending")
+	ErrScheduleExists     = errors.New("release already has a pending schedule")
+	ErrInvalidSchedule    = errors.New("invalid schedule")
+)
+
+const (
+	schedulePollInterval         = 10 * time.Second
+	defaultWindowDurationMinutes = 60
+	lockedRetryInterval          = time.Minute
+)
+
+// ScheduleService 定时部署: 计划持久化在 MongoDB, 进程重启后继续生效.
+// 到期的计划由 dispatch 原子地置为 triggered 后调用 DeployService.Deploy
+type ScheduleService struct {
+	collection *mongo.Collection
+	releases   *ReleaseService
+	deploy     *DeployService
+	freeze     *FreezeService
+}
+
+func NewScheduleService(mongodb *db.MongoDB, releases *ReleaseService, deploy *DeployService) *ScheduleService {
+	return &ScheduleService{
+		collection: mongodb.Database.Collection("deploy_schedules"),
+		releases:   releases,
+		deploy:     deploy,
+	}
+}
+
+func (s *ScheduleService) SetFreezeService(freeze *FreezeService) {
+	s.freeze = freeze
+}
+
+// Create 为已审批的发布单创建定时部署, runAt 和 window 二选一
+func (s *ScheduleService) Create(releaseID string, runAt *time.Time, window *model.MaintenanceWindow, operator string) (*model.DeploySchedule, error) {
+	release, err := s.releases.Get(releaseID)
+	if err != nil {
+		return nil, err
+	}
+	if release.Status != model.ReleaseStatusApproved {
+		return nil, fmt.Errorf("%w: release %s is %q, only approved releases can be scheduled", ErrInvalidTransition, releaseID, release.Status)
+	}
+
+	next, err := scheduleRunAt(runAt, window, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := s.collection.CountDocuments(ctx, bson.M{"releaseId": releaseID, "status": model.ScheduleStatusPending})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrScheduleExists
+	}
+
+	// 未指定操作人时以发布单的调度人作为部署操作人
+	if operator == "" {
+		operator = release.Scheduler
+	}
+
+	now := time.Now()
+	schedule := &model.DeploySchedule{
+		ID:          primitive.NewObjectID().Hex(),
+		ReleaseID:   releaseID,
+		ProjectID:   release.ProjectID,
+		Environment: release.Environment,
+		RunAt:       next,
+		Window:      window,
+		Status:      model.ScheduleStatusPending,
+		Operator:    operator,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if _, err := s.collection.InsertOne(ctx, schedule); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("releaseId", releaseID).Time("runAt", next).Str("operator", operator).Msg("已创建定时部署")
+	return schedule, nil
+}
+
+func (s *ScheduleService) Get(id string) (*model.DeploySchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var schedule model.DeploySchedule
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// List 按状态查询定时部署, status 为空时返回全部
+func (s *ScheduleService) List(status string, releaseID string) ([]*model.DeploySchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if status != "" {
+		filter["status"] = status
+	}
+	if releaseID != "" {
+		filter["releaseId"] = releaseID
+	}
+
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "runAt", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	schedules := []*model.DeploySchedule{}
+	if err = cursor.All(ctx, &schedules); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// Reschedule 修改待执行计划的时间或维护窗口
+func (s *ScheduleService) Reschedule(id string, runAt *time.Time, window *model.MaintenanceWindow, operator string) (*model.DeploySchedule, error) {
+	next, err := scheduleRunAt(runAt, window, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	set := bson.M{
+		"runAt":     next,
+		"window":    window,
+		"updatedAt": time.Now(),
+	}
+	if operator != "" {
+		set["operator"] = operator
+	}
+	if err := s.updatePending(id, set); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("scheduleId", id).Time("runAt", next).Str("operator", operator).Msg("定时部署已调整")
+	return s.Get(id)
+}
+
+func (s *ScheduleService) Cancel(id string, operator string) error {
+	err := s.updatePending(id, bson.M{
+		"status":    model.ScheduleStatusCancelled,
+		"updatedAt": time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("scheduleId", id).Str("operator", operator).Msg("定时部署已取消")
+	return nil
+}
+
+// updatePending 只更新仍处于 pending 的计划, 避免与触发并发
+func (s *ScheduleService) updatePending(id string, set bson.M) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": model.ScheduleStatusPending},
+		bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if _, err := s.Get(id); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrScheduleNotPending, id)
+	}
+	return nil
+}
+
+// Start 启动定时部署轮询, 重启后会立即处理停机期间到期的计划
+func (s *ScheduleService) Start(ctx context.Context) {
+	go func() {
+		s.dispatch()
+
+		ticker := time.NewTicker(schedulePollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.dispatch()
+			}
+		}
+	}()
+}
+
+func (s *ScheduleService) dispatch() {
+	for {
+		schedule, err := s.claim()
+		if err != nil {
+			log.Error().Err(err).Msg("领取定时部署失败")
+			return
+		}
+		if schedule == nil {
+			return
+		}
+		s.trigger(schedule)
+	}
+}
+
+// claim 原子地将一个到期计划置为 triggered, 保证同一计划只会触发一次
+func (s *ScheduleService) claim() (*model.DeploySchedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"status": model.ScheduleStatusPending,
+		"runAt":  bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":      model.ScheduleStatusTriggered,
+		"triggeredAt": now,
+		"updatedAt":   now,
+	}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "runAt", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var schedule model.DeploySchedule
+	err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&schedule)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+func (s *ScheduleService) trigger(schedule *model.DeploySchedule) {
+	// 停机错过了维护窗口时顺延到下一个窗口, 不在窗口外部署
+	if schedule.Window != nil {
+		now := time.Now()
+		next, err := nextWindowStart(schedule.Window, now)
+		if err == nil && next.After(now) {
+			s.setStatus(schedule.ID, bson.M{"status": model.ScheduleStatusPending, "runAt": next})
+			log.Warn().Str("scheduleId", schedule.ID).Time("runAt", next).Msg("已错过维护窗口, 顺延到下一个窗口")
+			return
+		}
+	}
+
+	// 封版期间不自动部署, 顺延到封版结束
+	if s.freeze != nil {
+		window, err := s.freeze.Active(schedule.ProjectID, schedule.Environment, time.Now())
+		if err != nil {
+			log.Error().Err(err).Str("scheduleId", schedule.ID).Msg("查询封版窗口失败")
+		}
+		if window != nil {
+			s.setStatus(schedule.ID, bson.M{"status": model.ScheduleStatusPending, "runAt": window.EndAt})
+			log.Warn().Str("scheduleId", schedule.ID).Str("freezeId", window.ID).Time("runAt", window.EndAt).Msg("封版期间, 定时部署顺延")
+			return
+		}
+	}
+
+	log.Info().Str("scheduleId", schedule.ID).Str("releaseId", schedule.ReleaseID).Msg("定时部署开始")
+	err := s.deploy.Deploy(schedule.ReleaseID, schedule.Operator)
+	// 同项目同环境有其他发布单进行中时排队, 稍后重试
+	if errors.Is(err, ErrReleaseLocked) {
+		next := time.Now().Add(lockedRetryInterval)
+		s.setStatus(schedule.ID, bson.M{"status": model.ScheduleStatusPending, "runAt": next, "lastError": err.Error()})
+		log.Warn().Err(err).Str("scheduleId", schedule.ID).Time("runAt", next).Msg("发布锁被占用, 定时部署排队等待")
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("scheduleId", schedule.ID).Str("releaseId", schedule.ReleaseID).Msg("定时部署失败")
+		s.setStatus(schedule.ID, bson.M{"status": model.ScheduleStatusFailed, "lastError": err.Error()})
+	}
+}
+
+func (s *ScheduleService) setStatus(id string, set bson.M) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	set["updatedAt"] = time.Now()
+	if _, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set}); err != nil {
+		log.Error().Err(err).Str("scheduleId", id).Msg("更新定时部署状态失败")
+	}
+}
+
+// scheduleRunAt 计算计划的执行时间, 指定 window 时取下一个窗口的开始时间
+func scheduleRunAt(runAt *time.Time, window *model.MaintenanceWindow, now time.Time) (time.Time, error) {
+	if window != nil {
+		if window.DurationMinutes <= 0 {
+			window.DurationMinutes = defaultWindowDurationMinutes
+		}
+		return nextWindowStart(window, now)
+	}
+	if runAt == nil {
+		return time.Time{}, fmt.Errorf("%w: runAt or window is required", ErrInvalidSchedule)
+	}
+	if runAt.Before(now) {
+		return time.Time{}, fmt.Errorf("%w: runAt %s is in the past", ErrInvalidSchedule, runAt.Format(time.RFC3339))
+	}
+	return *runAt, nil
+}
+
+// nextWindowStart 返回 after 之后最近的窗口开始时间, after 正处于窗口内时直接返回 after
+func nextWindowStart(window *model.MaintenanceWindow, after time.Time) (time.Time, error) {
+	start, err := time.ParseInLocation("15:04", window.StartTime, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: startTime must be HH:MM: %v", ErrInvalidSchedule, err)
+	}
+	weekdays := make(map[time.Weekday]bool, len(window.Weekdays))
+	for _, d := range window.Weekdays {
+		if d < 0 || d > 6 {
+			return time.Time{}, fmt.Errorf("%w: weekday %d out of range 0-6", ErrInvalidSchedule, d)
+		}
+		weekdays[time.Weekday(d)] = true
+	}
+
+	duration := time.Duration(window.DurationMinutes) * time.Minute
+	local := after.In(time.Local)
+	// 从前一天开始找, 覆盖跨零点的窗口
+	for i := -1; i <= 7; i++ {
+		day := local.AddDate(0, 0, i)
+		if len(weekdays) > 0 && !weekdays[day.Weekday()] {
+			continue
+		}
+		begin := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, time.Local)
+		if !after.Before(begin) && after.Before(begin.Add(duration)) {
+			return after, nil
+		}
+		if !begin.Before(after) {
+			return begin, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: no upcoming maintenance window", ErrInvalidSchedule)
+}
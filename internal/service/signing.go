@@ -0,0 +1,306 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	signatureAlgorithm = "ed25519"
+	activeKeyFile      = "active"
+)
+
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrSigningKeyActive   = errors.New("signing key is active")
+	ErrArtifactNotSigned  = errors.New("artifact is not signed")
+)
+
+type signingKey struct {
+	id        string
+	public    ed25519.PublicKey
+	private   ed25519.PrivateKey // 只信任公钥时为 nil
+	files     []string
+	createdAt time.Time
+}
+
+// artifactSigner 管理产物签名密钥: 目录下 <id>.key 为 PKCS#8 私钥, <id>.pub 为 PKIX 公钥, active 文件记录当前签名密钥.
+// 目录下的所有公钥都受信任, 轮换后旧密钥的签名仍然有效, 直到旧密钥被移除; 也可以直接放入其他环境的 .pub 文件
+type artifactSigner struct {
+	dir    string
+	mu     sync.RWMutex
+	keys   map[string]*signingKey
+	active string
+}
+
+func newArtifactSigner(dir string) (*artifactSigner, error) {
+	s := &artifactSigner{dir: dir}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if s.active == "" {
+		key, err := s.Rotate()
+		if err != nil {
+			return nil, err
+		}
+		log.Info().Str("keyId", key.ID).Str("dir", dir).Msg("已生成产物签名密钥")
+	}
+	return s, nil
+}
+
+// signedMessage 签名内容, bin-proxy 计算文件 sha256 后按同样格式验签
+func signedMessage(digest string) []byte {
+	return []byte("sha256:" + digest)
+}
+
+func signingKeyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+func (s *artifactSigner) load() error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey)
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".key" && ext != ".pub") {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		key, err := readSigningKey(path)
+		if err != nil {
+			return fmt.Errorf("failed to load signing key %s: %w", path, err)
+		}
+		if existing, ok := keys[key.id]; ok {
+			existing.files = append(existing.files, path)
+			if existing.private == nil {
+				existing.private = key.private
+			}
+			continue
+		}
+		keys[key.id] = key
+	}
+
+	active := ""
+	if data, err := os.ReadFile(filepath.Join(s.dir, activeKeyFile)); err == nil {
+		active = strings.TrimSpace(string(data))
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if key, ok := keys[active]; !ok || key.private == nil {
+		// 没有记录或记录的密钥没有私钥时使用最新的私钥
+		active = ""
+		for id, key := range keys {
+			if key.private != nil && (active == "" || key.createdAt.After(keys[active].createdAt)) {
+				active = id
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.active = active
+	s.mu.Unlock()
+	return nil
+}
+
+func readSigningKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &signingKey{files: []string{path}, createdAt: info.ModTime()}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", parsed)
+		}
+		key.private = private
+		key.public = private.Public().(ed25519.PublicKey)
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		public, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported public key type %T", parsed)
+		}
+		key.public = public
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	key.id = signingKeyID(key.public)
+	return key, nil
+}
+
+// Sign 用当前密钥签名产物的 sha256
+func (s *artifactSigner) Sign(digest string) (*model.ArtifactSignature, error) {
+	s.mu.RLock()
+	key, ok := s.keys[s.active]
+	s.mu.RUnlock()
+	if !ok || key.private == nil {
+		return nil, fmt.Errorf("%w: no active key", ErrSigningKeyNotFound)
+	}
+
+	return &model.ArtifactSignature{
+		KeyID:     key.id,
+		Algorithm: signatureAlgorithm,
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key.private, signedMessage(digest))),
+		SignedAt:  time.Now(),
+	}, nil
+}
+
+// Verify 检查签名是否由受信任的密钥签发
+func (s *artifactSigner) Verify(digest string, signature *model.ArtifactSignature) bool {
+	s.mu.RLock()
+	key, ok := s.keys[signature.KeyID]
+	s.mu.RUnlock()
+	if !ok || signature.Algorithm != signatureAlgorithm {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(key.public, signedMessage(digest), sig)
+}
+
+func (s *artifactSigner) ActiveKeyID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.active
+}
+
+// Keys 返回受信任的公钥, 当前签名密钥在前, 其余按创建时间倒序
+func (s *artifactSigner) Keys() []*model.SigningKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*model.SigningKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		der, err := x509.MarshalPKIXPublicKey(key.public)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, &model.SigningKey{
+			ID:        key.id,
+			Algorithm: signatureAlgorithm,
+			PublicKey: base64.StdEncoding.EncodeToString(key.public),
+			PEM:       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+			Active:    key.id == s.active,
+			CreatedAt: key.createdAt,
+		})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Active != keys[j].Active {
+			return keys[i].Active
+		}
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// Rotate 生成新密钥并设为当前签名密钥, 旧密钥保留为受信任的公钥
+func (s *artifactSigner) Rotate() (*model.SigningKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := signingKeyID(public)
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	privateFile := filepath.Join(s.dir, id+".key")
+	publicFile := filepath.Join(s.dir, id+".pub")
+	if err := os.WriteFile(privateFile, privatePEM, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(publicFile, publicPEM, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, activeKeyFile), []byte(id+"\n"), 0600); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.keys == nil {
+		s.keys = make(map[string]*signingKey)
+	}
+	s.keys[id] = &signingKey{id: id, public: public, private: private, files: []string{privateFile, publicFile}, createdAt: time.Now()}
+	s.active = id
+	s.mu.Unlock()
+
+	for _, key := range s.Keys() {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSigningKeyNotFound, id)
+}
+
+// Retire 移除不再信任的密钥, 当前签名密钥不能移除
+func (s *artifactSigner) Retire(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSigningKeyNotFound, id)
+	}
+	if id == s.active {
+		return fmt.Errorf("%w: %s, rotate before retiring it", ErrSigningKeyActive, id)
+	}
+	for _, file := range key.files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	delete(s.keys, id)
+	return nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+)
+
+const testDigest = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func TestArtifactSignerVerify(t *testing.T) {
+	signer, err := newArtifactSigner(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := signer.Sign(testDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := *signature
+	tampered.Signature = "AAAA" + signature.Signature[4:]
+	tests := []struct {
+		name      string
+		digest    string
+		signature model.ArtifactSignature
+		want      bool
+	}{
+		{name: "valid", digest: testDigest, signature: *signature, want: true},
+		{name: "other digest", digest: "0" + testDigest[1:], signature: *signature, want: false},
+		{name: "tampered signature", digest: testDigest, signature: tampered, want: false},
+		{name: "unknown key", digest: testDigest, signature: model.ArtifactSignature{KeyID: "unknown", Algorithm: signature.Algorithm, Signature: signature.Signature}, want: false},
+		{name: "other algorithm", digest: testDigest, signature: model.ArtifactSignature{KeyID: signature.KeyID, Algorithm: "rsa", Signature: signature.Signature}, want: false},
+		{name: "invalid base64", digest: testDigest, signature: model.ArtifactSignature{KeyID: signature.KeyID, Algorithm: signature.Algorithm, Signature: "!"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signer.Verify(tt.digest, &tt.signature); got != tt.want {
+				t.Fatalf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestArtifactSignerRotate 轮换后旧签名仍然有效, 移除旧密钥后失效, 重新加载目录后保持当前密钥
+func TestArtifactSignerRotate(t *testing.T) {
+	dir := t.TempDir()
+	signer, err := newArtifactSigner(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := signer.ActiveKeyID()
+	oldSignature, err := signer.Sign(testDigest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := signer.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.ID == old || signer.ActiveKeyID() != key.ID {
+		t.Fatalf("active key = %s after rotating from %s, want %s", signer.ActiveKeyID(), old, key.ID)
+	}
+	if keys := signer.Keys(); len(keys) != 2 || keys[0].ID != key.ID || !keys[0].Active {
+		t.Fatalf("Keys() should list the new active key first, got %+v", keys)
+	}
+	if !signer.Verify(testDigest, oldSignature) {
+		t.Fatal("signature of the rotated key should still verify")
+	}
+
+	if err := signer.Retire(key.ID); !errors.Is(err, ErrSigningKeyActive) {
+		t.Fatalf("Retire(active) err = %v, want %v", err, ErrSigningKeyActive)
+	}
+	if err := signer.Retire(old); err != nil {
+		t.Fatal(err)
+	}
+	if signer.Verify(testDigest, oldSignature) {
+		t.Fatal("signature of a retired key should not verify")
+	}
+	if _, err := os.Stat(filepath.Join(dir, old+".key")); !os.IsNotExist(err) {
+		t.Fatalf("retired private key should be removed, stat err = %v", err)
+	}
+
+	reloaded, err := newArtifactSigner(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded.ActiveKeyID() != key.ID || len(reloaded.Keys()) != 1 {
+		t.Fatalf("reloaded signer: active %s, %d keys, want %s and 1 key", reloaded.ActiveKeyID(), len(reloaded.Keys()), key.ID)
+	}
+}
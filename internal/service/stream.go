@@ -0,0 +1,195 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/felix-001/qnHackathon/internal/model"
+)
+
+const (
+	StreamEventStatus   = "release_status"
+	StreamEventStage    = "stage"
+	StreamEventBuildLog = "build_log"
+	StreamEventNode     = "node_progress"
+
+	// streamBufferSize 保留最近的事件数, 重连时从中续传
+	streamBufferSize = 2000
+	// streamSubscriberBuffer 订阅者消费过慢时断开, 由客户端带 Last-Event-ID 重连
+	streamSubscriberBuffer = 256
+)
+
+// StreamFilter 为空的字段不过滤
+type StreamFilter struct {
+	ProjectID string
+	ReleaseID string
+	Types     []string
+}
+
+func (f StreamFilter) match(event *model.StreamEvent) bool {
+	if f.ProjectID != "" && f.ProjectID != event.ProjectID {
+		return false
+	}
+	if f.ReleaseID != "" && f.ReleaseID != event.ReleaseID {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+type Subscription struct {
+	C      chan *model.StreamEvent
+	filter StreamFilter
+	closed bool
+}
+
+// EventBus 进程内的发布事件广播, 保留最近 streamBufferSize 条事件用于续传.
+// 事件 ID 从启动时的毫秒时间戳 (epoch) 开始递增, 重启后的 ID 仍大于重启前的 ID
+type EventBus struct {
+	mu          sync.Mutex
+	epoch       int64
+	seq         int64
+	buffer      []*model.StreamEvent
+	subscribers map[*Subscription]struct{}
+
+	resolveProject func(releaseID string) string
+	projects       sync.Map // releaseID -> projectID
+}
+
+func NewEventBus() *EventBus {
+	epoch := time.Now().UnixMilli()
+	return &EventBus{
+		epoch:       epoch,
+		seq:         epoch,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// SetProjectResolver 事件未带项目 ID 时按发布单查询, 结果会缓存
+func (b *EventBus) SetProjectResolver(resolve func(releaseID string) string) {
+	b.resolveProject = resolve
+}
+
+func (b *EventBus) projectOf(releaseID string) string {
+	if releaseID == "" {
+		return ""
+	}
+	if projectID, ok := b.projects.Load(releaseID); ok {
+		return projectID.(string)
+	}
+	if b.resolveProject == nil {
+		return ""
+	}
+	projectID := b.resolveProject(releaseID)
+	if projectID != "" {
+		b.projects.Store(releaseID, projectID)
+	}
+	return projectID
+}
+
+func (b *EventBus) Publish(eventType, releaseID string, data interface{}) {
+	projectID := b.projectOf(releaseID)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := &model.StreamEvent{
+		ID:        b.seq,
+		Type:      eventType,
+		ReleaseID: releaseID,
+		ProjectID: projectID,
+		Data:      data,
+		CreatedAt: time.Now(),
+	}
+
+	b.buffer = append(b.buffer, event)
+	if len(b.buffer) > streamBufferSize {
+		b.buffer = b.buffer[len(b.buffer)-streamBufferSize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.match(event) {
+			continue
+		}
+		select {
+		case sub.C <- event:
+		default:
+			b.closeLocked(sub)
+		}
+	}
+}
+
+// Subscribe 注册订阅并返回 lastEventID 之后的缓存事件, 两者在同一把锁内完成, 不会漏掉事件.
+// lastEventID 早于缓存中最早的事件、来自重启前的进程或不是本进程发出的 ID 时 missed 为 true,
+// 客户端需要重新拉取发布单状态
+func (b *EventBus) Subscribe(filter StreamFilter, lastEventID int64) (sub *Subscription, backlog []*model.StreamEvent, missed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastEventID > 0 {
+		missed = b.missedLocked(lastEventID)
+		for _, event := range b.buffer {
+			if event.ID > lastEventID && filter.match(event) {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	sub = &Subscription{
+		C:      make(chan *model.StreamEvent, streamSubscriberBuffer),
+		filter: filter,
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub, backlog, missed
+}
+
+// missedLocked 本进程的事件 ID 在 (epoch, seq] 之间, 缓存只保留其中最近的一段
+func (b *EventBus) missedLocked(lastEventID int64) bool {
+	if lastEventID <= b.epoch || lastEventID > b.seq {
+		return true
+	}
+	return len(b.buffer) > 0 && lastEventID < b.buffer[0].ID-1
+}
+
+func (b *EventBus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closeLocked(sub)
+}
+
+func (b *EventBus) closeLocked(sub *Subscription) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	delete(b.subscribers, sub)
+	close(sub.C)
+
+	if sub.filter.ProjectID != "" {
+		b.pruneProjectsLocked()
+	}
+}
+
+// pruneProjectsLocked 清除没有按项目订阅的项目的发布单缓存, 之后的事件再按需查询
+func (b *EventBus) pruneProjectsLocked() {
+	subscribed := map[string]bool{}
+	for sub := range b.subscribers {
+		if sub.filter.ProjectID != "" {
+			subscribed[sub.filter.ProjectID] = true
+		}
+	}
+	b.projects.Range(func(releaseID, projectID any) bool {
+		if !subscribed[projectID.(string)] {
+			b.projects.Delete(releaseID)
+		}
+		return true
+	})
+}
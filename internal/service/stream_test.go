@@ -0,0 +1,79 @@
+package service
+
+import "testing"
+
+func TestEventBusSubscribeMissed(t *testing.T) {
+	bus := NewEventBus()
+	first := bus.seq + 1
+	for i := 0; i < streamBufferSize+10; i++ {
+		bus.Publish(StreamEventStage, "r1", nil)
+	}
+	// 缓存已丢弃最早的 10 条事件
+	oldest := bus.buffer[0].ID
+
+	tests := []struct {
+		name        string
+		lastEventID int64
+		backlog     int
+		missed      bool
+	}{
+		{name: "no last event id", lastEventID: 0, backlog: 0, missed: false},
+		{name: "up to date", lastEventID: bus.seq, backlog: 0, missed: false},
+		{name: "just before the buffer", lastEventID: oldest - 1, backlog: streamBufferSize, missed: false},
+		{name: "older than the buffer", lastEventID: first, backlog: streamBufferSize, missed: true},
+		{name: "earlier process", lastEventID: bus.epoch - 100, backlog: streamBufferSize, missed: true},
+		{name: "epoch itself", lastEventID: bus.epoch, backlog: streamBufferSize, missed: true},
+		{name: "unknown future id", lastEventID: bus.seq + 1, backlog: 0, missed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, backlog, missed := bus.Subscribe(StreamFilter{}, tt.lastEventID)
+			defer bus.Unsubscribe(sub)
+			if missed != tt.missed {
+				t.Errorf("missed = %v, want %v", missed, tt.missed)
+			}
+			if len(backlog) != tt.backlog {
+				t.Errorf("backlog has %d events, want %d", len(backlog), tt.backlog)
+			}
+		})
+	}
+}
+
+func TestEventBusSubscribeAfterRestart(t *testing.T) {
+	// 重启后缓存为空, 重启前的 ID 也需要通知客户端重新拉取
+	bus := NewEventBus()
+	sub, backlog, missed := bus.Subscribe(StreamFilter{}, bus.epoch-1)
+	defer bus.Unsubscribe(sub)
+	if !missed || len(backlog) != 0 {
+		t.Errorf("Subscribe() = %d events, missed %v, want 0 events, missed true", len(backlog), missed)
+	}
+}
+
+func TestEventBusPruneProjects(t *testing.T) {
+	bus := NewEventBus()
+	bus.SetProjectResolver(func(releaseID string) string {
+		return map[string]string{"r1": "p1", "r2": "p2"}[releaseID]
+	})
+
+	sub1, _, _ := bus.Subscribe(StreamFilter{ProjectID: "p1"}, 0)
+	sub2, _, _ := bus.Subscribe(StreamFilter{ProjectID: "p2"}, 0)
+	bus.Publish(StreamEventStage, "r1", nil)
+	bus.Publish(StreamEventStage, "r2", nil)
+
+	cached := func(releaseID string) bool {
+		_, ok := bus.projects.Load(releaseID)
+		return ok
+	}
+	if !cached("r1") || !cached("r2") {
+		t.Fatal("project of published releases is not cached")
+	}
+
+	bus.Unsubscribe(sub2)
+	if !cached("r1") || cached("r2") {
+		t.Errorf("after unsubscribing p2: r1 cached %v, r2 cached %v, want true, false", cached("r1"), cached("r2"))
+	}
+	bus.Unsubscribe(sub1)
+	if cached("r1") {
+		t.Error("r1 is still cached after the last p1 subscriber left")
+	}
+}
@@ -13,6 +13,7 @@ import logging
 import fcntl
 import tempfile
 import re
+import base64
 from typing import Dict, List, Optional, Tuple
 from datetime import datetime
 from pathlib import Path
@@ -31,9 +32,16 @@ BIN_DIR = os.getenv("BIN_DIR", "/usr/local/bin")
 LOG_FILE = os.getenv("LOG_FILE", "/var/log/bin-proxy.log")
 LOCK_DIR = os.getenv("LOCK_DIR", "/var/run/bin-proxy")
 LOCK_TIMEOUT = int(os.getenv("LOCK_TIMEOUT", "600"))
-BIN_PROXY_VERSION = "1.2.0"
+BIN_PROXY_VERSION = "1.3.0"
 DOWNLOAD_BASE_URL = os.getenv("DOWNLOAD_BASE_URL", f"{BIN_MANAGER_API}/download")
 DOWNLOAD_TIMEOUT = int(os.getenv("DOWNLOAD_TIMEOUT", "300"))
+# 受信任公钥目录 (<keyId>.pub), 未配置时从 Manager 的 /artifact-keys 获取
+TRUSTED_KEY_DIR = os.getenv("TRUSTED_KEY_DIR", "")
+# 为 true 时拒绝安装没有签名的产物
+REQUIRE_SIGNATURE = os.getenv("REQUIRE_SIGNATURE", "false").lower() in ("1", "true", "yes")
+
+# query_latest_sha256 返回的产物签名, 下载后验签
+LATEST_SIGNATURES: Dict[str, Optional[dict]] = {}
 
 logging.basicConfig(
     level=logging.INFO,
@@ -328,9 +336,12 @@ def query_latest_sha256(bin_name: str) -> Optional[str]:
     url = f"{BIN_MANAGER_API}/bins/{bin_name}"
 
     try:
-        response = requests.get(url, timeout=10, verify=True)
+        response = requests.get(
+            url, params={"node_id": socket.gethostname()}, timeout=10, verify=True
+        )
         if response.status_code == 200:
             data = response.json()
+            LATEST_SIGNATURES[bin_name] = data.get("signature")
             if "sha256sum" in data:
                 return data["sha256sum"]
             elif "sha256" in data:
@@ -343,6 +354,81 @@ def query_latest_sha256(bin_name: str) -> Optional[str]:
         return None
 
 
+def load_trusted_key(key_id: str) -> Optional[str]:
+    if not re.match(r"^[0-9a-f]+$", key_id):
+        error(f"Invalid signing key id: {key_id}")
+        return None
+
+    if TRUSTED_KEY_DIR:
+        key_file = os.path.join(TRUSTED_KEY_DIR, f"{key_id}.pub")
+        if not os.path.exists(key_file):
+            error(f"Signing key {key_id} is not in {TRUSTED_KEY_DIR}")
+            return None
+        with open(key_file, "r") as f:
+            return f.read()
+
+    try:
+        response = requests.get(f"{BIN_MANAGER_API}/artifact-keys", timeout=10, verify=True)
+        if response.status_code == 200:
+            for key in response.json().get("data") or []:
+                if key.get("id") == key_id:
+                    return key.get("pem")
+        error(f"Signing key {key_id} is not trusted by bin manager")
+        return None
+    except Exception as e:
+        error(f"Failed to fetch signing keys: {e}")
+        return None
+
+
+def verify_signature(bin_name: str, sha256: str) -> bool:
+    """按 Manager 的签名格式 sha256:<sha256> 用 ed25519 公钥验签, 依赖 openssl 3"""
+    signature = LATEST_SIGNATURES.get(bin_name)
+    if not signature:
+        if REQUIRE_SIGNATURE:
+            error(f"{bin_name} (SHA256: {sha256}) is not signed")
+            return False
+        log(f"{bin_name} (SHA256: {sha256}) is not signed, skipping signature verification")
+        return True
+
+    key_id = signature.get("keyId", "")
+    if signature.get("algorithm") != "ed25519":
+        error(f"Unsupported signature algorithm for {bin_name}: {signature.get('algorithm')}")
+        return False
+    public_key = load_trusted_key(key_id)
+    if not public_key:
+        return False
+
+    try:
+        raw_signature = base64.b64decode(signature.get("signature", ""), validate=True)
+        with tempfile.TemporaryDirectory(prefix="bin-proxy-verify.") as tmp:
+            key_file = os.path.join(tmp, "key.pub")
+            message_file = os.path.join(tmp, "message")
+            signature_file = os.path.join(tmp, "signature")
+            with open(key_file, "w") as f:
+                f.write(public_key)
+            with open(message_file, "wb") as f:
+                f.write(f"sha256:{sha256}".encode())
+            with open(signature_file, "wb") as f:
+                f.write(raw_signature)
+
+            result = subprocess.run(
+                ["openssl", "pkeyutl", "-verify", "-pubin", "-inkey", key_file,
+                 "-rawin", "-in", message_file, "-sigfile", signature_file],
+                capture_output=True,
+                text=True,
+                timeout=30,
+            )
+    except Exception as e:
+        error(f"Failed to verify signature of {bin_name}: {e}")
+        return False
+
+    if result.returncode != 0:
+        error(f"Signature verification failed for {bin_name} (key: {key_id}): {result.stdout.strip()} {result.stderr.strip()}")
+        return False
+    log(f"Signature of {bin_name} verified (key: {key_id})")
+    return True
+
+
 def download_binary(bin_name: str, temp_file: str) -> bool:
     if not bin_name or not temp_file:
         error("bin_name and temp_file are required for download_binary")
@@ -365,7 +451,13 @@ def download_binary(bin_name: str, temp_file: str) -> bool:
     log(f"Downloading {bin_name} from {url}")
 
     try:
-        response = requests.get(url, timeout=DOWNLOAD_TIMEOUT, stream=True, verify=True)
+        response = requests.get(
+            url,
+            params={"node_id": socket.gethostname()},
+            timeout=DOWNLOAD_TIMEOUT,
+            stream=True,
+            verify=True,
+        )
         if response.status_code == 200:
             with open(temp_file, "wb") as f:
                 for chunk in response.iter_content(chunk_size=8192):
@@ -440,6 +532,11 @@ def _get_source_file_for_upgrade(
         report_completion(bin_name, target_sha256, "failed")
         return None
 
+    if not verify_signature(bin_name, downloaded_sha256):
+        os.unlink(source_file)
+        report_completion(bin_name, target_sha256, "failed")
+        return None
+
     return source_file
 
 
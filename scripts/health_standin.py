@@ -0,0 +1,38 @@
+#!/usr/bin/python3
+"""模拟应用的健康检查接口, 用于本地验证部署后的健康检查和自动回滚.
+
+GET  /health                   健康时返回 200, 否则返回 503
+POST /toggle?healthy=true|false 切换健康状态, 不带参数时取反
+"""
+import argparse
+
+from flask import Flask, jsonify, request
+
+app = Flask(__name__)
+
+state = {"healthy": True}
+
+
+@app.route("/health", methods=["GET"])
+def health():
+    if state["healthy"]:
+        return jsonify({"status": "ok"}), 200
+    return jsonify({"status": "unhealthy"}), 503
+
+
+@app.route("/toggle", methods=["POST"])
+def toggle():
+    healthy = request.args.get("healthy")
+    if healthy is None:
+        state["healthy"] = not state["healthy"]
+    else:
+        state["healthy"] = healthy.lower() == "true"
+    return jsonify(state), 200
+
+
+if __name__ == "__main__":
+    parser = argparse.ArgumentParser()
+    parser.add_argument("--host", default="127.0.0.1")
+    parser.add_argument("--port", type=int, default=18080)
+    args = parser.parse_args()
+    app.run(host=args.host, port=args.port)